@@ -60,7 +60,6 @@ func NewCmdAccountLogin() *cobra.Command {
 			}
 			app := v.(*app.Ctx)
 
-			auth := fbauth.NewRESTClient()
 			var tart *fbauth.TokenAndRefreshToken
 			var developerKey string
 			autoconf, err := app.Client.AutoConf(ctx)
@@ -68,6 +67,11 @@ func NewCmdAccountLogin() *cobra.Command {
 				fmt.Fprintf(os.Stderr, "Failed to auto configure via the endpoint: %v.\n", err)
 				os.Exit(1)
 			}
+			auth, err := app.AuthClient(autoconf)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
 
 			if useEmailLogin {
 				email, password, err := readEmailAndPassword()
@@ -76,7 +80,7 @@ func NewCmdAccountLogin() *cobra.Command {
 					os.Exit(1)
 				}
 
-				sir, err := auth.SignInWithEmailAndPassword(autoconf.Data.FirebaseConfig.APIKey, email, string(password))
+				sir, err := auth.SignInWithEmailAndPassword(ctx, autoconf.Data.FirebaseConfig.APIKey, email, string(password))
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Failed to signin with email and password: %v\n", err)
 					os.Exit(1)
@@ -94,13 +98,13 @@ func NewCmdAccountLogin() *cobra.Command {
 				}
 
 				// Signin With the developer key.
-				token, _, err := app.Client.SignInWithDevKey(string(developerKey))
+				token, _, err := app.Client.SignInWithDevKey(ctx, string(developerKey))
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Failed to sign in using developer key: %v\n", err)
 					os.Exit(1)
 				}
 
-				tart, err = auth.ExchangeCustomTokenForIDAndRefreshToken(autoconf.Data.FirebaseConfig.APIKey, token)
+				tart, err = auth.ExchangeCustomTokenForIDAndRefreshToken(ctx, autoconf.Data.FirebaseConfig.APIKey, token)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Failed to exchange custom token for refresh: %+v\n", err)
 					os.Exit(1)
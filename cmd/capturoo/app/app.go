@@ -1,6 +1,12 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
 	"capturoo-cli-tool-go/cmd/capturoo/configmgr"
 	"capturoo-cli-tool-go/fbauth"
 	"capturoo-cli-tool-go/http"
@@ -19,3 +25,118 @@ type Ctx struct {
 	TART          *fbauth.TokenAndRefreshToken
 	JWTData       *configmgr.JWTData
 }
+
+// NewProfileCtx returns a signed in application context for the
+// endpoint of the given profile. The client shares the settings of the
+// application context in ctx, if any, less those set by the profile.
+func NewProfileCtx(ctx context.Context, p *configmgr.Profile) (*Ctx, error) {
+	tokenFilename, err := configmgr.TokenFilename(p.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	client := http.NewClient(p.Endpoint)
+	if parent, ok := ctx.Value(ApplicationKey("appk")).(*Ctx); ok {
+		client = parent.Client.WithEndpoint(p.Endpoint)
+	}
+	if p.Timeout != nil {
+		client.Timeout = *p.Timeout
+	}
+	if p.Retries != nil {
+		client.Retry.Retries = *p.Retries
+	}
+	if p.RetryBackoff != nil {
+		client.Retry.Backoff = *p.RetryBackoff
+	}
+	if p.Rate != "" {
+		if client.Limiter.Rate, err = http.ParseRate(p.Rate); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+	}
+	if p.Concurrency != nil {
+		client.Limiter.Concurrency = *p.Concurrency
+	}
+	a := &Ctx{
+		Endpoint:      p.Endpoint,
+		TokenFilename: tokenFilename,
+		Client:        client,
+	}
+	if err := a.SignIn(ctx); err != nil {
+		return nil, fmt.Errorf("profile %q: %w", p.Name, err)
+	}
+	return a, nil
+}
+
+// SignIn reads the token for the endpoint from the filesystem, exchanging
+// the refresh token for a new one if it has expired.
+func (a *Ctx) SignIn(ctx context.Context) error {
+	tart, err := configmgr.ReadTokenAndRefreshToken(a.TokenFilename)
+	if errors.Is(err, configmgr.ErrTokenExpired) {
+		// If the current token has expired, exchange the refresh token
+		// for a new one.
+		autoconf, err := a.Client.AutoConf(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to auto configure via the endpoint %v: %w", a.Endpoint, err)
+		}
+		auth, err := a.AuthClient(autoconf)
+		if err != nil {
+			return err
+		}
+		tart, err = auth.ExchangeRefreshTokenForIDToken(ctx, autoconf.Data.FirebaseConfig.APIKey, tart.RefreshToken)
+		if err != nil {
+			return fmt.Errorf("exchange refresh token for ID token failed: %w", err)
+		}
+		if err := configmgr.WriteTokenAndRefreshToken(a.TokenFilename, tart); err != nil {
+			return fmt.Errorf("failed to write new token: %w", err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	a.Client.JWT = tart.IDToken
+	a.TART = tart
+
+	a.JWTData, err = configmgr.ParseJWT(tart.IDToken)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWT: %w", err)
+	}
+	return nil
+}
+
+// AuthClient returns a Firebase Auth client for the endpoint, limited by
+// the timeout of the API client. The auth emulator host sent by the
+// endpoint in autoconf is only used when both the endpoint and the
+// emulator are on the loopback interface, so that an endpoint cannot have
+// credentials sent in the clear to a host of its choosing.
+func (a *Ctx) AuthClient(autoconf *http.AutoConf) (*fbauth.RESTClient, error) {
+	endpoint := a.Endpoint
+	auth := fbauth.NewRESTClient()
+	if a.Client != nil {
+		auth.SetTimeout(a.Client.Timeout)
+	}
+	h := autoconf.Data.AuthEmulatorHost
+	if h == "" {
+		return auth, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint %q: %w", endpoint, err)
+	}
+	host, _, err := net.SplitHostPort(h)
+	if err != nil {
+		host = h
+	}
+	if !isLoopback(u.Hostname()) || !isLoopback(host) {
+		return nil, fmt.Errorf("endpoint %s asked to use the auth emulator at %s; the auth emulator is only used with a local endpoint on a local host", endpoint, h)
+	}
+	auth.UseEmulator(h)
+	return auth, nil
+}
+
+// isLoopback reports whether host is localhost or a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"testing"
+
+	"capturoo-cli-tool-go/http"
+)
+
+func TestAuthClient(t *testing.T) {
+	tests := []struct {
+		endpoint, emulator string
+		wantErr            bool
+	}{
+		{"https://api.capturoo.com", "", false},
+		{"http://localhost:8080", "localhost:8080", false},
+		{"http://127.0.0.1:8080", "127.0.0.1:8080", false},
+		{"http://[::1]:8080", "[::1]:8080", false},
+		{"https://api.capturoo.com", "localhost:8080", true},
+		{"https://evil.example.com", "evil.example.com:80", true},
+		{"http://localhost:8080", "evil.example.com:80", true},
+		{"http://localhost.evil.example.com:8080", "localhost:8080", true},
+	}
+	for _, tc := range tests {
+		var ac http.AutoConf
+		ac.Data.AuthEmulatorHost = tc.emulator
+		a := &Ctx{Endpoint: tc.endpoint}
+		if _, err := a.AuthClient(&ac); (err != nil) != tc.wantErr {
+			t.Errorf("AuthClient(%q, %q) error incorrect, got: %v, want error: %t", tc.endpoint, tc.emulator, err, tc.wantErr)
+		}
+	}
+}
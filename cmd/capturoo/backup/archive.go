@@ -0,0 +1,221 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	formatVersion    = 1
+	manifestFilename = "manifest.json"
+	bucketsFilename  = "buckets.json"
+	webhooksFilename = "webhooks.json"
+)
+
+// Manifest describes the contents of a backup archive. It is the first
+// entry of the archive.
+type Manifest struct {
+	Version    int                  `json:"version"`
+	AccountID  string               `json:"accountId"`
+	Endpoint   string               `json:"endpoint"`
+	CLIVersion string               `json:"cliVersion,omitempty"`
+	Created    time.Time            `json:"created"`
+	Buckets    []ManifestBucket     `json:"buckets"`
+	Webhooks   int                  `json:"webhooks"`
+	Files      map[string]*FileInfo `json:"files"`
+}
+
+// ManifestBucket records the leads file for a bucket.
+type ManifestBucket struct {
+	Code      string `json:"code"`
+	Leads     int    `json:"leads"`
+	LeadsFile string `json:"leadsFile"`
+}
+
+// FileInfo holds the size and SHA-256 checksum of an archive entry.
+type FileInfo struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func leadsFilename(bucketCode string) string {
+	return "leads/" + bucketCode + ".ndjson"
+}
+
+// stagedFile is a temporary file written while hashing its content so it
+// can be added to the archive after the manifest.
+type stagedFile struct {
+	name string
+	f    *os.File
+	h    hash.Hash
+	size int64
+}
+
+func newStagedFile(name string) (*stagedFile, error) {
+	f, err := ioutil.TempFile("", "capturoo-backup-")
+	if err != nil {
+		return nil, err
+	}
+	return &stagedFile{name: name, f: f, h: sha256.New()}, nil
+}
+
+func (s *stagedFile) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.h.Write(p[:n])
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *stagedFile) info() *FileInfo {
+	return &FileInfo{Size: s.size, SHA256: hex.EncodeToString(s.h.Sum(nil))}
+}
+
+func (s *stagedFile) remove() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+// writeArchive writes the manifest followed by the staged files to a
+// gzipped tar at w.
+func writeArchive(w io.Writer, m *Manifest, files []*stagedFile) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json encode manifest: %w", err)
+	}
+	hdr := &tar.Header{
+		Name:    manifestFilename,
+		Mode:    0644,
+		Size:    int64(len(mb)),
+		ModTime: m.Created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(mb); err != nil {
+		return err
+	}
+
+	for _, s := range files {
+		if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:    s.name,
+			Mode:    0644,
+			Size:    s.size,
+			ModTime: m.Created,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, s.f); err != nil {
+			return fmt.Errorf("write %s: %w", s.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// archiveReader iterates the entries of a backup archive.
+type archiveReader struct {
+	f  *os.File
+	gz *gzip.Reader
+	tr *tar.Reader
+}
+
+func openArchive(filename string) (*archiveReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a gzipped backup: %w", filename, err)
+	}
+	return &archiveReader{f: f, gz: gz, tr: tar.NewReader(gz)}, nil
+}
+
+func (a *archiveReader) Close() error {
+	a.gz.Close()
+	return a.f.Close()
+}
+
+// readManifest reads the manifest from the first entry of the archive.
+func (a *archiveReader) readManifest() (*Manifest, error) {
+	hdr, err := a.tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	if hdr.Name != manifestFilename {
+		return nil, fmt.Errorf("archive does not start with %s", manifestFilename)
+	}
+	var m Manifest
+	if err := json.NewDecoder(a.tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("json decode manifest: %w", err)
+	}
+	if m.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// verifyArchive checks that every file listed in the manifest is present
+// with the recorded size and checksum.
+func verifyArchive(filename string) (*Manifest, error) {
+	a, err := openArchive(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	m, err := a.readManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for {
+		hdr, err := a.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		want, ok := m.Files[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected file %q in archive", hdr.Name)
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, a.tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		if n != want.Size || hex.EncodeToString(h.Sum(nil)) != want.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", hdr.Name)
+		}
+		seen[hdr.Name] = true
+	}
+	for name := range m.Files {
+		if !seen[name] {
+			return nil, fmt.Errorf("file %s listed in the manifest is missing from the archive", name)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestArchive(t *testing.T, dir string, contents map[string]string) string {
+	m := &Manifest{
+		Version: formatVersion,
+		Created: time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC),
+		Files:   make(map[string]*FileInfo),
+	}
+	var files []*stagedFile
+	for _, name := range []string{bucketsFilename, webhooksFilename, leadsFilename("summer")} {
+		s, err := newStagedFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.remove()
+		if _, err := s.Write([]byte(contents[name])); err != nil {
+			t.Fatal(err)
+		}
+		m.Files[name] = s.info()
+		files = append(files, s)
+	}
+
+	filename := filepath.Join(dir, "backup.tar.gz")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := writeArchive(f, m, files); err != nil {
+		t.Fatalf("writeArchive returned an error: %v", err)
+	}
+	return filename
+}
+
+func TestVerifyArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capturoo-backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := map[string]string{
+		bucketsFilename:         `[{"bucketCode":"summer"}]`,
+		webhooksFilename:        `[]`,
+		leadsFilename("summer"): "{\"leadId\":\"1\"}\n{\"leadId\":\"2\"}\n",
+	}
+	filename := writeTestArchive(t, dir, contents)
+
+	m, err := verifyArchive(filename)
+	if err != nil {
+		t.Fatalf("verifyArchive returned an error: %v", err)
+	}
+	if len(m.Files) != 3 {
+		t.Errorf("len(m.Files) incorrect, got: %d, want: %d", len(m.Files), 3)
+	}
+
+	// corrupt the recorded checksum of one file
+	ar, err := openArchive(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = ar.readManifest()
+	ar.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Files[webhooksFilename].SHA256 = strings.Repeat("0", 64)
+
+	var files []*stagedFile
+	for _, name := range []string{bucketsFilename, webhooksFilename, leadsFilename("summer")} {
+		s, err := newStagedFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.remove()
+		s.Write([]byte(contents[name]))
+		files = append(files, s)
+	}
+	corrupt := filepath.Join(dir, "corrupt.tar.gz")
+	f, err := os.Create(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeArchive(f, m, files); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := verifyArchive(corrupt); err == nil {
+		t.Errorf("verifyArchive expected a checksum error, got nil")
+	}
+}
@@ -0,0 +1,434 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/cmd/capturoo/configmgr"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdBackup returns an instance of the backup command.
+func NewCmdBackup() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "backup -o backup.tar.gz",
+		Short: "Back up all buckets, webhooks and leads of the account",
+		Long: `Back up all buckets, webhooks and leads of the account to a gzipped tar
+archive. The archive starts with manifest.json listing the SHA-256 checksum
+of every other file followed by buckets.json, webhooks.json and one
+leads/BUCKET_CODE.ndjson file per bucket. The archive is only readable by
+its owner as it holds every lead.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("backup accepts no arguments; use -o FILE")
+			}
+			if output == "" {
+				return errors.New("set the output file using -o FILE")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			// write to a temporary file alongside the output so that a
+			// failed backup never leaves a partial archive behind.
+			// the archive holds every lead so only the owner may read it.
+			tmp := output + ".partial"
+			f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			m, err := backupAccount(ctx, app, f)
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(tmp)
+				fmt.Fprintf(os.Stderr, "backup failed: %v\n", err)
+				os.Exit(1)
+			}
+			if err := os.Rename(tmp, output); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			var leads int
+			for _, b := range m.Buckets {
+				leads += b.Leads
+			}
+			fmt.Printf("Backed up %d buckets, %d webhooks and %d leads to %s.\n", len(m.Buckets), m.Webhooks, leads, output)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output archive file")
+	return cmd
+}
+
+// backupAccount writes an archive of the account's buckets, webhooks and leads to w.
+func backupAccount(ctx context.Context, a *app.Ctx, w io.Writer) (*Manifest, error) {
+	buckets, err := a.Client.GetBuckets(ctx, a.JWTData.CapAID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get buckets: %w", err)
+	}
+	webhooks, err := a.Client.GetWebhooks(ctx, a.JWTData.CapAID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	m := &Manifest{
+		Version:    formatVersion,
+		AccountID:  a.JWTData.CapAID,
+		Endpoint:   a.Endpoint,
+		CLIVersion: a.Version,
+		Created:    time.Now().UTC().Truncate(time.Second),
+		Buckets:    make([]ManifestBucket, 0, len(buckets)),
+		Webhooks:   len(webhooks),
+		Files:      make(map[string]*FileInfo),
+	}
+
+	var files []*stagedFile
+	defer func() {
+		for _, s := range files {
+			s.remove()
+		}
+	}()
+	stage := func(name string, fn func(w io.Writer) error) error {
+		s, err := newStagedFile(name)
+		if err != nil {
+			return err
+		}
+		files = append(files, s)
+		bw := bufio.NewWriter(s)
+		if err := fn(bw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		m.Files[name] = s.info()
+		return nil
+	}
+
+	if err := stage(bucketsFilename, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(buckets)
+	}); err != nil {
+		return nil, err
+	}
+	if err := stage(webhooksFilename, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(webhooks)
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, b := range buckets {
+		mb := ManifestBucket{
+			Code:      b.BucketCode,
+			LeadsFile: leadsFilename(b.BucketCode),
+		}
+		err := stage(mb.LeadsFile, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			return a.Client.ForEachLead(ctx, b.BucketID, func(lead *http.Lead) error {
+				mb.Leads++
+				return enc.Encode(lead)
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.Buckets = append(m.Buckets, mb)
+		fmt.Fprintf(os.Stderr, "Bucket %s: %d leads.\n", b.BucketCode, mb.Leads)
+	}
+
+	if err := writeArchive(w, m, files); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewCmdRestore returns an instance of the restore command.
+func NewCmdRestore() *cobra.Command {
+	var profile string
+	var verifyOnly, skipLeads, disableWebhooks, mergeLeads bool
+	var batchSize int
+
+	cmd := &cobra.Command{
+		Use:   "restore BACKUP_FILE [--profile PROFILE]",
+		Short: "Restore buckets, webhooks and leads from a backup",
+		Long: `Restore buckets, webhooks and leads from a backup archive, optionally to the
+endpoint of another profile defined in ~/.capturoo/config.yaml. Every file
+is verified against the checksums in the manifest before any change is made.
+Buckets and webhooks that already exist are left unchanged.
+
+Leads are only imported into the buckets the restore creates, so running a
+restore twice does not duplicate them. With --merge-leads the leads of
+buckets that already exist are imported too, skipping those whose lead ID
+is already in the bucket. Leads given a new ID by the server on import
+cannot be matched and are imported again.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing BACKUP_FILE argument")
+			}
+			if len(args) > 1 {
+				return errors.New("restore accepts a single argument")
+			}
+			if batchSize < 1 {
+				return errors.New("--batch-size must be at least 1")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			target := v.(*app.Ctx)
+
+			filename := args[0]
+			m, err := verifyArchive(filename)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Backup verification failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Verified backup of account %s taken %s from %s.\n", m.AccountID, m.Created.Format(time.RFC3339), m.Endpoint)
+			if verifyOnly {
+				return
+			}
+
+			if profile != "" {
+				p, err := configmgr.ReadProfile(profile)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				target, err = app.NewProfileCtx(ctx, p)
+				if errors.Is(err, configmgr.ErrTokenFileNotFound) {
+					fmt.Fprintf(os.Stderr, "No account configured for profile %q. Run CAPTUROO_CLI_ENDPOINT=%s capturoo account login to begin.\n", p.Name, p.Endpoint)
+					os.Exit(1)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			opts := restoreOptions{
+				skipLeads:       skipLeads,
+				disableWebhooks: disableWebhooks,
+				mergeLeads:      mergeLeads,
+				batchSize:       batchSize,
+			}
+			if err := restoreAccount(ctx, target, filename, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "restore failed: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&profile, "profile", "", "", "profile of the endpoint to restore to (defaults to the current endpoint)")
+	cmd.Flags().BoolVarP(&verifyOnly, "verify", "", false, "verify the archive checksums without restoring")
+	cmd.Flags().BoolVarP(&skipLeads, "skip-leads", "", false, "restore buckets and webhooks only")
+	cmd.Flags().BoolVarP(&disableWebhooks, "disable-webhooks", "", false, "create restored webhooks disabled (useful when cloning production)")
+	cmd.Flags().BoolVarP(&mergeLeads, "merge-leads", "", false, "also import leads into buckets that already exist, skipping lead IDs already there")
+	cmd.Flags().IntVarP(&batchSize, "batch-size", "", 100, "number of leads imported per request")
+	return cmd
+}
+
+type restoreOptions struct {
+	skipLeads       bool
+	disableWebhooks bool
+	mergeLeads      bool
+	batchSize       int
+}
+
+// restoreAccount recreates the buckets and webhooks of a verified archive and
+// imports its leads into the account of a.
+func restoreAccount(ctx context.Context, a *app.Ctx, filename string, opts restoreOptions) error {
+	ar, err := openArchive(filename)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	if _, err := ar.readManifest(); err != nil {
+		return err
+	}
+
+	live, err := a.Client.GetBuckets(ctx, a.JWTData.CapAID)
+	if err != nil {
+		return fmt.Errorf("failed to get buckets: %w", err)
+	}
+	bucketIDs := make(map[string]string)
+	existed := make(map[string]bool)
+	for _, b := range live {
+		existed[b.BucketCode] = true
+		bucketIDs[b.BucketCode] = b.BucketID
+	}
+
+	var bucketsRestored bool
+	for {
+		hdr, err := ar.tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case hdr.Name == bucketsFilename:
+			var buckets []*http.Bucket
+			if err := json.NewDecoder(ar.tr).Decode(&buckets); err != nil {
+				return fmt.Errorf("json decode %s: %w", hdr.Name, err)
+			}
+			for _, b := range buckets {
+				if _, ok := bucketIDs[b.BucketCode]; ok {
+					fmt.Printf("Bucket %s already exists.\n", b.BucketCode)
+					continue
+				}
+				nb, err := a.Client.CreateBucket(ctx, a.JWTData.CapAID, b.BucketCode, b.BucketName)
+				if err != nil {
+					return fmt.Errorf("failed to create bucket %q: %w", b.BucketCode, err)
+				}
+				bucketIDs[nb.BucketCode] = nb.BucketID
+				fmt.Printf("Bucket %s created.\n", b.BucketCode)
+			}
+			bucketsRestored = true
+
+		case hdr.Name == webhooksFilename:
+			var webhooks []*http.Webhook
+			if err := json.NewDecoder(ar.tr).Decode(&webhooks); err != nil {
+				return fmt.Errorf("json decode %s: %w", hdr.Name, err)
+			}
+			if err := restoreWebhooks(ctx, a, webhooks, opts.disableWebhooks); err != nil {
+				return err
+			}
+
+		case strings.HasPrefix(hdr.Name, "leads/"):
+			if opts.skipLeads {
+				continue
+			}
+			if !bucketsRestored {
+				return fmt.Errorf("%s appears before %s in the archive", hdr.Name, bucketsFilename)
+			}
+			code := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "leads/"), ".ndjson")
+			bucketID, ok := bucketIDs[code]
+			if !ok {
+				return fmt.Errorf("bucket %q for %s was not restored", code, hdr.Name)
+			}
+			var skip map[string]bool
+			if existed[code] {
+				if !opts.mergeLeads {
+					fmt.Printf("Bucket %s: leads not imported as the bucket already existed (see --merge-leads).\n", code)
+					continue
+				}
+				if skip, err = leadIDs(ctx, a.Client, bucketID); err != nil {
+					return fmt.Errorf("failed to list leads of bucket %q: %w", code, err)
+				}
+			}
+			n, skipped, err := importLeads(ctx, a.Client, bucketID, ar.tr, opts.batchSize, skip)
+			if err != nil {
+				return fmt.Errorf("failed to import leads into bucket %q after %d leads: %w", code, n, err)
+			}
+			if skipped > 0 {
+				fmt.Printf("Bucket %s: %d leads imported, %d already there.\n", code, n, skipped)
+			} else {
+				fmt.Printf("Bucket %s: %d leads imported.\n", code, n)
+			}
+		}
+	}
+	return nil
+}
+
+func restoreWebhooks(ctx context.Context, a *app.Ctx, webhooks []*http.Webhook, disable bool) error {
+	live, err := a.Client.GetWebhooks(ctx, a.JWTData.CapAID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	exists := make(map[string]bool)
+	for _, w := range live {
+		exists[w.Code] = true
+	}
+	for _, w := range webhooks {
+		if exists[w.Code] {
+			fmt.Printf("Webhook %s already exists.\n", w.Code)
+			continue
+		}
+		enabled := w.Enabled && !disable
+		if _, err := a.Client.CreateWebhook(ctx, a.JWTData.CapAID, w.Code, w.URL, w.Events, enabled, w.Transform); err != nil {
+			return fmt.Errorf("failed to create webhook %q: %w", w.Code, err)
+		}
+		fmt.Printf("Webhook %s created.\n", w.Code)
+	}
+	return nil
+}
+
+// leadIDs returns the IDs of the leads in a bucket.
+func leadIDs(ctx context.Context, client *http.Client, bucketID string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	err := client.ForEachLead(ctx, bucketID, func(l *http.Lead) error {
+		ids[l.LeadID] = true
+		return nil
+	})
+	return ids, err
+}
+
+// importLeads reads newline delimited JSON leads from r and imports them
+// in batches, skipping those with an ID in skip. It returns the number
+// imported and skipped.
+func importLeads(ctx context.Context, client *http.Client, bucketID string, r io.Reader, batchSize int, skip map[string]bool) (int, int, error) {
+	var imported, skipped int
+	batch := make([]*http.Lead, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := client.ImportLeads(ctx, bucketID, batch)
+		if err != nil {
+			return err
+		}
+		if n != len(batch) {
+			return fmt.Errorf("imported %d of a batch of %d leads", n, len(batch))
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		var lead http.Lead
+		if err := dec.Decode(&lead); err != nil {
+			return imported, skipped, fmt.Errorf("json decode: %w", err)
+		}
+		if skip[lead.LeadID] {
+			skipped++
+			continue
+		}
+		batch = append(batch, &lead)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return imported, skipped, err
+			}
+		}
+	}
+	return imported, skipped, flush()
+}
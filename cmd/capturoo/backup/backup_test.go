@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/cmd/capturoo/configmgr"
+	"capturoo-cli-tool-go/emulator"
+	capturoo "capturoo-cli-tool-go/http"
+)
+
+// newTestCtx returns an application context signed in to an emulator,
+// which reports no leads imported when short is set.
+func newTestCtx(t *testing.T, short *bool) *app.Ctx {
+	t.Helper()
+	srv, err := emulator.NewServer(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/leads/import" && short != nil && *short {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"object":"import","imported":0}`)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	client := capturoo.NewClient(ts.URL)
+	client.JWT = srv.IDToken()
+	return &app.Ctx{
+		Endpoint: ts.URL,
+		Client:   client,
+		JWTData:  &configmgr.JWTData{CapAID: srv.Account().AccountID},
+	}
+}
+
+func bucketLeads(t *testing.T, a *app.Ctx, code string) []string {
+	t.Helper()
+	buckets, err := a.Client.GetBuckets(context.Background(), a.JWTData.CapAID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range buckets {
+		if b.BucketCode == code {
+			var ids []string
+			err := a.Client.ForEachLead(context.Background(), b.BucketID, func(l *capturoo.Lead) error {
+				ids = append(ids, l.LeadID)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ids
+		}
+	}
+	t.Fatalf("bucket %q not found", code)
+	return nil
+}
+
+func TestRestoreAccountTwice(t *testing.T) {
+	filename := writeTestArchive(t, t.TempDir(), map[string]string{
+		bucketsFilename:         `[{"bucketCode":"summer","bucketName":"Summer"}]`,
+		webhooksFilename:        `[]`,
+		leadsFilename("summer"): "{\"leadId\":\"1\"}\n{\"leadId\":\"2\"}\n",
+	})
+	a := newTestCtx(t, nil)
+	ctx := context.Background()
+
+	for i, opts := range []restoreOptions{
+		{batchSize: 1},
+		{batchSize: 1},
+		{batchSize: 1, mergeLeads: true},
+	} {
+		if err := restoreAccount(ctx, a, filename, opts); err != nil {
+			t.Fatalf("%d: restoreAccount returned an error: %v", i, err)
+		}
+		if got := bucketLeads(t, a, "summer"); strings.Join(got, ",") != "1,2" {
+			t.Errorf("%d: leads incorrect, got: %v, want: [1 2]", i, got)
+		}
+	}
+}
+
+func TestImportLeadsShort(t *testing.T) {
+	short := true
+	a := newTestCtx(t, &short)
+	b, err := a.Client.CreateBucket(context.Background(), a.JWTData.CapAID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := strings.NewReader("{\"leadId\":\"1\"}\n{\"leadId\":\"2\"}\n")
+	n, _, err := importLeads(context.Background(), a.Client, b.BucketID, r, 2, nil)
+	if err == nil || !strings.Contains(err.Error(), "imported 0 of a batch of 2") {
+		t.Errorf("importLeads error incorrect, got: %v, want short import", err)
+	}
+	if n != 0 {
+		t.Errorf("importLeads count incorrect, got: %d, want: 0", n)
+	}
+}
+
+func TestImportLeadsSkip(t *testing.T) {
+	a := newTestCtx(t, nil)
+	b, err := a.Client.CreateBucket(context.Background(), a.JWTData.CapAID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := strings.NewReader("{\"leadId\":\"1\"}\n{\"leadId\":\"2\"}\n{\"leadId\":\"3\"}\n")
+	n, skipped, err := importLeads(context.Background(), a.Client, b.BucketID, r, 10, map[string]bool{"2": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || skipped != 1 {
+		t.Errorf("importLeads counts incorrect, got: %d imported, %d skipped, want: 2, 1", n, skipped)
+	}
+}
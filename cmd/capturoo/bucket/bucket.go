@@ -3,7 +3,6 @@ package bucket
 import (
 	"capturoo-cli-tool-go/cmd/capturoo/app"
 	"capturoo-cli-tool-go/http"
-	"capturoo-cli-tool-go/internal"
 	"errors"
 	"fmt"
 	"os"
@@ -31,7 +30,7 @@ func NewCmdBucket() *cobra.Command {
 
 // NewCmdBucketCreate returns an instance of the bucket create sub command.
 func NewCmdBucketCreate() *cobra.Command {
-	var bucketName string
+	var bucketName, idempotencyKey string
 	cmd := &cobra.Command{
 		Use:   "create BUCKET_CODE [-n BUCKET_NAME]",
 		Short: "Create a new bucket",
@@ -51,15 +50,25 @@ func NewCmdBucketCreate() *cobra.Command {
 			app := v.(*app.Ctx)
 
 			bucketCode := args[0]
+			if idempotencyKey != "" {
+				ctx = http.WithIdempotencyKey(ctx, idempotencyKey)
+			}
 			bucket, err := app.Client.CreateBucket(ctx, app.JWTData.CapAID, bucketCode, bucketName)
-			if err == internal.ErrBucketCodeExists {
+			if errors.Is(err, http.ErrIdempotencyKeyReused) {
+				fmt.Fprintf(os.Stderr, "Idempotency key %q was already used for a different request.\n", idempotencyKey)
+				os.Exit(1)
+			}
+			if errors.Is(err, http.ErrBucketCodeExists) {
 				fmt.Fprintf(os.Stderr, "A bucket with code %q already exists.\n", bucketCode)
 				os.Exit(1)
 			}
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "failed to create bucket: %v", err)
+				fmt.Fprintf(os.Stderr, "failed to create bucket: %v\n", err)
 				os.Exit(1)
 			}
+			if bucket.Replayed {
+				fmt.Fprintf(os.Stderr, "Bucket %s was already created by an earlier request with the same idempotency key.\n", bucket.BucketCode)
+			}
 			tw := new(tabwriter.Writer).Init(os.Stdout, 0, 8, 2, ' ', 0)
 			format := "%s\t%s\t\n"
 
@@ -74,6 +83,7 @@ func NewCmdBucketCreate() *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVarP(&bucketName, "name", "n", "", "human readable bucket name to label your bucket")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "KEY making repeats of the command return the bucket it created (default generated)")
 	return cmd
 }
 
@@ -0,0 +1,102 @@
+package configmgr
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configFilename = "config.yaml"
+)
+
+// ErrProfileNotFound error
+var ErrProfileNotFound = errors.New("profile not found")
+
+// Profile holds the named settings for an endpoint. The optional client
+// settings replace those of the command line for requests to the profile.
+type Profile struct {
+	Name     string `yaml:"-"`
+	Endpoint string `yaml:"endpoint"`
+
+	Timeout      *time.Duration `yaml:"timeout,omitempty"`
+	Retries      *int           `yaml:"retries,omitempty"`
+	RetryBackoff *time.Duration `yaml:"retryBackoff,omitempty"`
+	Rate         string         `yaml:"rate,omitempty"`
+	Concurrency  *int           `yaml:"concurrency,omitempty"`
+}
+
+// Config is the contents of the ~/.capturoo/config.yaml file.
+//
+//	profiles:
+//	  prod:
+//	    endpoint: https://api.capturoo.com
+//	    timeout: 30s
+//	    retries: 5
+//	    rate: 10/s
+//	    concurrency: 4
+//	  staging:
+//	    endpoint: https://api-staging.capturoo.com
+type Config struct {
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// ReadProfile reads the named profile from the config file.
+func ReadProfile(name string) (*Profile, error) {
+	hd, err := homeDir()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get home directory")
+	}
+	filepath := filepath.Join(hd, configDir, configFilename)
+
+	exists, err := exists(filepath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "exists(path=%q) failed", filepath)
+	}
+	if !exists {
+		return nil, fmt.Errorf("profile %q not found as %q does not exist: %w", name, filepath, ErrProfileNotFound)
+	}
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file %q", filepath)
+	}
+	defer f.Close()
+
+	var cfg Config
+	if err := yaml.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, errors.Wrapf(err, "yaml decode %q", filepath)
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("profile %q: %w", name, ErrProfileNotFound)
+	}
+	if p.Endpoint == "" {
+		return nil, fmt.Errorf("profile %q has no endpoint set", name)
+	}
+	p.Name = name
+	return p, nil
+}
+
+// TokenFilename converts an endpoint URL to the name of the file used
+// to store its token, replacing the dot character with underscores.
+func TokenFilename(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse url %q: %w", endpoint, err)
+	}
+
+	port := u.Port()
+	var suffix string
+	if port != "" {
+		suffix = "_" + port
+	}
+	return strings.ReplaceAll(u.Hostname()+suffix, ".", "_"), nil
+}
@@ -0,0 +1,92 @@
+package dev
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+
+	"capturoo-cli-tool-go/emulator"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdDev returns the dev sub command.
+func NewCmdDev() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dev",
+		Short: "Local development tools",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// prevent root level PersistentPreRun
+		},
+	}
+	cmd.AddCommand(NewCmdDevServer())
+	return cmd
+}
+
+// NewCmdDevServer returns the dev server sub command.
+func NewCmdDevServer() *cobra.Command {
+	var port int
+	var dataFile string
+	var opts emulator.Options
+
+	cmd := &cobra.Command{
+		Use:   "server [--port 8080] [--data FILE]",
+		Short: "Run a local emulator of the Capturoo API",
+		Long: `Run a local emulator of the Capturoo API and the Firebase Auth endpoints
+used for signing in. State is kept in memory unless --data is given, in
+which case it is loaded from and saved to the file.
+
+Point the CLI at the emulator with the CAPTUROO_CLI_ENDPOINT environment
+variable and sign in with the developer key printed on start:
+
+	CAPTUROO_CLI_ENDPOINT=http://localhost:8080 capturoo account login`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.DataFile = dataFile
+			srv, err := emulator.NewServer(opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to start emulator: %v\n", err)
+				os.Exit(1)
+			}
+
+			addr := net.JoinHostPort("localhost", strconv.Itoa(port))
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to listen on %s: %v\n", addr, err)
+				os.Exit(1)
+			}
+
+			acc := srv.Account()
+			fmt.Printf("Capturoo API emulator listening on http://%s\n", addr)
+			fmt.Printf("Account ID:    %s\n", acc.AccountID)
+			fmt.Printf("Developer key: %s\n", acc.DeveloperKey)
+			fmt.Printf("Email login:   %s / %s\n", acc.Email, acc.Password)
+			if dataFile != "" {
+				fmt.Printf("State file:    %s\n", dataFile)
+			}
+			fmt.Printf("\nCAPTUROO_CLI_ENDPOINT=http://%s capturoo account login\n", addr)
+
+			hs := &http.Server{Handler: srv}
+			done := make(chan struct{})
+			go func() {
+				<-cmd.Context().Done()
+				hs.Shutdown(context.Background())
+				close(done)
+			}()
+			if err := hs.Serve(ln); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			<-done
+		},
+	}
+	cmd.Flags().IntVarP(&port, "port", "p", 8080, "port to listen on")
+	cmd.Flags().StringVar(&dataFile, "data", "", "file to persist the emulator state to")
+	cmd.Flags().StringVar(&opts.DeveloperKey, "dev-key", "", "developer key for the emulator account (default generated)")
+	cmd.Flags().StringVar(&opts.Email, "email", "", "email for the emulator account (default dev@localhost)")
+	cmd.Flags().StringVar(&opts.Password, "password", "", "password for the emulator account (default password)")
+	return cmd
+}
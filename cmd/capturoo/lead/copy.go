@@ -0,0 +1,274 @@
+package lead
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/cmd/capturoo/configmgr"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// checkpoint records the progress of a copy so it may be resumed.
+type checkpoint struct {
+	Source              string `json:"source"`
+	SourceEndpoint      string `json:"sourceEndpoint"`
+	Destination         string `json:"destination"`
+	DestinationEndpoint string `json:"destinationEndpoint"`
+	LastLeadID          string `json:"lastLeadId"`
+	Copied              int    `json:"copied"`
+}
+
+// checkpointLeadError is returned by copyLeads when the last lead copied
+// according to the checkpoint is no longer in the source bucket, so the
+// copy cannot tell where to resume.
+type checkpointLeadError struct {
+	leadID string
+}
+
+func (e *checkpointLeadError) Error() string {
+	return fmt.Sprintf("checkpoint lead %q not found in the source bucket", e.leadID)
+}
+
+// checkpointFilename returns the default checkpoint filename for a copy.
+// The endpoints are hashed into the name so that copies of the same bucket
+// codes between other endpoints do not share a checkpoint.
+func checkpointFilename(srcEndpoint, srcCode, dstEndpoint, dstCode string) string {
+	sum := sha256.Sum256([]byte(srcEndpoint + "\n" + dstEndpoint))
+	return fmt.Sprintf("copy-%s-%s-%x.checkpoint", srcCode, dstCode, sum[:4])
+}
+
+// NewCmdLeadCopy returns an instance of the lead copy sub command.
+func NewCmdLeadCopy() *cobra.Command {
+	var dstProfile, checkpointFile string
+	var dryRun bool
+	var batchSize int
+
+	cmd := &cobra.Command{
+		Use:   "copy SRC_BUCKET DST_BUCKET [--dst-profile PROFILE] [--dry-run]",
+		Short: "Copy leads from one bucket to another",
+		Long: `Copy leads from one bucket to another, optionally on the endpoint of another
+profile defined in ~/.capturoo/config.yaml. Progress is written to a checkpoint
+file after each batch so that a failed copy resumes where it left off when the
+command is run again.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				return errors.New("missing SRC_BUCKET and DST_BUCKET arguments")
+			}
+			if len(args) > 2 {
+				return errors.New("copy accepts two arguments")
+			}
+			if batchSize < 1 {
+				return errors.New("--batch-size must be at least 1")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			src := v.(*app.Ctx)
+
+			dst := src
+			if dstProfile != "" {
+				p, err := configmgr.ReadProfile(dstProfile)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				dst, err = app.NewProfileCtx(ctx, p)
+				if errors.Is(err, configmgr.ErrTokenFileNotFound) {
+					fmt.Fprintf(os.Stderr, "No account configured for profile %q. Run CAPTUROO_CLI_ENDPOINT=%s capturoo account login to begin.\n", p.Name, p.Endpoint)
+					os.Exit(1)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			srcCode, dstCode := args[0], args[1]
+			srcBucketID, err := lookupBucketID(ctx, src, srcCode)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			dstBucketID, err := lookupBucketID(ctx, dst, dstCode)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if src.Endpoint == dst.Endpoint && srcBucketID == dstBucketID {
+				fmt.Fprintf(os.Stderr, "Source and destination buckets must differ.\n")
+				os.Exit(1)
+			}
+
+			if dryRun {
+				var n int
+				err := src.Client.ForEachLead(ctx, srcBucketID, func(lead *http.Lead) error {
+					n++
+					return nil
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to read leads: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Would copy %d leads from %s (%s) to %s (%s).\n", n, srcCode, src.Endpoint, dstCode, dst.Endpoint)
+				return
+			}
+
+			if checkpointFile == "" {
+				checkpointFile = checkpointFilename(src.Endpoint, srcCode, dst.Endpoint, dstCode)
+			}
+			cp, err := readCheckpoint(checkpointFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if cp == nil {
+				cp = &checkpoint{
+					Source:              srcCode,
+					SourceEndpoint:      src.Endpoint,
+					Destination:         dstCode,
+					DestinationEndpoint: dst.Endpoint,
+				}
+			} else if cp.Source != srcCode || cp.SourceEndpoint != src.Endpoint ||
+				cp.Destination != dstCode || cp.DestinationEndpoint != dst.Endpoint {
+				fmt.Fprintf(os.Stderr, "Checkpoint %q is for a copy from %s (%s) to %s (%s).\n", checkpointFile,
+					cp.Source, cp.SourceEndpoint, cp.Destination, cp.DestinationEndpoint)
+				os.Exit(1)
+			} else {
+				fmt.Fprintf(os.Stderr, "Resuming from checkpoint %q after %d leads.\n", checkpointFile, cp.Copied)
+			}
+
+			if err := copyLeads(ctx, src.Client, dst.Client, srcBucketID, dstBucketID, batchSize, cp, checkpointFile); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to copy leads: %v\n", err)
+				var cpErr *checkpointLeadError
+				switch {
+				case errors.As(err, &cpErr):
+					fmt.Fprintf(os.Stderr, "The copy cannot be resumed. Remove %q to copy every lead again; the %d leads already copied would be copied twice.\n", checkpointFile, cp.Copied)
+				case errors.Is(err, http.ErrLeadImportUnsupported):
+					// retrying cannot help
+				default:
+					fmt.Fprintf(os.Stderr, "Run the same command again to resume from the checkpoint.\n")
+				}
+				os.Exit(1)
+			}
+			if err := os.Remove(checkpointFile); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Copied %d leads from %s to %s.\n", cp.Copied, srcCode, dstCode)
+		},
+	}
+	cmd.Flags().StringVarP(&dstProfile, "dst-profile", "", "", "profile of the destination endpoint (defaults to the current endpoint)")
+	cmd.Flags().StringVarP(&checkpointFile, "checkpoint", "", "", "checkpoint file (defaults to copy-SRC_BUCKET-DST_BUCKET-HASH.checkpoint, HASH identifying the endpoints)")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "count the leads that would be copied without copying them")
+	cmd.Flags().IntVarP(&batchSize, "batch-size", "", 100, "number of leads imported per request")
+	return cmd
+}
+
+// copyLeads streams leads from the source bucket and imports them in
+// batches to the destination bucket, writing the checkpoint after each
+// batch. Leads up to and including cp.LastLeadID are skipped; if that lead
+// is no longer in the source bucket nothing is copied and a
+// *checkpointLeadError is returned.
+func copyLeads(ctx context.Context, src, dst *http.Client, srcBucketID, dstBucketID string, batchSize int, cp *checkpoint, filename string) error {
+	skip := cp.LastLeadID != ""
+	batch := make([]*http.Lead, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := dst.ImportLeads(ctx, dstBucketID, batch)
+		if err != nil {
+			return err
+		}
+		if n != len(batch) {
+			return fmt.Errorf("imported %d of a batch of %d leads", n, len(batch))
+		}
+		cp.LastLeadID = batch[len(batch)-1].LeadID
+		cp.Copied += len(batch)
+		batch = batch[:0]
+		if err := writeCheckpoint(filename, cp); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Copied %d leads.\n", cp.Copied)
+		return nil
+	}
+
+	err := src.ForEachLead(ctx, srcBucketID, func(lead *http.Lead) error {
+		if skip {
+			if lead.LeadID == cp.LastLeadID {
+				skip = false
+			}
+			return nil
+		}
+		batch = append(batch, lead)
+		if len(batch) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	if skip {
+		return &checkpointLeadError{leadID: cp.LastLeadID}
+	}
+	return flush()
+}
+
+func lookupBucketID(ctx context.Context, a *app.Ctx, bucketCode string) (string, error) {
+	buckets, err := a.Client.GetBuckets(ctx, a.JWTData.CapAID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list buckets: %w", err)
+	}
+	for _, b := range buckets {
+		if b.BucketCode == bucketCode {
+			return b.BucketID, nil
+		}
+	}
+	return "", fmt.Errorf("bucket with code %q not found on %s", bucketCode, a.Endpoint)
+}
+
+// readCheckpoint reads the checkpoint file or returns nil if the file
+// does not exist.
+func readCheckpoint(filename string) (*checkpoint, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cp checkpoint
+	if err := json.NewDecoder(f).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %q: %w", filename, err)
+	}
+	return &cp, nil
+}
+
+func writeCheckpoint(filename string, cp *checkpoint) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create checkpoint %q: %w", filename, err)
+	}
+	if err := json.NewEncoder(f).Encode(cp); err != nil {
+		f.Close()
+		return fmt.Errorf("json encode checkpoint: %w", err)
+	}
+	return f.Close()
+}
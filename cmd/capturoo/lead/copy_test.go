@@ -0,0 +1,211 @@
+package lead
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"capturoo-cli-tool-go/emulator"
+	capturoo "capturoo-cli-tool-go/http"
+)
+
+// copyServer is an emulator counting lead imports, and failing them to
+// import anything when short is set. With noImport it behaves like an API
+// without the lead import route.
+type copyServer struct {
+	srv      *emulator.Server
+	client   *capturoo.Client
+	imports  int32
+	short    bool
+	noImport bool
+}
+
+func newCopyServer(t *testing.T) *copyServer {
+	t.Helper()
+	srv, err := emulator.NewServer(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &copyServer{srv: srv}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/leads/import" {
+			atomic.AddInt32(&cs.imports, 1)
+			if cs.noImport {
+				http.NotFound(w, r)
+				return
+			}
+			if cs.short {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, `{"object":"import","imported":0}`)
+				return
+			}
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	cs.client = capturoo.NewClient(ts.URL)
+	cs.client.JWT = srv.IDToken()
+	return cs
+}
+
+// bucket creates a bucket holding n leads returning its ID.
+func (cs *copyServer) bucket(t *testing.T, code string, n int) string {
+	t.Helper()
+	ctx := context.Background()
+	b, err := cs.client.CreateBucket(ctx, cs.srv.Account().AccountID, code, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var leads []*capturoo.Lead
+	for i := 1; i <= n; i++ {
+		leads = append(leads, &capturoo.Lead{LeadID: fmt.Sprintf("lead%d", i)})
+	}
+	if n > 0 {
+		if _, err := cs.client.ImportLeads(ctx, b.BucketID, leads); err != nil {
+			t.Fatal(err)
+		}
+	}
+	atomic.StoreInt32(&cs.imports, 0)
+	return b.BucketID
+}
+
+func (cs *copyServer) leadIDs(t *testing.T, bucketID string) []string {
+	t.Helper()
+	var ids []string
+	err := cs.client.ForEachLead(context.Background(), bucketID, func(l *capturoo.Lead) error {
+		ids = append(ids, l.LeadID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestCopyLeads(t *testing.T) {
+	tests := []struct {
+		name     string
+		last     string
+		copied   int
+		want     []string
+		imports  int32
+		wantCopy int
+	}{
+		{"batches", "", 0, []string{"lead1", "lead2", "lead3", "lead4", "lead5"}, 3, 5},
+		{"resume", "lead2", 2, []string{"lead3", "lead4", "lead5"}, 2, 5},
+		{"resume at end", "lead5", 5, nil, 0, 5},
+	}
+	for _, tc := range tests {
+		cs := newCopyServer(t)
+		src := cs.bucket(t, "src", 5)
+		dst := cs.bucket(t, "dst", 0)
+		filename := filepath.Join(t.TempDir(), "copy.checkpoint")
+
+		cp := &checkpoint{LastLeadID: tc.last, Copied: tc.copied}
+		if err := copyLeads(context.Background(), cs.client, cs.client, src, dst, 2, cp, filename); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := cs.leadIDs(t, dst); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: copied leads incorrect, got: %v, want: %v", tc.name, got, tc.want)
+		}
+		if cs.imports != tc.imports {
+			t.Errorf("%s: imports incorrect, got: %d, want: %d", tc.name, cs.imports, tc.imports)
+		}
+		if cp.Copied != tc.wantCopy || (tc.imports > 0 && cp.LastLeadID != "lead5") {
+			t.Errorf("%s: checkpoint incorrect, got: %+v", tc.name, cp)
+		}
+		if tc.imports > 0 {
+			saved, err := readCheckpoint(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *saved != *cp {
+				t.Errorf("%s: saved checkpoint incorrect, got: %+v, want: %+v", tc.name, saved, cp)
+			}
+		}
+	}
+}
+
+func TestCopyLeadsCheckpointNotFound(t *testing.T) {
+	cs := newCopyServer(t)
+	src := cs.bucket(t, "src", 3)
+	dst := cs.bucket(t, "dst", 0)
+
+	filename := filepath.Join(t.TempDir(), "copy.checkpoint")
+	cp := &checkpoint{LastLeadID: "gone", Copied: 2}
+	err := copyLeads(context.Background(), cs.client, cs.client, src, dst, 2, cp, filename)
+	var cpErr *checkpointLeadError
+	if !errors.As(err, &cpErr) || !strings.Contains(err.Error(), `checkpoint lead "gone" not found`) {
+		t.Errorf("copyLeads error incorrect, got: %v, want checkpoint lead not found", err)
+	}
+	if ids := cs.leadIDs(t, dst); len(ids) != 0 {
+		t.Errorf("copyLeads copied %v", ids)
+	}
+	if cs.imports != 0 {
+		t.Errorf("copyLeads imported %d batches", cs.imports)
+	}
+	if saved, err := readCheckpoint(filename); err != nil || saved != nil {
+		t.Errorf("checkpoint written for a missing checkpoint lead: %+v, %v", saved, err)
+	}
+}
+
+func TestCopyLeadsImportUnsupported(t *testing.T) {
+	cs := newCopyServer(t)
+	src := cs.bucket(t, "src", 3)
+	dst := cs.bucket(t, "dst", 0)
+	cs.noImport = true
+
+	filename := filepath.Join(t.TempDir(), "copy.checkpoint")
+	cp := &checkpoint{}
+	err := copyLeads(context.Background(), cs.client, cs.client, src, dst, 2, cp, filename)
+	if !errors.Is(err, capturoo.ErrLeadImportUnsupported) {
+		t.Errorf("copyLeads error incorrect, got: %v, want: %v", err, capturoo.ErrLeadImportUnsupported)
+	}
+	if cs.imports != 1 {
+		t.Errorf("copyLeads tried %d imports, want: 1", cs.imports)
+	}
+	if cp.Copied != 0 || cp.LastLeadID != "" {
+		t.Errorf("checkpoint advanced without the import route: %+v", cp)
+	}
+	if saved, err := readCheckpoint(filename); err != nil || saved != nil {
+		t.Errorf("checkpoint written without the import route: %+v, %v", saved, err)
+	}
+}
+
+func TestCopyLeadsShortImport(t *testing.T) {
+	cs := newCopyServer(t)
+	src := cs.bucket(t, "src", 3)
+	dst := cs.bucket(t, "dst", 0)
+	cs.short = true
+
+	filename := filepath.Join(t.TempDir(), "copy.checkpoint")
+	cp := &checkpoint{}
+	err := copyLeads(context.Background(), cs.client, cs.client, src, dst, 2, cp, filename)
+	if err == nil || !strings.Contains(err.Error(), "imported 0 of a batch of 2") {
+		t.Errorf("copyLeads error incorrect, got: %v, want short import", err)
+	}
+	if cp.Copied != 0 || cp.LastLeadID != "" {
+		t.Errorf("checkpoint advanced after a short import: %+v", cp)
+	}
+	if saved, err := readCheckpoint(filename); err != nil || saved != nil {
+		t.Errorf("checkpoint written after a short import: %+v, %v", saved, err)
+	}
+}
+
+func TestCheckpointFilename(t *testing.T) {
+	a := checkpointFilename("https://api.capturoo.com", "src", "https://api.capturoo.com", "dst")
+	b := checkpointFilename("https://api.capturoo.com", "src", "https://api-staging.capturoo.com", "dst")
+	if a == b {
+		t.Errorf("checkpointFilename is the same for different endpoints: %q", a)
+	}
+	if !strings.HasPrefix(a, "copy-src-dst-") {
+		t.Errorf("checkpointFilename incorrect, got: %q", a)
+	}
+}
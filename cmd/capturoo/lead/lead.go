@@ -2,8 +2,11 @@ package lead
 
 import (
 	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -16,23 +19,65 @@ func NewCmdLead() *cobra.Command {
 		Aliases: []string{"leads"},
 		Short:   "Manage leads",
 	}
+	cmd.AddCommand(NewCmdLeadCopy())
 	cmd.AddCommand(NewCmdLeadExport())
+	cmd.AddCommand(NewCmdLeadQuery())
 	return cmd
 }
 
 // NewCmdLeadExport returns an instance of the lead export sub command.
 func NewCmdLeadExport() *cobra.Command {
 	var format, output string
+	var rowTemplate, headerTemplate, footerTemplate string
+	var mappingFile string
 	cmd := &cobra.Command{
-		Use:   "export BUCKET_CODE",
+		Use:   "export BUCKET_CODE [-f FORMAT] [-o FILE]",
 		Short: "Export leads from a bucket",
+		Long: `Export leads from a bucket as json, yaml, template, vcard, hubspot-csv or
+salesforce-csv.
+
+The vcard, hubspot-csv and salesforce-csv formats map Lead.Data keys to the
+headers expected by the CRM. The defaults expect the keys email, firstName,
+lastName, phone, company, jobTitle, city and country. Use --mapping to
+override them with a YAML file keyed by format:
+
+  hubspot-csv:
+    - header: Email
+      field: email_address      # a Lead.Data key
+    - header: Create Date
+      field: system.created     # or leadId, data.KEY, tracking.KEY, system.NAME
+    - header: Lifecycle Stage
+      value: lead               # a constant
+
+The vcard format uses vCard property names as headers such as EMAIL, TEL,
+ORG and TITLE, with N.given and N.family making up the name.
+
+The template format executes a Go text/template for each lead, with the
+Lead as its data e.g. {{.LeadID}}, {{.Data.email}} or {{.System.Created}}.
+An optional header template is executed before the first lead and an
+optional footer template after the last with {{.Count}} set.
+
+Template functions:
+  date LAYOUT VALUE   format a time e.g. {{date "2006-01-02" .System.Created}}
+  default DEF VALUE   use DEF when VALUE is empty e.g. {{default "n/a" .Data.phone}}
+  json, csv, sql,     escape a value for JSON, a CSV field, a SQL string
+  xml, vcard          literal, XML text or a vCard property value
+  lower, upper, trim  string helpers
+  now                 the current time`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New("missing BUCKET_CODE argument")
 			}
 
-			if format != "json" && format != "yaml" {
-				return errors.New("format must be either json or yaml")
+			switch format {
+			case "json", "yaml":
+			case "vcard", "hubspot-csv", "salesforce-csv":
+			case "template":
+				if rowTemplate == "" {
+					return errors.New("set the row template file using --template")
+				}
+			default:
+				return errors.New("format must be one of json, yaml, template, vcard, hubspot-csv or salesforce-csv")
 			}
 
 			return nil
@@ -65,30 +110,126 @@ func NewCmdLeadExport() *cobra.Command {
 				os.Exit(1)
 			}
 
-			var f *os.File
-			f = os.Stdout
-			if output != "" {
-				f, err = os.Create(output)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "%v\n", err)
-					os.Exit(1)
-				}
-				defer func() {
-					if err := f.Close(); err != nil {
-						fmt.Fprintf(os.Stderr, "%v\n", err)
-						os.Exit(1)
-					}
-				}()
+			out, err := createOutput(output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
 			}
+			f := out.File
 
-			if err := app.Client.WriteLeads(ctx, format, f, bucketCodeMap[bucketCode]); err != nil {
+			var enc http.LeadEncoder
+			if format == "template" {
+				enc, err = newTemplateEncoder(f, rowTemplate, headerTemplate, footerTemplate)
+			} else if mappingFile != "" {
+				enc, err = newMappedEncoder(f, format, mappingFile)
+			} else {
+				enc, err = http.NewLeadEncoder(format, f)
+			}
+			if err != nil {
+				out.finish(err)
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			err = app.Client.EncodeLeads(ctx, enc, bucketCodeMap[bucketCode])
+			if err := out.finish(err); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to output leads: %v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
 
-	cmd.Flags().StringVarP(&format, "format", "f", "json", "export format json or yaml")
+	cmd.Flags().StringVarP(&format, "format", "f", "json", "export format json, yaml, template, vcard, hubspot-csv or salesforce-csv")
 	cmd.Flags().StringVarP(&output, "output", "o", "", "output to file")
+	cmd.Flags().StringVarP(&rowTemplate, "template", "", "", "template file executed for each lead (used with --format template)")
+	cmd.Flags().StringVarP(&headerTemplate, "header", "", "", "template file executed before the first lead")
+	cmd.Flags().StringVarP(&footerTemplate, "footer", "", "", "template file executed after the last lead")
+	cmd.Flags().StringVarP(&mappingFile, "mapping", "m", "", "YAML file mapping lead fields to CRM headers")
 	return cmd
 }
+
+// outputFile is the destination of an export, either stdout or a file. A file
+// is written alongside the output as FILE.partial and only renamed once
+// the export succeeds, so a failed or interrupted export never leaves a
+// partial file behind.
+type outputFile struct {
+	*os.File
+	name string
+}
+
+// createOutput returns the output for the filename or stdout if it is
+// empty.
+func createOutput(filename string) (*outputFile, error) {
+	if filename == "" {
+		return &outputFile{File: os.Stdout}, nil
+	}
+	f, err := os.Create(filename + ".partial")
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{File: f, name: filename}, nil
+}
+
+// finish completes the output if err is nil, otherwise it removes the
+// partial file and returns err.
+func (o *outputFile) finish(err error) error {
+	if o.name == "" {
+		return err
+	}
+	if cerr := o.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(o.File.Name())
+		return err
+	}
+	return os.Rename(o.File.Name(), o.name)
+}
+
+// newMappedEncoder reads the mapping file and returns a CRM lead encoder
+// for format writing to w.
+func newMappedEncoder(w io.Writer, format, mappingFile string) (http.LeadEncoder, error) {
+	mf, err := os.Open(mappingFile)
+	if err != nil {
+		return nil, err
+	}
+	defer mf.Close()
+
+	mappings, err := http.ReadFieldMappings(mf)
+	if err != nil {
+		return nil, fmt.Errorf("mapping file %q: %w", mappingFile, err)
+	}
+	return http.NewMappedLeadEncoder(format, w, mappings[format])
+}
+
+// newTemplateEncoder reads the row and optional header and footer
+// template files and returns a template lead encoder writing to w.
+func newTemplateEncoder(w io.Writer, rowFile, headerFile, footerFile string) (http.LeadEncoder, error) {
+	read := func(filename string) (string, error) {
+		if filename == "" {
+			return "", nil
+		}
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	row, err := read(rowFile)
+	if err != nil {
+		return nil, err
+	}
+	header, err := read(headerFile)
+	if err != nil {
+		return nil, err
+	}
+	footer, err := read(footerFile)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := http.NewTemplateLeadEncoder(w, row, header, footer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return enc, nil
+}
@@ -0,0 +1,109 @@
+package lead
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/query"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdLeadQuery returns an instance of the lead query sub command.
+func NewCmdLeadQuery() *cobra.Command {
+	var output string
+	var raw bool
+	var q *query.Query
+
+	cmd := &cobra.Command{
+		Use:   "query BUCKET_CODE EXPRESSION [-r] [-o FILE]",
+		Short: "Filter and reshape leads using a jq-like expression",
+		Long: `Filter and reshape leads using a jq-like expression evaluated against each
+lead as it is streamed from the API. Each result is written as a single
+line of JSON.
+
+Example:
+  capturoo lead query my-bucket 'select(.data.country=="UK") | {email: .data.email}'
+
+Supported syntax:
+  .  .field  ."field"  .[n]  .["field"]  .[]
+  f | g   f, g   f // g
+  == != < <= > >=   and  or   + -
+  {key: f, key}  [f]
+  select(f) not empty length keys has(k) contains(s) startswith(s)
+  endswith(s) test(re) ascii_downcase ascii_upcase tostring tonumber`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing BUCKET_CODE argument")
+			}
+			if len(args) < 2 {
+				return errors.New("missing EXPRESSION argument")
+			}
+			if len(args) > 2 {
+				return errors.New("query accepts two arguments; quote the EXPRESSION")
+			}
+			var err error
+			q, err = query.Parse(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid expression: %w", err)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			bucketID, err := lookupBucketID(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			out, err := createOutput(output)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			w := bufio.NewWriter(out)
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+
+			err = app.Client.ForEachLead(ctx, bucketID, func(lead *http.Lead) error {
+				results, err := q.RunValue(lead)
+				if err != nil {
+					return fmt.Errorf("lead %s: %w", lead.LeadID, err)
+				}
+				for _, r := range results {
+					if s, ok := r.(string); ok && raw {
+						fmt.Fprintln(w, s)
+						continue
+					}
+					if err := enc.Encode(r); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if ferr := w.Flush(); ferr != nil && err == nil {
+				err = ferr
+			}
+			if err := out.finish(err); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to query leads: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&raw, "raw-output", "r", false, "write string results without JSON quotes")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output to file")
+	return cmd
+}
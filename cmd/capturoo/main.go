@@ -4,18 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/url"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"capturoo-cli-tool-go/cmd/capturoo/account"
 	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/cmd/capturoo/backup"
 	"capturoo-cli-tool-go/cmd/capturoo/bucket"
 	"capturoo-cli-tool-go/cmd/capturoo/configmgr"
+	"capturoo-cli-tool-go/cmd/capturoo/dev"
 	"capturoo-cli-tool-go/cmd/capturoo/lead"
+	"capturoo-cli-tool-go/cmd/capturoo/manifest"
+	"capturoo-cli-tool-go/cmd/capturoo/notify"
 	"capturoo-cli-tool-go/cmd/capturoo/token"
 	"capturoo-cli-tool-go/cmd/capturoo/webhook"
-	"capturoo-cli-tool-go/fbauth"
 	"capturoo-cli-tool-go/http"
 
 	"github.com/spf13/cobra"
@@ -24,6 +28,9 @@ import (
 var version string
 var endpoint string
 var gitCommit string
+var stats bool
+var debug, debugBody bool
+var traceFile string
 
 func main() {
 	overrideEndpoint, found := os.LookupEnv("CAPTUROO_CLI_ENDPOINT")
@@ -31,7 +38,7 @@ func main() {
 		// TODO: sanitise the endpoint URL
 		endpoint = overrideEndpoint
 	}
-	tokenFilename, err := urlToHostName(endpoint)
+	tokenFilename, err := configmgr.TokenFilename(endpoint)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%+v\n", err)
 		os.Exit(1)
@@ -58,57 +65,84 @@ func main() {
 			}
 			app := v.(*app.Ctx)
 
-			tart, err := configmgr.ReadTokenAndRefreshToken(app.TokenFilename)
+			err := app.SignIn(ctx)
 			if errors.Is(err, configmgr.ErrTokenFileNotFound) {
 				fmt.Fprintf(os.Stderr, "No account configured. Run capturoo account login to begin.\n")
 				os.Exit(1)
-			} else if errors.Is(err, configmgr.ErrTokenExpired) {
-				// If the current token has expired, exchange the refresh token
-				// for a new one.
-				autoconf, err := app.Client.AutoConf(ctx)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to auto configure via the endpoint %v.\n", err)
-					os.Exit(1)
-				}
-				auth := fbauth.NewRESTClient()
-				tart, err = auth.ExchangeRefreshTokenForIDToken(autoconf.Data.FirebaseConfig.APIKey, tart.RefreshToken)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Exchange Refresh Token for ID Token failed: %+v\n", err)
-					os.Exit(1)
-				}
-				if err := configmgr.WriteTokenAndRefreshToken(app.TokenFilename, tart); err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to write new token: %+v\n", err)
-					os.Exit(1)
-				}
 			} else if err != nil {
 				fmt.Fprintf(os.Stderr, "%+v\n", err)
 				os.Exit(1)
 			}
-
-			app.Client.JWT = tart.IDToken
-			app.TART = tart
-
-			app.JWTData, err = configmgr.ParseJWT(tart.IDToken)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to parse JWT: %+v\n", err)
-				os.Exit(1)
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if stats {
+				printStats(appv.Client.Limiter.Stats())
 			}
 		},
 	}
+	root.PersistentFlags().DurationVar(&appv.Client.Timeout, "timeout", http.DefaultTimeout, "time limit for each API request, 0 for none")
+	root.PersistentFlags().IntVar(&appv.Client.Retry.Retries, "retries", http.DefaultRetryPolicy.Retries, "times to retry an API request that fails with a transient error")
+	root.PersistentFlags().DurationVar(&appv.Client.Retry.Backoff, "retry-backoff", http.DefaultRetryPolicy.Backoff, "wait before the first retry, doubled for each further retry")
+	root.PersistentFlags().Var(&appv.Client.Limiter.Rate, "rate", "maximum rate of API requests such as 10/s or 600/m")
+	root.PersistentFlags().IntVar(&appv.Client.Limiter.Concurrency, "concurrency", 0, "maximum number of API requests in flight, 0 for no limit")
+	root.PersistentFlags().BoolVar(&stats, "stats", false, "print API request statistics to stderr on completion")
+	env := os.Getenv("CAPTUROO_DEBUG")
+	root.PersistentFlags().BoolVar(&debug, "debug", env != "" && env != "0", "log API requests and responses to stderr (or set CAPTUROO_DEBUG=1)")
+	root.PersistentFlags().BoolVar(&debugBody, "debug-body", env == "body", "also log request and response bodies (or set CAPTUROO_DEBUG=body)")
+	root.PersistentFlags().StringVar(&traceFile, "trace-file", "", "record API requests and responses in a HAR file")
+	cobra.OnInitialize(func() {
+		if !debug && !debugBody && traceFile == "" {
+			return
+		}
+		t := &http.Tracer{Bodies: debugBody, HARFile: traceFile, Version: version}
+		if debug || debugBody {
+			t.Log = os.Stderr
+		}
+		appv.Client.Trace = t
+	})
 	root.AddCommand(account.NewCmdAccount())
+	root.AddCommand(manifest.NewCmdApply())
+	root.AddCommand(backup.NewCmdBackup())
 	root.AddCommand(bucket.NewCmdBucket())
+	root.AddCommand(dev.NewCmdDev())
 	root.AddCommand(lead.NewCmdLead())
+	root.AddCommand(notify.NewCmdNotify())
+	root.AddCommand(manifest.NewCmdPlan())
+	root.AddCommand(backup.NewCmdRestore())
 	root.AddCommand(token.NewCmdToken())
 	root.AddCommand(NewCmdVersion())
 	root.AddCommand(webhook.NewCmdWebhook())
 
-	ctx := context.WithValue(context.Background(), app.ApplicationKey("appk"), appv)
-	if err := root.ExecuteContext(ctx); err != nil {
+	// Ctrl-C or SIGTERM cancels the context so that commands can stop
+	// cleanly. A second signal exits immediately.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		cancel()
+	}()
+
+	ctx = context.WithValue(ctx, app.ApplicationKey("appk"), appv)
+	err = root.ExecuteContext(ctx)
+	appv.Client.Trace.Close()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "%+v\n", err)
 		os.Exit(1)
 	}
 }
 
+// printStats writes the request statistics of the client to stderr.
+func printStats(s http.LimiterStats) {
+	fmt.Fprintf(os.Stderr, "API requests: %d, throttled: %d, max in flight: %d, waited: %s", s.Requests, s.Throttled, s.MaxInFlight, s.Waited.Round(time.Millisecond))
+	if s.Rate.N > 0 {
+		fmt.Fprintf(os.Stderr, ", rate: %s", s.Rate)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
 // NewCmdVersion returns an instance of the version sub command.
 func NewCmdVersion() *cobra.Command {
 	return &cobra.Command{
@@ -122,19 +156,3 @@ func NewCmdVersion() *cobra.Command {
 		},
 	}
 }
-
-// urlToHostName converts a standard URL string to hostname replacing
-// the dot character with underscores.
-func urlToHostName(u string) (string, error) {
-	url, err := url.Parse(u)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse url %q: %w", u, err)
-	}
-
-	port := url.Port()
-	var suffix string
-	if port != "" {
-		suffix = "_" + port
-	}
-	return strings.ReplaceAll(url.Hostname()+suffix, ".", "_"), nil
-}
@@ -0,0 +1,154 @@
+package manifest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdApply returns an instance of the apply command.
+func NewCmdApply() *cobra.Command {
+	var filename string
+	var prune, dryRun, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "apply -f capturoo.yaml [--prune] [--dry-run] [--yes]",
+		Short: "Converge buckets and webhooks on a manifest",
+		Long: `Compare the buckets and webhooks declared in a YAML manifest to those in the
+account, show the plan, then create and update resources to match it.
+Resources not declared in the manifest are only deleted with --prune.
+
+Example manifest:
+
+  buckets:
+    - code: summer-campaign
+      name: Summer Campaign
+  webhooks:
+    - code: crm-sync
+      url: https://example.com/hooks/capturoo
+      events:
+        - bucket.created
+        - lead.created:summer-campaign
+      enabled: true
+      transform:
+        file: crm-sync.jq       # or language and inline source`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("apply accepts no arguments; use -f FILE")
+			}
+			if filename == "" {
+				return errors.New("set the manifest file using -f FILE")
+			}
+			if filename == "-" && !yes && !dryRun {
+				// the manifest uses up stdin, leaving nothing to read the
+				// confirmation from
+				return errors.New("-f - reads the manifest from stdin so the changes cannot be confirmed; add --yes or --dry-run")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			m, err := ReadFile(filename)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			plan, err := fetchPlan(ctx, app.Client, app.JWTData.CapAID, m, prune)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			plan.WriteText(os.Stdout)
+			if dryRun || !plan.HasChanges() {
+				return
+			}
+
+			if !yes {
+				ok, err := confirm("\nApply these changes? [y/N] ")
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				if !ok {
+					fmt.Println("Apply cancelled.")
+					return
+				}
+			}
+
+			if err := Apply(ctx, app.Client, app.JWTData.CapAID, plan); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Apply complete. %d created, %d updated, %d deleted.\n",
+				plan.Count(ActionCreate), plan.Count(ActionUpdate), plan.Count(ActionDelete))
+		},
+	}
+	cmd.Flags().StringVarP(&filename, "filename", "f", "", "manifest file or - for stdin")
+	cmd.Flags().BoolVarP(&prune, "prune", "", false, "delete buckets and webhooks not declared in the manifest")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "show the plan without making changes")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "apply without asking for confirmation")
+	return cmd
+}
+
+// Apply executes the changes of the plan in order, stopping at the first
+// failure.
+func Apply(ctx context.Context, client *http.Client, accountID string, plan *Plan) error {
+	for _, c := range plan.Changes {
+		var err error
+		switch {
+		case c.Kind == "bucket" && c.Action == ActionCreate:
+			_, err = client.CreateBucket(ctx, accountID, c.bucket.Code, c.bucket.Name)
+		case c.Kind == "bucket" && c.Action == ActionUpdate:
+			_, err = client.UpdateBucket(ctx, c.resourceID, c.bucket.Name)
+		case c.Kind == "bucket" && c.Action == ActionDelete:
+			err = client.DeleteBucket(ctx, c.resourceID)
+		case c.Kind == "webhook" && c.Action == ActionCreate:
+			_, err = client.CreateWebhook(ctx, accountID, c.webhook.Code, c.webhook.URL, c.webhook.Events, c.webhook.IsEnabled(), c.webhook.webhookTransform())
+		case c.Kind == "webhook" && c.Action == ActionUpdate:
+			enabled := c.webhook.IsEnabled()
+			params := http.UpdateParamSet{
+				Events:    &c.webhook.Events,
+				URL:       &c.webhook.URL,
+				Enabled:   &enabled,
+				Transform: &http.WebhookTransform{},
+			}
+			if tr := c.webhook.webhookTransform(); tr != nil {
+				params.Transform = tr
+			}
+			_, err = client.UpdateWebhook(ctx, c.resourceID, &params)
+		case c.Kind == "webhook" && c.Action == ActionDelete:
+			err = client.DeleteWebhook(ctx, c.resourceID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s %s %q: %w", c.Action, c.Kind, c.Code, err)
+		}
+		fmt.Printf("%s %s: %sd\n", c.Kind, c.Code, c.Action)
+	}
+	return nil
+}
+
+func confirm(prompt string) (bool, error) {
+	fmt.Print(prompt)
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false, scanner.Err()
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes", nil
+}
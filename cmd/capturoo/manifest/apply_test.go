@@ -0,0 +1,25 @@
+package manifest
+
+import "testing"
+
+func TestApplyArgs(t *testing.T) {
+	tests := []struct {
+		flags   []string
+		wantErr bool
+	}{
+		{[]string{"-f", "capturoo.yaml"}, false},
+		{[]string{"-f", "-"}, true},
+		{[]string{"-f", "-", "--yes"}, false},
+		{[]string{"-f", "-", "--dry-run"}, false},
+		{nil, true},
+	}
+	for _, tc := range tests {
+		cmd := NewCmdApply()
+		if err := cmd.ParseFlags(tc.flags); err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Args(cmd, nil); (err != nil) != tc.wantErr {
+			t.Errorf("apply %v: error incorrect, got: %v, want error: %t", tc.flags, err, tc.wantErr)
+		}
+	}
+}
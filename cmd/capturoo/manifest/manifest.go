@@ -0,0 +1,203 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/webhook/transform"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest describes the desired buckets and webhooks of an account.
+//
+//	buckets:
+//	  - code: summer-campaign
+//	    name: Summer Campaign
+//	webhooks:
+//	  - code: crm-sync
+//	    url: https://example.com/hooks/capturoo
+//	    events:
+//	      - bucket.created
+//	      - lead.created:summer-campaign
+//	    enabled: true
+//	    transform:
+//	      file: crm-sync.jq
+type Manifest struct {
+	Buckets  []*Bucket  `yaml:"buckets"`
+	Webhooks []*Webhook `yaml:"webhooks"`
+}
+
+// Bucket is the desired state of a bucket.
+type Bucket struct {
+	Code string `yaml:"code"`
+	Name string `yaml:"name"`
+}
+
+// Webhook is the desired state of a webhook. Enabled defaults to true
+// when omitted.
+type Webhook struct {
+	Code      string     `yaml:"code"`
+	URL       string     `yaml:"url"`
+	Events    []string   `yaml:"events"`
+	Enabled   *bool      `yaml:"enabled,omitempty"`
+	Transform *Transform `yaml:"transform,omitempty"`
+}
+
+// Transform is the payload transform of a webhook given either as a file,
+// relative to the manifest, or as inline source. The language of a file
+// follows its extension as for webhook create --transform, and inline
+// source defaults to a Go template. A webhook without a transform delivers
+// events unchanged.
+type Transform struct {
+	File     string `yaml:"file,omitempty"`
+	Language string `yaml:"language,omitempty"`
+	Source   string `yaml:"source,omitempty"`
+}
+
+// webhookTransform returns the transform of the webhook for the API or
+// nil if there is none.
+func (w *Webhook) webhookTransform() *http.WebhookTransform {
+	if w.Transform == nil {
+		return nil
+	}
+	return &http.WebhookTransform{Language: w.Transform.Language, Source: w.Transform.Source}
+}
+
+// IsEnabled reports whether the webhook should be enabled.
+func (w *Webhook) IsEnabled() bool {
+	return w.Enabled == nil || *w.Enabled
+}
+
+// ReadFile reads and validates the manifest file. A filename of "-"
+// reads from stdin.
+func ReadFile(filename string) (*Manifest, error) {
+	var r io.Reader
+	if filename == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var m Manifest
+	dec := yaml.NewDecoder(r)
+	dec.SetStrict(true)
+	if err := dec.Decode(&m); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode %q: %w", filename, err)
+	}
+	dir := "."
+	if filename != "-" {
+		dir = filepath.Dir(filename)
+	}
+	if err := m.readTransforms(dir); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &m, nil
+}
+
+// readTransforms reads the transform files, relative to dir, into the
+// webhook transforms.
+func (m *Manifest) readTransforms(dir string) error {
+	for _, w := range m.Webhooks {
+		if w == nil || w.Transform == nil || w.Transform.File == "" {
+			continue
+		}
+		t := w.Transform
+		if t.Source != "" {
+			return fmt.Errorf("webhook %q transform sets both file and source", w.Code)
+		}
+		name := t.File
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("webhook %q transform: %w", w.Code, err)
+		}
+		t.Source = string(b)
+		if t.Language == "" {
+			t.Language = transform.LanguageForFile(name)
+		}
+	}
+	return nil
+}
+
+// Validate checks the manifest for missing fields and duplicate codes.
+func (m *Manifest) Validate() error {
+	bucketCodes := make(map[string]bool)
+	for i, b := range m.Buckets {
+		if b == nil || b.Code == "" {
+			return fmt.Errorf("buckets[%d] is missing a code", i)
+		}
+		if bucketCodes[b.Code] {
+			return fmt.Errorf("bucket %q is declared more than once", b.Code)
+		}
+		bucketCodes[b.Code] = true
+	}
+
+	webhookCodes := make(map[string]bool)
+	for i, w := range m.Webhooks {
+		if w == nil || w.Code == "" {
+			return fmt.Errorf("webhooks[%d] is missing a code", i)
+		}
+		if webhookCodes[w.Code] {
+			return fmt.Errorf("webhook %q is declared more than once", w.Code)
+		}
+		webhookCodes[w.Code] = true
+
+		u, err := url.ParseRequestURI(w.URL)
+		if err != nil {
+			return fmt.Errorf("webhook %q url: %w", w.Code, err)
+		}
+		if u.Scheme != "https" {
+			return fmt.Errorf("webhook %q url must use an https secure url", w.Code)
+		}
+		if len(w.Events) == 0 {
+			return fmt.Errorf("webhook %q has no events", w.Code)
+		}
+		if t := w.Transform; t != nil {
+			if t.Source == "" {
+				return fmt.Errorf("webhook %q transform has no file or source", w.Code)
+			}
+			if t.Language == "" {
+				t.Language = http.TransformTemplate
+			}
+			if _, err := transform.Parse(w.webhookTransform()); err != nil {
+				return fmt.Errorf("webhook %q transform: %w", w.Code, err)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeEvents returns a sorted copy of events with the resources of
+// each context driven event sorted so that lists may be compared.
+func normalizeEvents(events []string) []string {
+	result := make([]string, 0, len(events))
+	for _, e := range events {
+		parts := strings.SplitN(e, ":", 2)
+		if len(parts) == 2 {
+			resources := strings.Split(parts[1], "|")
+			sort.Strings(resources)
+			e = parts[0] + ":" + strings.Join(resources, "|")
+		}
+		result = append(result, e)
+	}
+	sort.Strings(result)
+	return result
+}
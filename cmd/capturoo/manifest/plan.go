@@ -0,0 +1,297 @@
+package manifest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"capturoo-cli-tool-go/http"
+)
+
+// Action is the change required to converge a resource.
+type Action string
+
+const (
+	// ActionCreate creates a resource declared in the manifest.
+	ActionCreate Action = "create"
+
+	// ActionUpdate updates a resource that differs from the manifest.
+	ActionUpdate Action = "update"
+
+	// ActionDelete deletes a resource not declared in the manifest.
+	ActionDelete Action = "delete"
+)
+
+// FieldDiff is a single field of a resource that differs.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Change is a planned change to a single bucket or webhook.
+type Change struct {
+	Action Action      `json:"action"`
+	Kind   string      `json:"kind"`
+	Code   string      `json:"code"`
+	Diffs  []FieldDiff `json:"diffs,omitempty"`
+
+	bucket     *Bucket
+	webhook    *Webhook
+	resourceID string
+}
+
+// Plan is the ordered list of changes needed to converge the live
+// account on the manifest. Unmanaged counts the live resources that are
+// not declared in the manifest when pruning is off.
+type Plan struct {
+	Changes   []*Change `json:"changes"`
+	Unmanaged int       `json:"unmanaged"`
+}
+
+// HasChanges reports whether the plan contains any changes.
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// Count returns the number of changes for the action.
+func (p *Plan) Count(action Action) int {
+	var n int
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// ComputePlan compares the manifest to the live buckets and webhooks.
+// Live resources missing from the manifest are deleted only if prune is
+// set. Changes are ordered so that buckets are created before the
+// webhooks that reference them and deleted after.
+func ComputePlan(m *Manifest, buckets []*http.Bucket, webhooks []*http.Webhook, prune bool) *Plan {
+	plan := &Plan{Changes: make([]*Change, 0)}
+
+	liveBuckets := make(map[string]*http.Bucket)
+	for _, b := range buckets {
+		liveBuckets[b.BucketCode] = b
+	}
+	liveWebhooks := make(map[string]*http.Webhook)
+	for _, w := range webhooks {
+		liveWebhooks[w.Code] = w
+	}
+
+	// bucket creates and updates
+	for _, b := range m.Buckets {
+		live, ok := liveBuckets[b.Code]
+		if !ok {
+			plan.Changes = append(plan.Changes, &Change{
+				Action: ActionCreate,
+				Kind:   "bucket",
+				Code:   b.Code,
+				Diffs:  []FieldDiff{{Field: "name", New: b.Name}},
+				bucket: b,
+			})
+			continue
+		}
+		if live.BucketName != b.Name {
+			plan.Changes = append(plan.Changes, &Change{
+				Action:     ActionUpdate,
+				Kind:       "bucket",
+				Code:       b.Code,
+				Diffs:      []FieldDiff{{Field: "name", Old: live.BucketName, New: b.Name}},
+				bucket:     b,
+				resourceID: live.BucketID,
+			})
+		}
+	}
+
+	// webhook creates and updates
+	for _, w := range m.Webhooks {
+		events := strings.Join(normalizeEvents(w.Events), ",")
+		enabled := enabledDisabled(w.IsEnabled())
+		live, ok := liveWebhooks[w.Code]
+		tr := describeTransform(w.webhookTransform())
+		if !ok {
+			diffs := []FieldDiff{
+				{Field: "url", New: w.URL},
+				{Field: "events", New: events},
+				{Field: "enabled", New: enabled},
+			}
+			if w.Transform != nil {
+				diffs = append(diffs, FieldDiff{Field: "transform", New: tr})
+			}
+			plan.Changes = append(plan.Changes, &Change{
+				Action:  ActionCreate,
+				Kind:    "webhook",
+				Code:    w.Code,
+				Diffs:   diffs,
+				webhook: w,
+			})
+			continue
+		}
+
+		var diffs []FieldDiff
+		if live.URL != w.URL {
+			diffs = append(diffs, FieldDiff{Field: "url", Old: live.URL, New: w.URL})
+		}
+		if liveEvents := strings.Join(normalizeEvents(live.Events), ","); liveEvents != events {
+			diffs = append(diffs, FieldDiff{Field: "events", Old: liveEvents, New: events})
+		}
+		if live.Enabled != w.IsEnabled() {
+			diffs = append(diffs, FieldDiff{Field: "enabled", Old: enabledDisabled(live.Enabled), New: enabled})
+		}
+		if liveTr := describeTransform(live.Transform); liveTr != tr {
+			diffs = append(diffs, FieldDiff{Field: "transform", Old: liveTr, New: tr})
+		}
+		if len(diffs) > 0 {
+			plan.Changes = append(plan.Changes, &Change{
+				Action:     ActionUpdate,
+				Kind:       "webhook",
+				Code:       w.Code,
+				Diffs:      diffs,
+				webhook:    w,
+				resourceID: live.WebhookID,
+			})
+		}
+	}
+
+	// webhook then bucket deletes
+	declaredWebhooks := make(map[string]bool)
+	for _, w := range m.Webhooks {
+		declaredWebhooks[w.Code] = true
+	}
+	declaredBuckets := make(map[string]bool)
+	for _, b := range m.Buckets {
+		declaredBuckets[b.Code] = true
+	}
+
+	var deletes []*Change
+	for _, w := range webhooks {
+		if declaredWebhooks[w.Code] {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged++
+			continue
+		}
+		deletes = append(deletes, &Change{
+			Action:     ActionDelete,
+			Kind:       "webhook",
+			Code:       w.Code,
+			resourceID: w.WebhookID,
+		})
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Code < deletes[j].Code })
+	plan.Changes = append(plan.Changes, deletes...)
+
+	deletes = nil
+	for _, b := range buckets {
+		if declaredBuckets[b.BucketCode] {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged++
+			continue
+		}
+		deletes = append(deletes, &Change{
+			Action:     ActionDelete,
+			Kind:       "bucket",
+			Code:       b.BucketCode,
+			resourceID: b.BucketID,
+		})
+	}
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Code < deletes[j].Code })
+	plan.Changes = append(plan.Changes, deletes...)
+
+	return plan
+}
+
+// fetchPlan retrieves the live buckets and webhooks for the account and
+// computes the plan against the manifest.
+func fetchPlan(ctx context.Context, client *http.Client, accountID string, m *Manifest, prune bool) (*Plan, error) {
+	buckets, err := client.GetBuckets(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get buckets: %w", err)
+	}
+	webhooks, err := client.GetWebhooks(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	return ComputePlan(m, buckets, webhooks, prune), nil
+}
+
+// WriteText writes the plan as a human readable diff.
+func (p *Plan) WriteText(w io.Writer) error {
+	symbols := map[Action]string{
+		ActionCreate: "+",
+		ActionUpdate: "~",
+		ActionDelete: "-",
+	}
+	for _, c := range p.Changes {
+		fmt.Fprintf(w, "%s %s %s\n", symbols[c.Action], c.Kind, c.Code)
+		for _, d := range c.Diffs {
+			switch c.Action {
+			case ActionCreate:
+				fmt.Fprintf(w, "    %s: %q\n", d.Field, d.New)
+			case ActionUpdate:
+				fmt.Fprintf(w, "    %s: %q -> %q\n", d.Field, d.Old, d.New)
+			}
+		}
+	}
+	if !p.HasChanges() {
+		fmt.Fprintf(w, "No changes. The account matches the manifest.\n")
+	} else {
+		fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete.\n",
+			p.Count(ActionCreate), p.Count(ActionUpdate), p.Count(ActionDelete))
+	}
+	if p.Unmanaged > 0 {
+		fmt.Fprintf(w, "%d live resources are not declared in the manifest (use --prune to delete them).\n", p.Unmanaged)
+	}
+	return nil
+}
+
+// WriteJSON writes the plan and a summary of the changes as JSON.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	out := struct {
+		*Plan
+		Drift   bool `json:"drift"`
+		Summary struct {
+			Create int `json:"create"`
+			Update int `json:"update"`
+			Delete int `json:"delete"`
+		} `json:"summary"`
+	}{
+		Plan:  p,
+		Drift: p.HasChanges(),
+	}
+	out.Summary.Create = p.Count(ActionCreate)
+	out.Summary.Update = p.Count(ActionUpdate)
+	out.Summary.Delete = p.Count(ActionDelete)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// describeTransform summarises a transform as its language and a hash of
+// its source, so that plans show when the source changes without printing
+// it.
+func describeTransform(t *http.WebhookTransform) string {
+	if t == nil || t.Source == "" {
+		return "none"
+	}
+	sum := sha256.Sum256([]byte(t.Source))
+	return fmt.Sprintf("%s sha256:%x", t.Language, sum[:6])
+}
+
+func enabledDisabled(t bool) string {
+	if t {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,234 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"capturoo-cli-tool-go/http"
+)
+
+func TestComputePlan(t *testing.T) {
+	disabled := false
+	m := &Manifest{
+		Buckets: []*Bucket{
+			{Code: "summer", Name: "Summer"},
+			{Code: "winter", Name: "Winter Campaign"},
+			{Code: "spring", Name: "Spring"},
+		},
+		Webhooks: []*Webhook{
+			{Code: "crm", URL: "https://example.com/crm", Events: []string{"lead.created:winter|summer"}},
+			{Code: "audit", URL: "https://example.com/audit", Events: []string{"bucket.created"}, Enabled: &disabled},
+		},
+	}
+	buckets := []*http.Bucket{
+		{BucketID: "b1", BucketCode: "summer", BucketName: "Summer"},
+		{BucketID: "b2", BucketCode: "winter", BucketName: "Winter"},
+		{BucketID: "b3", BucketCode: "autumn", BucketName: "Autumn"},
+	}
+	webhooks := []*http.Webhook{
+		{WebhookID: "w1", Code: "crm", URL: "https://example.com/crm", Events: []string{"lead.created:summer|winter"}, Enabled: true},
+		{WebhookID: "w2", Code: "legacy", URL: "https://example.com/legacy", Events: []string{"bucket.deleted"}, Enabled: true},
+	}
+
+	type change struct {
+		Action Action
+		Kind   string
+		Code   string
+	}
+	summarise := func(p *Plan) []change {
+		var result []change
+		for _, c := range p.Changes {
+			result = append(result, change{c.Action, c.Kind, c.Code})
+		}
+		return result
+	}
+
+	plan := ComputePlan(m, buckets, webhooks, false)
+	want := []change{
+		{ActionUpdate, "bucket", "winter"},
+		{ActionCreate, "bucket", "spring"},
+		{ActionCreate, "webhook", "audit"},
+	}
+	if got := summarise(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputePlan(prune=false) incorrect, got: %v, want: %v", got, want)
+	}
+	if plan.Unmanaged != 2 {
+		t.Errorf("plan.Unmanaged incorrect, got: %d, want: %d", plan.Unmanaged, 2)
+	}
+
+	plan = ComputePlan(m, buckets, webhooks, true)
+	want = append(want,
+		change{ActionDelete, "webhook", "legacy"},
+		change{ActionDelete, "bucket", "autumn"},
+	)
+	if got := summarise(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputePlan(prune=true) incorrect, got: %v, want: %v", got, want)
+	}
+	if plan.Unmanaged != 0 {
+		t.Errorf("plan.Unmanaged incorrect, got: %d, want: %d", plan.Unmanaged, 0)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Manifest
+	}{
+		{"missing bucket code", Manifest{Buckets: []*Bucket{{Name: "x"}}}},
+		{"duplicate bucket", Manifest{Buckets: []*Bucket{{Code: "a"}, {Code: "a"}}}},
+		{"insecure url", Manifest{Webhooks: []*Webhook{{Code: "a", URL: "http://example.com", Events: []string{"bucket.created"}}}}},
+		{"no events", Manifest{Webhooks: []*Webhook{{Code: "a", URL: "https://example.com"}}}},
+	}
+	for _, tc := range tests {
+		if err := tc.m.Validate(); err == nil {
+			t.Errorf("Validate() %s expected an error, got nil", tc.name)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestPlanWriteJSON(t *testing.T) {
+	m := &Manifest{
+		Buckets: []*Bucket{
+			{Code: "summer", Name: "Summer"},
+			{Code: "winter", Name: "Winter Campaign"},
+		},
+		Webhooks: []*Webhook{
+			{Code: "crm", URL: "https://example.com/crm", Events: []string{"lead.created:summer"}},
+		},
+	}
+	buckets := []*http.Bucket{
+		{BucketID: "b2", BucketCode: "winter", BucketName: "Winter"},
+		{BucketID: "b3", BucketCode: "autumn", BucketName: "Autumn"},
+	}
+
+	var buf bytes.Buffer
+	if err := ComputePlan(m, buckets, nil, true).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "plan.golden.json")
+	if *update {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(want) {
+		t.Errorf("WriteJSON incorrect, got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := ComputePlan(&Manifest{}, nil, nil, false).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var empty struct {
+		Drift   bool           `json:"drift"`
+		Summary map[string]int `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &empty); err != nil {
+		t.Fatal(err)
+	}
+	if empty.Drift || empty.Summary["create"]+empty.Summary["update"]+empty.Summary["delete"] != 0 {
+		t.Errorf("WriteJSON of an empty plan incorrect, got: %s", buf.String())
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	changes := ComputePlan(&Manifest{Buckets: []*Bucket{{Code: "summer", Name: "Summer"}}}, nil, nil, false)
+	none := ComputePlan(&Manifest{}, nil, nil, false)
+	tests := []struct {
+		plan     *Plan
+		detailed bool
+		want     int
+	}{
+		{changes, true, exitCodeChanges},
+		{none, true, 0},
+		{changes, false, 0},
+		{none, false, 0},
+	}
+	for i, tc := range tests {
+		if got := exitCode(tc.plan, tc.detailed); got != tc.want {
+			t.Errorf("%d: exitCode incorrect, got: %d, want: %d", i, got, tc.want)
+		}
+	}
+}
+
+func TestComputePlanTransform(t *testing.T) {
+	jq := &Transform{Language: http.TransformJQ, Source: "{email: .data.email}"}
+	m := &Manifest{
+		Webhooks: []*Webhook{
+			{Code: "crm", URL: "https://example.com/crm", Events: []string{"lead.created"}, Transform: jq},
+			{Code: "audit", URL: "https://example.com/audit", Events: []string{"lead.created"}},
+			{Code: "sync", URL: "https://example.com/sync", Events: []string{"lead.created"}, Transform: jq},
+			{Code: "new", URL: "https://example.com/new", Events: []string{"lead.created"}, Transform: jq},
+		},
+	}
+	live := func(id, code string, tr *http.WebhookTransform) *http.Webhook {
+		return &http.Webhook{WebhookID: id, Code: code, URL: "https://example.com/" + code, Events: []string{"lead.created"}, Enabled: true, Transform: tr}
+	}
+	webhooks := []*http.Webhook{
+		live("w1", "crm", &http.WebhookTransform{Language: http.TransformJQ, Source: "{email: .data.email, name: .data.name}"}),
+		live("w2", "audit", &http.WebhookTransform{Language: http.TransformJQ, Source: "."}),
+		live("w3", "sync", &http.WebhookTransform{Language: http.TransformJQ, Source: "{email: .data.email}"}),
+	}
+
+	got := map[string][]FieldDiff{}
+	for _, c := range ComputePlan(m, nil, webhooks, false).Changes {
+		got[c.Code] = c.Diffs
+	}
+	if len(got) != 3 {
+		t.Fatalf("ComputePlan changes incorrect, got: %v", got)
+	}
+	want := describeTransform(m.Webhooks[0].webhookTransform())
+	if d := got["crm"]; len(d) != 1 || d[0].Field != "transform" || d[0].New != want || d[0].Old == want {
+		t.Errorf("changed transform diff incorrect, got: %+v", d)
+	}
+	if d := got["audit"]; len(d) != 1 || d[0].Field != "transform" || d[0].New != "none" {
+		t.Errorf("removed transform diff incorrect, got: %+v", d)
+	}
+	if d := got["new"]; len(d) != 4 || d[3].Field != "transform" || d[3].New != want {
+		t.Errorf("created transform diff incorrect, got: %+v", d)
+	}
+}
+
+func TestReadFileTransform(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "crm.jq"), []byte("{email: .data.email}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `webhooks:
+  - code: crm
+    url: https://example.com/crm
+    events: [lead.created]
+    transform:
+      file: crm.jq
+  - code: audit
+    url: https://example.com/audit
+    events: [lead.created]
+    transform:
+      source: '{{.Data.email}}'
+`
+	filename := filepath.Join(dir, "capturoo.yaml")
+	if err := ioutil.WriteFile(filename, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr := m.Webhooks[0].Transform; tr.Language != http.TransformJQ || tr.Source != "{email: .data.email}\n" {
+		t.Errorf("file transform incorrect, got: %+v", tr)
+	}
+	if tr := m.Webhooks[1].Transform; tr.Language != http.TransformTemplate || tr.Source != "{{.Data.email}}" {
+		t.Errorf("inline transform incorrect, got: %+v", tr)
+	}
+}
@@ -0,0 +1,94 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+
+	"github.com/spf13/cobra"
+)
+
+// exitCodeChanges is returned by plan --detailed-exitcode when the account
+// has drifted from the manifest.
+const exitCodeChanges = 2
+
+// NewCmdPlan returns an instance of the plan command.
+func NewCmdPlan() *cobra.Command {
+	var filename, output string
+	var prune, detailedExitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "plan -f capturoo.yaml [--prune] [-o text|json] [--detailed-exitcode]",
+		Short: "Show the changes needed to converge on a manifest",
+		Long: `Compare the buckets and webhooks declared in a YAML manifest to those in the
+account and show the plan without making any changes. Resources not declared
+in the manifest count as drift only with --prune.
+
+With --detailed-exitcode the exit code is:
+  0  no changes, the account matches the manifest
+  1  error
+  2  the account has drifted from the manifest`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				return errors.New("plan accepts no arguments; use -f FILE")
+			}
+			if filename == "" {
+				return errors.New("set the manifest file using -f FILE")
+			}
+			if output != "text" && output != "json" {
+				return errors.New("output must be either text or json")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			m, err := ReadFile(filename)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			plan, err := fetchPlan(ctx, app.Client, app.JWTData.CapAID, m, prune)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			if output == "json" {
+				err = plan.WriteJSON(os.Stdout)
+			} else {
+				err = plan.WriteText(os.Stdout)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			if code := exitCode(plan, detailedExitCode); code != 0 {
+				os.Exit(code)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&filename, "filename", "f", "", "manifest file or - for stdin")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "output format text or json")
+	cmd.Flags().BoolVarP(&prune, "prune", "", false, "include buckets and webhooks not declared in the manifest as deletions")
+	cmd.Flags().BoolVarP(&detailedExitCode, "detailed-exitcode", "", false, "exit with 2 when there are changes, 0 when there are none and 1 on error")
+	return cmd
+}
+
+// exitCode returns the exit code of a successful plan command.
+func exitCode(plan *Plan, detailed bool) int {
+	if detailed && plan.HasChanges() {
+		return exitCodeChanges
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package notify
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"capturoo-cli-tool-go/http"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultInterval is the polling interval used when none is set.
+const DefaultInterval = 30 * time.Second
+
+// Config describes the notification channels and the rules that route
+// new leads to them. Values of the form ${NAME} in channel settings are
+// replaced with the environment variable NAME.
+//
+//	interval: 30s
+//	channels:
+//	  - name: sales
+//	    type: slack
+//	    url: ${SLACK_WEBHOOK_URL}
+//	    rate: 20/h
+//	  - name: inbox
+//	    type: smtp
+//	    smtp:
+//	      host: smtp.example.com
+//	      port: 587
+//	      username: alerts@example.com
+//	      password: ${SMTP_PASSWORD}
+//	      from: alerts@example.com
+//	      to: [sales@example.com]
+//	rules:
+//	  - name: summer
+//	    buckets: [summer-campaign]
+//	    channels: [sales, inbox]
+//	    digest: 1h
+//	    template: "{{.Lead.Data.firstName}} {{.Lead.Data.email}}"
+type Config struct {
+	Interval time.Duration `yaml:"interval"`
+	State    string        `yaml:"state"`
+	Channels []*Channel    `yaml:"channels"`
+	Rules    []*Rule       `yaml:"rules"`
+}
+
+// Channel is a notification target. Type is one of slack, teams, smtp or
+// http. Rate limits the number of messages sent, e.g. 10/m or 100/24h.
+type Channel struct {
+	Name    string            `yaml:"name"`
+	Type    string            `yaml:"type"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	SMTP    *SMTP             `yaml:"smtp"`
+	Rate    string            `yaml:"rate"`
+
+	rate http.Rate
+}
+
+// SMTP holds the mail server settings of an smtp channel.
+type SMTP struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Rule sends the new leads of the buckets to the channels. With Digest
+// set the leads are batched into a single message sent at most once per
+// Digest period, otherwise a message is sent for each lead. Template is
+// an optional Go template for the text of each lead executed with the
+// fields BucketCode, BucketName and Lead.
+type Rule struct {
+	Name     string        `yaml:"name"`
+	Buckets  []string      `yaml:"buckets"`
+	Channels []string      `yaml:"channels"`
+	Digest   time.Duration `yaml:"digest"`
+	Template string        `yaml:"template"`
+
+	tmpl *template.Template
+}
+
+// ReadConfig reads and validates the notify config file.
+func ReadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c Config
+	dec := yaml.NewDecoder(f)
+	dec.SetStrict(true)
+	if err := dec.Decode(&c); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode %q: %w", filename, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if c.State == "" {
+		c.State = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".state.json"
+	}
+	return &c, nil
+}
+
+// Validate checks the config for missing fields and unknown references
+// and expands environment variables in the channel settings.
+func (c *Config) Validate() error {
+	if c.Interval == 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Interval < time.Second {
+		return fmt.Errorf("interval %s is less than 1s", c.Interval)
+	}
+
+	channels := make(map[string]bool)
+	for i, ch := range c.Channels {
+		if ch == nil || ch.Name == "" {
+			return fmt.Errorf("channels[%d] is missing a name", i)
+		}
+		if channels[ch.Name] {
+			return fmt.Errorf("channel %q is declared more than once", ch.Name)
+		}
+		channels[ch.Name] = true
+		if err := ch.validate(); err != nil {
+			return fmt.Errorf("channel %q: %w", ch.Name, err)
+		}
+	}
+
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("no rules")
+	}
+	rules := make(map[string]bool)
+	for i, r := range c.Rules {
+		if r == nil {
+			return fmt.Errorf("rules[%d] is empty", i)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rules[r.Name] {
+			return fmt.Errorf("rule %q is declared more than once", r.Name)
+		}
+		rules[r.Name] = true
+		if len(r.Buckets) == 0 {
+			return fmt.Errorf("rule %q has no buckets", r.Name)
+		}
+		if len(r.Channels) == 0 {
+			return fmt.Errorf("rule %q has no channels", r.Name)
+		}
+		for _, name := range r.Channels {
+			if !channels[name] {
+				return fmt.Errorf("rule %q refers to unknown channel %q", r.Name, name)
+			}
+		}
+		if r.Digest < 0 {
+			return fmt.Errorf("rule %q digest must not be negative", r.Name)
+		}
+		if r.Template != "" {
+			tmpl, err := template.New(r.Name).Funcs(http.TemplateFuncs).Parse(r.Template)
+			if err != nil {
+				return fmt.Errorf("rule %q template: %w", r.Name, err)
+			}
+			r.tmpl = tmpl
+		}
+	}
+	return nil
+}
+
+func (ch *Channel) validate() error {
+	ch.URL = expandEnv(ch.URL)
+	for k, v := range ch.Headers {
+		ch.Headers[k] = expandEnv(v)
+	}
+
+	switch ch.Type {
+	case "slack", "teams", "http":
+		u, err := url.ParseRequestURI(ch.URL)
+		if err != nil {
+			return fmt.Errorf("url: %w", err)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("url must use http or https")
+		}
+	case "smtp":
+		s := ch.SMTP
+		if s == nil {
+			return fmt.Errorf("missing smtp settings")
+		}
+		s.Host = expandEnv(s.Host)
+		s.Username = expandEnv(s.Username)
+		s.Password = expandEnv(s.Password)
+		s.From = expandEnv(s.From)
+		if s.Host == "" || s.From == "" || len(s.To) == 0 {
+			return fmt.Errorf("smtp host, from and to are required")
+		}
+		if s.Port == 0 {
+			s.Port = 587
+		}
+	default:
+		return fmt.Errorf("unknown type %q (use slack, teams, smtp or http)", ch.Type)
+	}
+
+	if ch.Rate != "" {
+		r, err := http.ParseRate(ch.Rate)
+		if err != nil {
+			return err
+		}
+		ch.rate = r
+	}
+	return nil
+}
+
+var envRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} with the value of the environment variable
+// NAME. Unlike os.ExpandEnv a bare $ is left alone.
+func expandEnv(s string) string {
+	return envRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		return os.Getenv(m[2 : len(m)-1])
+	})
+}
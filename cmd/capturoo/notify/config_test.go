@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"capturoo-cli-tool-go/http"
+)
+
+func TestReadConfig(t *testing.T) {
+	os.Setenv("NOTIFY_TEST_SLACK_URL", "https://hooks.slack.com/services/T000/B000/XXXX")
+	defer os.Unsetenv("NOTIFY_TEST_SLACK_URL")
+
+	filename := filepath.Join(t.TempDir(), "notify.yaml")
+	config := `
+channels:
+  - name: sales
+    type: slack
+    url: ${NOTIFY_TEST_SLACK_URL}
+    rate: 20/h
+  - name: inbox
+    type: smtp
+    smtp:
+      host: smtp.example.com
+      from: alerts@example.com
+      to: [sales@example.com]
+rules:
+  - buckets: [summer]
+    channels: [sales, inbox]
+    digest: 1h
+    template: "{{range $k, $v := .Lead.Data}}{{$k}}={{$v}} {{end}}"
+`
+	if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Interval != DefaultInterval {
+		t.Errorf("Interval incorrect, got: %s, want: %s", c.Interval, DefaultInterval)
+	}
+	if want := strings.TrimSuffix(filename, ".yaml") + ".state.json"; c.State != want {
+		t.Errorf("State incorrect, got: %s, want: %s", c.State, want)
+	}
+	if c.Channels[0].URL != "https://hooks.slack.com/services/T000/B000/XXXX" {
+		t.Errorf("URL not expanded, got: %s", c.Channels[0].URL)
+	}
+	if r := c.Channels[0].rate; r != (http.Rate{N: 20, Per: time.Hour}) {
+		t.Errorf("rate incorrect, got: %+v", r)
+	}
+	if c.Channels[1].SMTP.Port != 587 {
+		t.Errorf("SMTP port incorrect, got: %d", c.Channels[1].SMTP.Port)
+	}
+	if c.Rules[0].Name != "rule-1" || c.Rules[0].Digest != time.Hour || c.Rules[0].tmpl == nil {
+		t.Errorf("rule incorrect, got: %+v", c.Rules[0])
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	slack := &Channel{Name: "sales", Type: "slack", URL: "https://hooks.slack.com/x"}
+	tests := []struct {
+		name   string
+		config *Config
+		want   string
+	}{
+		{"no rules", &Config{Channels: []*Channel{slack}}, "no rules"},
+		{"unknown channel", &Config{Rules: []*Rule{{Buckets: []string{"a"}, Channels: []string{"sales"}}}}, `rule "rule-1" refers to unknown channel "sales"`},
+		{"unknown type", &Config{Channels: []*Channel{{Name: "x", Type: "pager"}}}, `channel "x": unknown type "pager" (use slack, teams, smtp or http)`},
+		{"bad rate", &Config{Channels: []*Channel{{Name: "x", Type: "http", URL: "https://example.com", Rate: "ten/m"}}}, `channel "x": invalid rate "ten/m": count must be a positive integer`},
+		{"no buckets", &Config{Channels: []*Channel{slack}, Rules: []*Rule{{Name: "r", Channels: []string{"sales"}}}}, `rule "r" has no buckets`},
+	}
+	for _, tc := range tests {
+		err := tc.config.Validate()
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: Validate incorrect, got: %v, want: %s", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"capturoo-cli-tool-go/http"
+)
+
+const (
+	// maxQueue is the number of leads kept per queue. The oldest leads
+	// are dropped once it is exceeded.
+	maxQueue = 1000
+
+	// maxDigestLeads is the number of leads listed in a digest message.
+	maxDigestLeads = 20
+)
+
+// Daemon tails the leads of the configured buckets and sends them to the
+// channels of the matching rules.
+type Daemon struct {
+	Client    *http.Client
+	AccountID string
+	Config    *Config
+	Log       io.Writer
+
+	// DryRun prints messages to Log instead of sending them and leaves
+	// the state file unchanged.
+	DryRun bool
+
+	state    *State
+	senders  map[string]sender
+	limiters map[string]*limiter
+	buckets  map[string]*http.Bucket // by bucket code
+	now      func() time.Time
+}
+
+// NewDaemon returns a daemon for the config reading the state file.
+func NewDaemon(client *http.Client, accountID string, cfg *Config, log io.Writer) (*Daemon, error) {
+	state, err := readState(cfg.State)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state %s: %w", cfg.State, err)
+	}
+	d := &Daemon{
+		Client:    client,
+		AccountID: accountID,
+		Config:    cfg,
+		Log:       log,
+		state:     state,
+		senders:   make(map[string]sender),
+		limiters:  make(map[string]*limiter),
+		buckets:   make(map[string]*http.Bucket),
+		now:       time.Now,
+	}
+	for _, ch := range cfg.Channels {
+		d.senders[ch.Name] = newSender(ch)
+		d.limiters[ch.Name] = newLimiter(ch.rate)
+	}
+	return d, nil
+}
+
+// Run polls and flushes every interval until ctx is done. Before each
+// poll signIn is called so that an expired token can be refreshed.
+// Errors are logged and retried on the next interval.
+func (d *Daemon) Run(ctx context.Context, signIn func(context.Context) error) error {
+	ticker := time.NewTicker(d.Config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := signIn(ctx); err != nil {
+			d.logf("sign in failed: %v", err)
+		} else if err := d.Poll(ctx); err != nil {
+			d.logf("poll failed: %v", err)
+		}
+		d.Flush(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll queues the leads created since the previous poll. Buckets without
+// a cursor are recorded without queueing their existing leads.
+func (d *Daemon) Poll(ctx context.Context) error {
+	buckets, err := d.Client.GetBuckets(ctx, d.AccountID)
+	if err != nil {
+		return fmt.Errorf("get buckets: %w", err)
+	}
+	d.buckets = make(map[string]*http.Bucket)
+	for _, b := range buckets {
+		d.buckets[b.BucketCode] = b
+	}
+
+	for _, code := range d.bucketCodes() {
+		b, ok := d.buckets[code]
+		if !ok {
+			continue
+		}
+		cur, ok := d.state.Cursors[code]
+		first := !ok
+		if first {
+			cur = &Cursor{Seen: make(map[string]time.Time)}
+		}
+
+		var leads []*http.Lead
+		err := d.Client.ForEachLead(ctx, b.BucketID, func(l *http.Lead) error {
+			if cur.isNew(l) {
+				leads = append(leads, l)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("get leads for bucket %q: %w", code, err)
+		}
+		sort.SliceStable(leads, func(i, j int) bool {
+			return leads[i].System.Created.Before(leads[j].System.Created)
+		})
+
+		for _, l := range leads {
+			cur.add(l)
+			if !first {
+				d.enqueue(code, l)
+			}
+		}
+		cur.prune()
+		d.state.Cursors[code] = cur
+		if !first && len(leads) > 0 {
+			d.logf("%d new leads in %s", len(leads), code)
+		}
+	}
+	return d.saveState()
+}
+
+// Flush sends the queued leads that are due and allowed by the channel
+// rate limits. Leads that fail to send stay queued.
+func (d *Daemon) Flush(ctx context.Context) {
+	now := d.now()
+	for _, r := range d.Config.Rules {
+		for _, name := range r.Channels {
+			key := queueKey(r, name)
+			q, ok := d.state.Queues[key]
+			if !ok || len(q.Leads) == 0 {
+				continue
+			}
+			if r.Digest > 0 && now.Sub(q.LastFlush) < r.Digest {
+				continue
+			}
+			if err := d.flushQueue(ctx, r, name, q, now); err != nil {
+				d.logf("failed to notify %s for rule %s: %v", name, r.Name, err)
+			}
+		}
+	}
+	if err := d.saveState(); err != nil {
+		d.logf("failed to write state: %v", err)
+	}
+}
+
+func (d *Daemon) saveState() error {
+	if d.DryRun {
+		return nil
+	}
+	return d.state.write(d.Config.State)
+}
+
+// flushQueue sends each lead as its own message if the rate limit allows
+// it, otherwise all of the leads as a single digest message.
+func (d *Daemon) flushQueue(ctx context.Context, r *Rule, channel string, q *Queue, now time.Time) error {
+	lim := d.limiters[channel]
+	available := lim.available(now)
+	if available == 0 {
+		return nil
+	}
+	var s sender = d.senders[channel]
+	if d.DryRun {
+		s = &printSender{w: d.Log, channel: channel}
+	}
+
+	if r.Digest > 0 || len(q.Leads) > available {
+		m, err := d.message(r, q.Leads)
+		if err != nil {
+			return err
+		}
+		if err := s.Send(ctx, m); err != nil {
+			return err
+		}
+		lim.take()
+		q.Leads = nil
+		q.LastFlush = now
+		return nil
+	}
+
+	for len(q.Leads) > 0 {
+		m, err := d.message(r, q.Leads[:1])
+		if err != nil {
+			return err
+		}
+		if err := s.Send(ctx, m); err != nil {
+			return err
+		}
+		lim.take()
+		q.Leads = q.Leads[1:]
+		q.LastFlush = now
+	}
+	return nil
+}
+
+// enqueue adds the lead to the queues of every rule for the bucket.
+func (d *Daemon) enqueue(code string, l *http.Lead) {
+	for _, r := range d.Config.Rules {
+		if !contains(r.Buckets, code) {
+			continue
+		}
+		for _, name := range r.Channels {
+			key := queueKey(r, name)
+			q, ok := d.state.Queues[key]
+			if !ok {
+				// a new digest is first sent a full period from now
+				q = &Queue{LastFlush: d.now()}
+				d.state.Queues[key] = q
+			}
+			q.Leads = append(q.Leads, &QueuedLead{BucketCode: code, Lead: l})
+			if n := len(q.Leads) - maxQueue; n > 0 {
+				d.logf("queue %s is full, dropping %d leads", key, n)
+				q.Leads = q.Leads[n:]
+			}
+		}
+	}
+}
+
+// message formats the leads as a single lead message or a digest.
+func (d *Daemon) message(r *Rule, queued []*QueuedLead) (*Message, error) {
+	m := &Message{}
+	var texts []string
+	codes := make(map[string]bool)
+	for i, ql := range queued {
+		m.Leads = append(m.Leads, ql.Lead)
+		codes[ql.BucketCode] = true
+		if i >= maxDigestLeads {
+			continue
+		}
+		text, err := d.leadText(r, ql)
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+
+	where := ""
+	if len(codes) == 1 {
+		where = " in " + d.bucketName(queued[0].BucketCode)
+	}
+	if len(queued) == 1 {
+		m.Title = "New lead" + where
+		m.Text = texts[0]
+		return m, nil
+	}
+	m.Title = fmt.Sprintf("%d new leads%s", len(queued), where)
+	m.Text = strings.Join(texts, "\n\n")
+	if n := len(queued) - maxDigestLeads; n > 0 {
+		m.Text += fmt.Sprintf("\n\n...and %d more", n)
+	}
+	return m, nil
+}
+
+// leadText formats a lead with the rule template or, by default, as a
+// line for each data field.
+func (d *Daemon) leadText(r *Rule, ql *QueuedLead) (string, error) {
+	if r.tmpl != nil {
+		var buf bytes.Buffer
+		err := r.tmpl.Execute(&buf, struct {
+			BucketCode string
+			BucketName string
+			Lead       *http.Lead
+		}{ql.BucketCode, d.bucketName(ql.BucketCode), ql.Lead})
+		if err != nil {
+			return "", fmt.Errorf("rule %q template: %w", r.Name, err)
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+
+	keys := make([]string, 0, len(ql.Lead.Data))
+	for k := range ql.Lead.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%s: %v", k, ql.Lead.Data[k]))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "lead "+ql.Lead.LeadID)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (d *Daemon) bucketName(code string) string {
+	if b, ok := d.buckets[code]; ok && b.BucketName != "" {
+		return b.BucketName
+	}
+	return code
+}
+
+// bucketCodes returns the bucket codes of every rule.
+func (d *Daemon) bucketCodes() []string {
+	var codes []string
+	for _, r := range d.Config.Rules {
+		for _, c := range r.Buckets {
+			if !contains(codes, c) {
+				codes = append(codes, c)
+			}
+		}
+	}
+	return codes
+}
+
+func (d *Daemon) logf(format string, a ...interface{}) {
+	fmt.Fprintf(d.Log, "%s %s\n", d.now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, a...))
+}
+
+func queueKey(r *Rule, channel string) string {
+	return r.Name + "/" + channel
+}
+
+func contains(a []string, x string) bool {
+	for _, n := range a {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+// limiter allows rate.N messages per rate.Per. The zero rate is
+// unlimited.
+type limiter struct {
+	rate   http.Rate
+	bucket http.TokenBucket
+}
+
+func newLimiter(r http.Rate) *limiter {
+	return &limiter{rate: r}
+}
+
+// available returns the number of messages that may be sent now.
+func (l *limiter) available(now time.Time) int {
+	if l.rate.N <= 0 {
+		return maxQueue
+	}
+	return int(l.bucket.Fill(l.rate, now))
+}
+
+func (l *limiter) take() {
+	if l.rate.N > 0 {
+		l.bucket.Take()
+	}
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"capturoo-cli-tool-go/emulator"
+	"capturoo-cli-tool-go/http"
+)
+
+type recordingSender struct {
+	messages []*Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, m *Message) error {
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+func TestDaemon(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := http.NewClient(ts.URL)
+	client.JWT = srv.IDToken()
+	accountID := srv.Account().AccountID
+
+	b, err := client.CreateBucket(ctx, accountID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*http.Lead{{LeadID: "old"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		State: filepath.Join(t.TempDir(), "notify.state.json"),
+		Channels: []*Channel{
+			{Name: "each", Type: "http", URL: "https://example.com/each", Rate: "2/h"},
+			{Name: "digest", Type: "http", URL: "https://example.com/digest"},
+		},
+		Rules: []*Rule{
+			{Name: "each", Buckets: []string{"summer"}, Channels: []string{"each"}},
+			{Name: "digest", Buckets: []string{"summer"}, Channels: []string{"digest"}, Digest: time.Hour},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	each, digest := &recordingSender{}, &recordingSender{}
+	newTestDaemon := func() *Daemon {
+		d, err := NewDaemon(client, accountID, cfg, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.now = func() time.Time { return now }
+		d.senders["each"] = each
+		d.senders["digest"] = digest
+		return d
+	}
+
+	d := newTestDaemon()
+	if err := d.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.Flush(ctx)
+	if len(each.messages) != 0 || len(digest.messages) != 0 {
+		t.Fatalf("existing leads were sent, got: %d and %d messages", len(each.messages), len(digest.messages))
+	}
+
+	// a restarted daemon continues from the saved cursor
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*http.Lead{
+		{LeadID: "new-1", Data: map[string]interface{}{"email": "a@example.com"}},
+		{LeadID: "new-2", Data: map[string]interface{}{"email": "b@example.com"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d = newTestDaemon()
+	if err := d.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.Flush(ctx)
+	if len(each.messages) != 2 {
+		t.Fatalf("each messages incorrect, got: %d, want: %d", len(each.messages), 2)
+	}
+	if m := each.messages[0]; m.Title != "New lead in Summer" || m.Text != "email: a@example.com" {
+		t.Errorf("each message incorrect, got: %q %q", m.Title, m.Text)
+	}
+	if len(digest.messages) != 0 {
+		t.Errorf("digest sent before the digest period, got: %d messages", len(digest.messages))
+	}
+
+	// the rate limit is used up so the next leads are sent as a digest
+	// once a token is available
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*http.Lead{{LeadID: "new-3"}, {LeadID: "new-4"}, {LeadID: "new-5"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Poll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.Flush(ctx)
+	if len(each.messages) != 2 {
+		t.Fatalf("rate limit exceeded, got: %d messages", len(each.messages))
+	}
+	now = now.Add(30 * time.Minute)
+	d.Flush(ctx)
+	if len(each.messages) != 3 || each.messages[2].Title != "3 new leads in Summer" {
+		t.Errorf("rate limited digest incorrect, got: %d messages", len(each.messages))
+	}
+	if len(digest.messages) != 0 {
+		t.Errorf("digest sent before the digest period, got: %d messages", len(digest.messages))
+	}
+
+	now = now.Add(30 * time.Minute)
+	d.Flush(ctx)
+	if len(digest.messages) != 1 || len(digest.messages[0].Leads) != 5 {
+		t.Errorf("digest incorrect, got: %d messages", len(digest.messages))
+	}
+}
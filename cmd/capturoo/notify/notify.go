@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdNotify returns an instance of the notify sub command.
+func NewCmdNotify() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Send new lead notifications to Slack, Teams, email or HTTP",
+	}
+	cmd.AddCommand(NewCmdNotifyRun())
+	cmd.AddCommand(NewCmdNotifyTest())
+	return cmd
+}
+
+// NewCmdNotifyRun returns an instance of the notify run sub command.
+func NewCmdNotifyRun() *cobra.Command {
+	var configFile string
+	var once, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "run --config notify.yaml [--once] [--dry-run]",
+		Short: "Tail new leads and send notifications",
+		Long: `Poll the buckets named in the config for new leads and send them to the
+channels of each matching rule. Channels may be rate limited and rules
+may batch leads into digests. Leads already in a bucket the first time
+it is polled are not sent.
+
+The position in each bucket and any unsent leads are kept in a state
+file, notify.state.json next to the config by default, so the daemon can
+be restarted without repeating or missing notifications. Use --once to
+poll a single time, e.g. from cron.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if configFile == "" {
+				return errors.New("set the config file using --config FILE")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			cfg, err := ReadConfig(configFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			d, err := NewDaemon(app.Client, app.JWTData.CapAID, cfg, os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			d.DryRun = dryRun
+
+			if once {
+				if err := d.Poll(ctx); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				d.Flush(ctx)
+				return
+			}
+
+			fmt.Printf("Notifying %d rules every %s (Ctrl-C to stop)\n", len(cfg.Rules), cfg.Interval)
+			if err := d.Run(ctx, app.SignIn); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "notify config file")
+	cmd.Flags().BoolVar(&once, "once", false, "poll once and exit")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print notifications instead of sending them and leave the state file unchanged")
+	return cmd
+}
+
+// NewCmdNotifyTest returns an instance of the notify test sub command.
+func NewCmdNotifyTest() *cobra.Command {
+	var configFile, channel string
+
+	cmd := &cobra.Command{
+		Use:   "test --config notify.yaml [--channel NAME]",
+		Short: "Send a sample notification to each channel",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if configFile == "" {
+				return errors.New("set the config file using --config FILE")
+			}
+			return nil
+		},
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// prevent root level PersistentPreRun
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := ReadConfig(configFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			m := &Message{
+				Title: "Test notification from capturoo",
+				Text:  "email: jane.doe@example.com\nfirstName: Jane\nlastName: Doe",
+				Leads: []*http.Lead{{
+					LeadID: "lead_sample",
+					System: http.System{Created: time.Now().UTC()},
+					Data: map[string]interface{}{
+						"email":     "jane.doe@example.com",
+						"firstName": "Jane",
+						"lastName":  "Doe",
+					},
+				}},
+			}
+			failed := false
+			found := false
+			for _, ch := range cfg.Channels {
+				if channel != "" && ch.Name != channel {
+					continue
+				}
+				found = true
+				if err := newSender(ch).Send(cmd.Context(), m); err != nil {
+					fmt.Printf("%s (%s): FAILED: %v\n", ch.Name, ch.Type, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("%s (%s): sent\n", ch.Name, ch.Type)
+			}
+			if !found {
+				fmt.Fprintf(os.Stderr, "Channel %q not found.\n", channel)
+				os.Exit(1)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&configFile, "config", "c", "", "notify config file")
+	cmd.Flags().StringVar(&channel, "channel", "", "only send to the named channel")
+	return cmd
+}
@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	nethttp "net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"capturoo-cli-tool-go/http"
+)
+
+// Message is a notification of one or more new leads.
+type Message struct {
+	Title string
+	Text  string
+	Leads []*http.Lead
+}
+
+// sender delivers messages to a channel.
+type sender interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+var httpClient = &nethttp.Client{Timeout: 30 * time.Second}
+
+// newSender returns the sender for the channel type.
+func newSender(ch *Channel) sender {
+	switch ch.Type {
+	case "slack":
+		return &slackSender{url: ch.URL}
+	case "teams":
+		return &teamsSender{url: ch.URL}
+	case "smtp":
+		return &smtpSender{cfg: ch.SMTP}
+	}
+	return &httpSender{url: ch.URL, headers: ch.Headers}
+}
+
+// slackSender posts to a Slack incoming webhook.
+type slackSender struct {
+	url string
+}
+
+func (s *slackSender) Send(ctx context.Context, m *Message) error {
+	return postJSON(ctx, s.url, nil, map[string]string{
+		"text": "*" + m.Title + "*\n" + m.Text,
+	})
+}
+
+// teamsSender posts a message card to a Microsoft Teams incoming webhook.
+type teamsSender struct {
+	url string
+}
+
+func (s *teamsSender) Send(ctx context.Context, m *Message) error {
+	return postJSON(ctx, s.url, nil, map[string]string{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  m.Title,
+		"title":    m.Title,
+		// Teams renders markdown where single newlines are ignored.
+		"text": strings.ReplaceAll(m.Text, "\n", "\n\n"),
+	})
+}
+
+// httpSender posts the message and its leads as JSON.
+type httpSender struct {
+	url     string
+	headers map[string]string
+}
+
+func (s *httpSender) Send(ctx context.Context, m *Message) error {
+	return postJSON(ctx, s.url, s.headers, struct {
+		Title string       `json:"title"`
+		Text  string       `json:"text"`
+		Leads []*http.Lead `json:"leads"`
+	}{m.Title, m.Text, m.Leads})
+}
+
+// smtpSender emails the message.
+type smtpSender struct {
+	cfg *SMTP
+}
+
+func (s *smtpSender) Send(ctx context.Context, m *Message) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", m.Title)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(m.Text, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	return sendMail(ctx, addr, s.cfg.Host, auth, s.cfg.From, s.cfg.To, buf.Bytes())
+}
+
+// smtpTimeout bounds the delivery of an email when ctx has no earlier
+// deadline.
+const smtpTimeout = 30 * time.Second
+
+// sendMail is smtp.SendMail bounded by ctx. The connection is closed if
+// ctx is cancelled so that a stalled mail server cannot block the daemon.
+func sendMail(ctx context.Context, addr, host string, auth smtp.Auth, from string, to []string, msg []byte) (err error) {
+	dialer := net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > smtpTimeout {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	defer func() {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// printSender writes messages to w, for dry runs.
+type printSender struct {
+	w       io.Writer
+	channel string
+}
+
+func (s *printSender) Send(ctx context.Context, m *Message) error {
+	fmt.Fprintf(s.w, "--> %s: %s\n", s.channel, m.Title)
+	for _, line := range strings.Split(m.Text, "\n") {
+		fmt.Fprintf(s.w, "    %s\n", line)
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := nethttp.NewRequestWithContext(ctx, nethttp.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
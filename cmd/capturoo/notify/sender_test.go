@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer accepts a single connection on a local port, answering it
+// with handle.
+func smtpServer(t *testing.T, handle func(conn net.Conn)) *SMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return &SMTP{Host: "127.0.0.1", Port: addr.Port, From: "cli@example.com", To: []string{"sales@example.com"}}
+}
+
+func TestSMTPSend(t *testing.T) {
+	got := make(chan string, 1)
+	cfg := smtpServer(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				got <- data.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	})
+
+	s := &smtpSender{cfg: cfg}
+	if err := s.Send(context.Background(), &Message{Title: "New lead", Text: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-got
+	for _, want := range []string{"Subject: New lead\r\n", "To: sales@example.com\r\n", "jane@example.com\r\n"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestSMTPSendCancel(t *testing.T) {
+	// the server accepts the connection but never greets the client
+	stall := make(chan struct{})
+	defer close(stall)
+	cfg := smtpServer(t, func(conn net.Conn) { <-stall })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := (&smtpSender{cfg: cfg}).Send(ctx, &Message{Title: "New lead"})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Send error incorrect, got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Send returned after %s", d)
+	}
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"capturoo-cli-tool-go/http"
+)
+
+// cursorLookback is how far before the newest lead seen a bucket is
+// rescanned, so that leads stored slightly out of order are not missed.
+const cursorLookback = 10 * time.Minute
+
+// State is persisted between runs so that a restarted daemon neither
+// repeats nor misses notifications.
+type State struct {
+	// Cursors by bucket code.
+	Cursors map[string]*Cursor `json:"cursors"`
+
+	// Queues of leads waiting to be sent by rule and channel name.
+	Queues map[string]*Queue `json:"queues"`
+}
+
+// Cursor records the newest lead seen in a bucket and the IDs of the
+// leads seen within cursorLookback of it.
+type Cursor struct {
+	Created time.Time            `json:"created"`
+	Seen    map[string]time.Time `json:"seen"`
+}
+
+// Queue holds the leads waiting to be sent to a channel for a rule.
+type Queue struct {
+	Leads     []*QueuedLead `json:"leads"`
+	LastFlush time.Time     `json:"lastFlush"`
+}
+
+// QueuedLead is a lead waiting to be sent.
+type QueuedLead struct {
+	BucketCode string     `json:"bucketCode"`
+	Lead       *http.Lead `json:"lead"`
+}
+
+// isNew reports whether the lead has not been seen before.
+func (c *Cursor) isNew(l *http.Lead) bool {
+	if _, ok := c.Seen[l.LeadID]; ok {
+		return false
+	}
+	return !l.System.Created.Before(c.Created.Add(-cursorLookback))
+}
+
+// add records the lead as seen.
+func (c *Cursor) add(l *http.Lead) {
+	if c.Seen == nil {
+		c.Seen = make(map[string]time.Time)
+	}
+	c.Seen[l.LeadID] = l.System.Created
+	if l.System.Created.After(c.Created) {
+		c.Created = l.System.Created
+	}
+}
+
+// prune forgets the leads older than the lookback window.
+func (c *Cursor) prune() {
+	cutoff := c.Created.Add(-cursorLookback)
+	for id, t := range c.Seen {
+		if t.Before(cutoff) {
+			delete(c.Seen, id)
+		}
+	}
+}
+
+func newState() *State {
+	return &State{
+		Cursors: make(map[string]*Cursor),
+		Queues:  make(map[string]*Queue),
+	}
+}
+
+// readState reads the state file returning an empty state if it does not
+// exist.
+func readState(filename string) (*State, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := newState()
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Cursors == nil {
+		s.Cursors = make(map[string]*Cursor)
+	}
+	if s.Queues == nil {
+		s.Queues = make(map[string]*Queue)
+	}
+	return s, nil
+}
+
+// write saves the state replacing the file atomically.
+func (s *State) write(filename string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".notify-state-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
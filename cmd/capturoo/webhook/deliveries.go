@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookDeliveries returns an instance of the webhook deliveries sub command.
+func NewCmdWebhookDeliveries() *cobra.Command {
+	var failed bool
+	var since time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "deliveries WEBHOOK_CODE [--failed] [--since 24h]",
+		Short: "List the delivery attempts of a webhook",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing WEBHOOK_CODE argument")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			webhook, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			opts := &http.DeliveryListOptions{Failed: failed}
+			if since > 0 {
+				opts.Since = time.Now().Add(-since)
+			}
+			deliveries, err := app.Client.GetWebhookDeliveries(ctx, webhook.WebhookID, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to get webhook deliveries: %v\n", err)
+				os.Exit(1)
+			}
+			if len(deliveries) == 0 {
+				fmt.Println("No deliveries found.")
+				return
+			}
+
+			tw := new(tabwriter.Writer).Init(os.Stdout, 0, 8, 2, ' ', 0)
+			headers := []interface{}{"Delivery ID", "Event", "Event ID", "Attempt", "Status", "Duration", "Time"}
+			format := "%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n"
+			fmt.Fprintf(tw, format, headers...)
+			fmt.Fprintf(tw, format, headersUnderlined(headers)...)
+			for _, d := range deliveries {
+				fmt.Fprintf(tw, format, d.DeliveryID, d.EventType, d.EventID, d.Attempt,
+					deliveryStatus(d), fmt.Sprintf("%dms", d.DurationMS), d.Created.Local().Format("2006-01-02 15:04:05"))
+			}
+			if err := tw.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&failed, "failed", false, "only show failed deliveries")
+	cmd.Flags().DurationVar(&since, "since", 0, "only show deliveries made within the duration e.g. 24h")
+	return cmd
+}
+
+// NewCmdWebhookReplay returns an instance of the webhook replay sub command.
+func NewCmdWebhookReplay() *cobra.Command {
+	var allFailed bool
+	var since time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "replay WEBHOOK_CODE DELIVERY_ID|--all-failed [--since 24h]",
+		Short: "Redeliver webhook events",
+		Long: `Redeliver the event of a previous delivery to the webhook. With
+--all-failed every event whose most recent delivery failed is redelivered,
+optionally limited to deliveries made within --since.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing WEBHOOK_CODE argument")
+			}
+			if allFailed && len(args) > 1 {
+				return errors.New("use either DELIVERY_ID or --all-failed but not both")
+			}
+			if !allFailed && len(args) < 2 {
+				return errors.New("missing DELIVERY_ID argument or --all-failed flag")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			webhook, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			var ids []string
+			if allFailed {
+				opts := &http.DeliveryListOptions{}
+				if since > 0 {
+					opts.Since = time.Now().Add(-since)
+				}
+				deliveries, err := app.Client.GetWebhookDeliveries(ctx, webhook.WebhookID, opts)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to get webhook deliveries: %v\n", err)
+					os.Exit(1)
+				}
+				ids = failedDeliveries(deliveries)
+				if len(ids) == 0 {
+					fmt.Println("No failed deliveries to replay.")
+					return
+				}
+			} else {
+				ids = args[1:2]
+			}
+
+			failed := 0
+			for _, id := range ids {
+				d, err := app.Client.ReplayWebhookDelivery(ctx, webhook.WebhookID, id)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to replay delivery %s: %v\n", id, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s  %s  attempt %d  %s  %dms\n", d.EventID, d.EventType, d.Attempt, deliveryStatus(d), d.DurationMS)
+				if !d.Succeeded() && (d.StatusCode != 0 || d.Error != "") {
+					failed++
+				}
+			}
+			fmt.Printf("Replayed %d deliveries, %d failed.\n", len(ids), failed)
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&allFailed, "all-failed", false, "replay every event whose most recent delivery failed")
+	cmd.Flags().DurationVar(&since, "since", 0, "with --all-failed, only replay deliveries made within the duration e.g. 24h")
+	return cmd
+}
+
+// failedDeliveries returns the IDs of the most recent delivery of each
+// event whose most recent delivery failed. deliveries are most recent
+// first.
+func failedDeliveries(deliveries []*http.Delivery) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, d := range deliveries {
+		if seen[d.EventID] {
+			continue
+		}
+		seen[d.EventID] = true
+		if !d.Succeeded() {
+			ids = append(ids, d.DeliveryID)
+		}
+	}
+	return ids
+}
+
+func deliveryStatus(d *http.Delivery) string {
+	if d.StatusCode == 0 {
+		if d.Error != "" {
+			return "error: " + d.Error
+		}
+		return "pending"
+	}
+	return strconv.Itoa(d.StatusCode)
+}
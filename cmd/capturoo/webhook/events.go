@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookEvents returns an instance of the webhook events sub command.
+func NewCmdWebhookEvents() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "List the webhook event types",
+		Long: `List the event types webhooks can subscribe to. Context driven events
+must be bound to one or more bucket codes, for example
+lead.created:bucket-a|bucket-b. The catalogue is fetched from the API,
+falling back to the catalogue built into the CLI if the API does not
+serve one.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			catalogue, source, err := loadEventCatalogue(ctx, app.Client)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Event catalogue version %s (%s)\n\n", catalogue.Version, source)
+
+			tw := new(tabwriter.Writer).Init(os.Stdout, 0, 8, 2, ' ', 0)
+			headers := []interface{}{"Event", "Bucket codes", "Description"}
+			format := "%v\t%v\t%v\t\n"
+			fmt.Fprintf(tw, format, headers...)
+			fmt.Fprintf(tw, format, headersUnderlined(headers)...)
+			for _, e := range catalogue.Events {
+				codes := "-"
+				if e.ContextDriven {
+					codes = "required"
+				}
+				fmt.Fprintf(tw, format, e.Name, codes, e.Description)
+			}
+			if err := tw.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// loadEventCatalogue returns the API event catalogue or, if the API does
+// not serve one, the catalogue built into the CLI. The second return value
+// names the source of the catalogue. Other errors, such as failing to
+// sign in or reach the API, are returned.
+func loadEventCatalogue(ctx context.Context, client *http.Client) (*http.EventCatalogue, string, error) {
+	catalogue, err := client.GetEventCatalogue(ctx)
+	if errors.Is(err, http.ErrEventCatalogueUnsupported) {
+		return http.DefaultEventCatalogue, "built-in", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get the event catalogue: %w", err)
+	}
+	if catalogue == nil || len(catalogue.Events) == 0 {
+		return http.DefaultEventCatalogue, "built-in", nil
+	}
+	return catalogue, "api", nil
+}
+
+// checkEvents validates the parsed events against the catalogue. Unknown
+// event types are reported with the closest known type as a suggestion.
+func checkEvents(catalogue *http.EventCatalogue, events []event) error {
+	var problems []string
+	for _, e := range events {
+		et, ok := catalogue.Lookup(e.name)
+		if !ok {
+			problems = append(problems, unknownEventError(catalogue, e.name).Error())
+			continue
+		}
+		if et.ContextDriven && len(e.resources) == 0 {
+			problems = append(problems, fmt.Sprintf("%s is a context driven event and must contain a resource name in the form of %s:bucket-code", e.name, e.name))
+		}
+		if !et.ContextDriven && len(e.resources) > 0 {
+			problems = append(problems, fmt.Sprintf("%s does not take bucket codes", e.name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// unknownEventError reports an unknown event type suggesting the closest
+// known type.
+func unknownEventError(catalogue *http.EventCatalogue, name string) error {
+	if s := catalogue.Suggest(name); s != "" {
+		return fmt.Errorf("unknown event type %q (did you mean %q?)", name, s)
+	}
+	return fmt.Errorf("unknown event type %q (valid types are %s)", name, strings.Join(catalogue.Names(), ", "))
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// resolvedEvent is a webhook event with its bucket code resources
+// resolved against the account's buckets. Bucket is nil for a resource
+// referencing a deleted or unknown bucket code.
+type resolvedEvent struct {
+	name      string
+	resources []resolvedResource
+}
+
+type resolvedResource struct {
+	code   string
+	bucket *http.Bucket
+}
+
+// NewCmdWebhookGet returns an instance of the webhook get sub command.
+func NewCmdWebhookGet() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get WEBHOOK_CODE",
+		Short: "Show webhook details",
+		Long: `Show the details of a webhook with the bucket codes of context driven
+events such as lead.created:bucket-a|bucket-b resolved against the
+account's buckets. Codes of deleted or unknown buckets are flagged.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing WEBHOOK_CODE argument")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			// the listing holds the whole webhook so it is not fetched again
+			webhook, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			buckets, err := app.Client.GetBuckets(ctx, app.JWTData.CapAID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to get buckets: %v\n", err)
+				os.Exit(1)
+			}
+
+			events := resolveEvents(webhook.Events, buckets)
+			if err := displayWebhookDetail(os.Stdout, webhook, events); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// resolveEvents expands the bucket code resources of each event.
+func resolveEvents(events []string, buckets []*http.Bucket) []resolvedEvent {
+	byCode := make(map[string]*http.Bucket)
+	for _, b := range buckets {
+		byCode[b.BucketCode] = b
+	}
+
+	result := make([]resolvedEvent, 0, len(events))
+	for _, e := range events {
+		parts := strings.SplitN(e, ":", 2)
+		re := resolvedEvent{name: parts[0]}
+		if len(parts) == 2 {
+			for _, code := range strings.Split(parts[1], "|") {
+				re.resources = append(re.resources, resolvedResource{code: code, bucket: byCode[code]})
+			}
+		}
+		result = append(result, re)
+	}
+	return result
+}
+
+func displayWebhookDetail(w io.Writer, webhook *http.Webhook, events []resolvedEvent) error {
+	tw := new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', 0)
+	format := "%s\t%s\t\n"
+	fmt.Fprintf(tw, format, "Webhook ID:", webhook.WebhookID)
+	fmt.Fprintf(tw, format, "Webhook code:", webhook.Code)
+	fmt.Fprintf(tw, format, "URL:", webhook.URL)
+	fmt.Fprintf(tw, format, "Enabled:", enabledDisabled(webhook.Enabled))
+	fmt.Fprintf(tw, format, "Created:", webhook.Created)
+	fmt.Fprintf(tw, format, "Modified:", webhook.Modified)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nEvents:\n")
+	tw = new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', 0)
+	var missing int
+	for _, e := range events {
+		fmt.Fprintf(tw, "  %s\n", e.name)
+		for _, r := range e.resources {
+			if r.bucket == nil {
+				missing++
+				fmt.Fprintf(tw, "    %s\t%s\n", r.code, "NOT FOUND (deleted or unknown bucket)")
+				continue
+			}
+			fmt.Fprintf(tw, "    %s\t%s\t%s\n", r.code, r.bucket.BucketName, r.bucket.BucketID)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if missing > 0 {
+		fmt.Fprintf(w, "\nWarning: %d event resource(s) reference buckets that do not exist. Use capturoo webhook update to remove them.\n", missing)
+	}
+
+	if webhook.Transform != nil {
+		fmt.Fprintf(w, "\nTransform (%s):\n", webhook.Transform.Language)
+		for _, line := range strings.Split(strings.TrimRight(webhook.Transform.Source, "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/watch"
+	"capturoo-cli-tool-go/webhook/verify"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookListen returns an instance of the webhook listen sub command.
+func NewCmdWebhookListen() *cobra.Command {
+	var events, forwardTo, secret string
+	var interval time.Duration
+	var evtList []event
+
+	cmd := &cobra.Command{
+		Use:   "listen --events EVENTS --forward-to URL",
+		Short: "Forward events to a local webhook handler",
+		Long: `Poll the account for events and forward each one to a local handler as
+a webhook delivery with the Capturoo-Event and Capturoo-Delivery headers.
+Unlike webhook URLs, the forwarding URL may use plain http. Use --secret
+to sign forwarded deliveries so that signature verification can be tested.
+
+No webhook is registered with the API. Leads already in the buckets when
+listening starts are not forwarded.
+
+	capturoo webhook listen --events lead.created:my-bucket --forward-to http://localhost:3000/hook`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if events == "" {
+				return errors.New("set the event list using --events")
+			}
+			var err error
+			evtList, err = parseEventArgs(events)
+			if err != nil {
+				return err
+			}
+			if forwardTo == "" {
+				return errors.New("set the local handler using --forward-to URL")
+			}
+			u, err := url.ParseRequestURI(forwardTo)
+			if err != nil {
+				return fmt.Errorf("failed to parse url: %w", err)
+			}
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return errors.New("--forward-to must be an http or https url")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			catalogue, _, err := loadEventCatalogue(ctx, app.Client)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if err := checkEvents(catalogue, evtList); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			var evs []string
+			for _, e := range evtList {
+				evs = append(evs, e.String())
+			}
+			w := &watch.Watcher{
+				Client:    app.Client,
+				AccountID: app.JWTData.CapAID,
+				Events:    evs,
+				Interval:  interval,
+			}
+
+			fmt.Printf("Listening for %s, forwarding to %s (Ctrl-C to stop)\n", displayEvents(evs), forwardTo)
+			client := &nethttp.Client{Timeout: 30 * time.Second}
+			err = w.Run(ctx, func(ev *http.WebhookEvent) error {
+				forward(ctx, os.Stdout, client, forwardTo, secret, ev)
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&events, "events", "e", "", "comma separated list of events e.g. lead.created:my-bucket")
+	cmd.Flags().StringVar(&forwardTo, "forward-to", "", "URL of the local webhook handler")
+	cmd.Flags().StringVar(&secret, "secret", "", "sign forwarded deliveries with the secret")
+	cmd.Flags().DurationVar(&interval, "interval", watch.DefaultInterval, "polling interval")
+	return cmd
+}
+
+// forward delivers the event to url printing the request and response.
+// Delivery failures are printed rather than returned so that listening
+// continues.
+func forward(ctx context.Context, out io.Writer, client *nethttp.Client, url, secret string, ev *http.WebhookEvent) {
+	ts := time.Now().Format("2006-01-02 15:04:05")
+	fmt.Fprintf(out, "%s  --> %s [%s]\n", ts, ev.Type, ev.EventID)
+
+	req, err := http.NewWebhookRequest(ctx, url, ev)
+	if err != nil {
+		fmt.Fprintf(out, "%s  <-- [ERR] %v\n", ts, err)
+		return
+	}
+	if secret != "" {
+		if err := verify.SignRequest(req, secret); err != nil {
+			fmt.Fprintf(out, "%s  <-- [ERR] %v\n", ts, err)
+			return
+		}
+	}
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(out, "%s  <-- [ERR] POST %s [%s] %v\n", ts, url, ev.EventID, err)
+		return
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	fmt.Fprintf(out, "%s  <-- [%d] POST %s [%s] %s\n", time.Now().Format("2006-01-02 15:04:05"),
+		res.StatusCode, url, ev.EventID, time.Since(start).Round(time.Millisecond))
+}
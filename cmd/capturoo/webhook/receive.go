@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	nethttp "net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"capturoo-cli-tool-go/webhook/verify"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookReceive returns an instance of the webhook receive sub command.
+func NewCmdWebhookReceive() *cobra.Command {
+	var port int
+	var tlsSelfSigned bool
+	var host, saveFile, status, secret string
+	var delay time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "receive [--port 8443] [--host 127.0.0.1] [--tls-self-signed]",
+		Short: "Run a local server that logs webhook deliveries",
+		Long: `Run a local server that logs every webhook delivery with its headers,
+body and timing. Each delivery is logged as it arrives and its response
+once sent. Deliveries can be appended to an NDJSON file with --save, which
+only you can read as it holds lead data. Bodies over 5 MiB are refused with
+413 Request Entity Too Large.
+
+The server only listens on 127.0.0.1 unless --host is set, e.g. --host
+0.0.0.0 to receive deliveries from other machines.
+
+Use --status with a comma separated list to respond to successive
+deliveries with different status codes. The last code is repeated once
+the list is used up, so --status 500,500,200 fails twice then succeeds.
+With --secret the Capturoo-Signature header of each delivery is checked.`,
+		Args: cobra.NoArgs,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// prevent root level PersistentPreRun
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			statuses, err := parseStatusList(status)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			rcv := &receiver{out: os.Stdout, statuses: statuses, delay: delay, secret: secret}
+			if saveFile != "" {
+				f, err := os.OpenFile(saveFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", saveFile, err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				rcv.save = f
+			}
+
+			addr := net.JoinHostPort(host, strconv.Itoa(port))
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to listen on %s: %v\n", addr, err)
+				os.Exit(1)
+			}
+			scheme := "http"
+			if tlsSelfSigned {
+				cert, err := selfSignedCertificate()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to generate certificate: %v\n", err)
+					os.Exit(1)
+				}
+				ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+				scheme = "https"
+			}
+
+			hs := &nethttp.Server{Handler: rcv}
+			done := make(chan struct{})
+			go func() {
+				<-cmd.Context().Done()
+				hs.Shutdown(context.Background())
+				close(done)
+			}()
+
+			fmt.Printf("Receiving webhooks on %s://%s (Ctrl-C to stop)\n", scheme, addr)
+			if err := hs.Serve(ln); err != nil && err != nethttp.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			<-done
+		},
+	}
+	cmd.Flags().IntVarP(&port, "port", "p", 8443, "port to listen on")
+	cmd.Flags().StringVar(&host, "host", "127.0.0.1", "address to listen on, 0.0.0.0 for every interface")
+	cmd.Flags().BoolVar(&tlsSelfSigned, "tls-self-signed", false, "serve https using a generated self-signed certificate")
+	cmd.Flags().StringVar(&saveFile, "save", "", "append deliveries to an NDJSON file")
+	cmd.Flags().StringVar(&status, "status", "200", "status code or comma separated sequence of codes to respond with")
+	cmd.Flags().DurationVar(&delay, "delay", 0, "delay before responding")
+	cmd.Flags().StringVar(&secret, "secret", "", "verify delivery signatures with the webhook signing secret")
+	return cmd
+}
+
+// maxReceiveBody is the largest delivery body accepted by the receiver.
+const maxReceiveBody = 5 << 20
+
+// receivedDelivery is a webhook delivery as saved to the NDJSON file.
+type receivedDelivery struct {
+	Received   time.Time      `json:"received"`
+	Method     string         `json:"method"`
+	Path       string         `json:"path"`
+	RemoteAddr string         `json:"remoteAddr"`
+	Headers    nethttp.Header `json:"headers"`
+	Body       interface{}    `json:"body"`
+	Signature  string         `json:"signature,omitempty"`
+	Status     int            `json:"status"`
+	DurationMS int64          `json:"durationMs"`
+}
+
+// receiver is an http.Handler that logs each request and responds with
+// the configured status codes after the configured delay.
+type receiver struct {
+	out      io.Writer
+	save     io.Writer
+	statuses []int
+	delay    time.Duration
+	secret   string
+
+	mu       sync.Mutex
+	n        int
+	accepted int
+}
+
+func (rc *receiver) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	start := time.Now()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReceiveBody+1))
+	if err != nil {
+		nethttp.Error(w, err.Error(), nethttp.StatusBadRequest)
+		return
+	}
+
+	d := &receivedDelivery{
+		Received:   start.UTC(),
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		RemoteAddr: r.RemoteAddr,
+		Headers:    r.Header,
+	}
+	tooLarge := len(body) > maxReceiveBody
+	if tooLarge {
+		body = nil
+		d.Body = fmt.Sprintf("(body over %d bytes not read)", maxReceiveBody)
+	} else if json.Valid(body) {
+		d.Body = json.RawMessage(body)
+	} else {
+		d.Body = string(body)
+	}
+	if rc.secret != "" && !tooLarge {
+		d.Signature = "valid"
+		if err := verify.Verify(body, r.Header.Get(verify.SignatureHeader), rc.secret, verify.DefaultTolerance); err != nil {
+			d.Signature = err.Error()
+		}
+	}
+
+	rc.mu.Lock()
+	rc.n++
+	n := rc.n
+	if tooLarge {
+		d.Status = nethttp.StatusRequestEntityTooLarge
+	} else {
+		d.Status = rc.statuses[len(rc.statuses)-1]
+		if rc.accepted < len(rc.statuses) {
+			d.Status = rc.statuses[rc.accepted]
+		}
+		rc.accepted++
+	}
+	printRequest(rc.out, n, d, body)
+	rc.mu.Unlock()
+
+	if !tooLarge && rc.delay > 0 {
+		select {
+		case <-time.After(rc.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	w.WriteHeader(d.Status)
+	d.DurationMS = time.Since(start).Milliseconds()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	printResponse(rc.out, n, d)
+	if rc.save != nil {
+		if err := json.NewEncoder(rc.save).Encode(d); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save delivery: %v\n", err)
+		}
+	}
+}
+
+// printRequest pretty-prints the delivery headers and body.
+func printRequest(w io.Writer, n int, d *receivedDelivery, body []byte) {
+	fmt.Fprintf(w, "\n#%d %s %s %s from %s\n", n, d.Received.Local().Format("2006-01-02 15:04:05"),
+		d.Method, d.Path, d.RemoteAddr)
+
+	names := make([]string, 0, len(d.Headers))
+	for k := range d.Headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(w, "  %s: %s\n", k, strings.Join(d.Headers[k], ", "))
+	}
+
+	var buf bytes.Buffer
+	if json.Indent(&buf, body, "  ", "  ") == nil {
+		fmt.Fprintf(w, "  %s\n", buf.String())
+	} else if len(body) > 0 {
+		fmt.Fprintf(w, "  %s\n", body)
+	} else if s, ok := d.Body.(string); ok && s != "" {
+		fmt.Fprintf(w, "  %s\n", s)
+	}
+	if d.Signature != "" {
+		fmt.Fprintf(w, "  signature: %s\n", d.Signature)
+	}
+}
+
+// printResponse prints the status and timing of the response to a
+// delivery.
+func printResponse(w io.Writer, n int, d *receivedDelivery) {
+	fmt.Fprintf(w, "#%d <-- %d %s (%dms)\n", n, d.Status, nethttp.StatusText(d.Status), d.DurationMS)
+}
+
+// parseStatusList parses a comma separated list of HTTP status codes.
+func parseStatusList(s string) ([]int, error) {
+	var statuses []int
+	for _, v := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", v)
+		}
+		statuses = append(statuses, code)
+	}
+	if len(statuses) == 0 {
+		return nil, errors.New("no status codes given")
+	}
+	return statuses, nil
+}
+
+// selfSignedCertificate generates a certificate for localhost valid for
+// a day.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Capturoo CLI"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReceiver(t *testing.T) {
+	var out, save bytes.Buffer
+	rc := &receiver{out: &out, save: &save, statuses: []int{500, 200}}
+
+	var got []int
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/hook", strings.NewReader(`{"type":"lead.created"}`))
+		r.Header.Set("Content-Type", "application/json")
+		rc.ServeHTTP(w, r)
+		got = append(got, w.Code)
+	}
+	if want := []int{500, 200, 200}; !reflect.DeepEqual(got, want) {
+		t.Errorf("receiver statuses incorrect, got: %v, want: %v", got, want)
+	}
+
+	dec := json.NewDecoder(&save)
+	var n int
+	for dec.More() {
+		var d receivedDelivery
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+		if d.Path != "/hook" {
+			t.Errorf("saved delivery path incorrect, got: %q, want: %q", d.Path, "/hook")
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("saved deliveries incorrect, got: %d, want: %d", n, 3)
+	}
+
+	log := out.String()
+	for _, want := range []string{"POST /hook from", "  Content-Type: application/json\n", `"type": "lead.created"`, "#1 <-- 500 Internal Server Error (", "#3 <-- 200 OK ("} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log missing %q, got:\n%s", want, log)
+		}
+	}
+}
+
+func TestReceiverTooLarge(t *testing.T) {
+	var out bytes.Buffer
+	rc := &receiver{out: &out, statuses: []int{500, 200}}
+
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest("POST", "/hook", strings.NewReader(strings.Repeat("x", maxReceiveBody+1))))
+	if w.Code != 413 {
+		t.Errorf("status of a large body incorrect, got: %d, want: 413", w.Code)
+	}
+	// a refused delivery does not use up a status
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest("POST", "/hook", strings.NewReader(`{}`)))
+	if w.Code != 500 {
+		t.Errorf("status after a large body incorrect, got: %d, want: 500", w.Code)
+	}
+	if strings.Contains(out.String(), "xxxx") {
+		t.Errorf("log contains the large body")
+	}
+}
+
+func TestParseStatusList(t *testing.T) {
+	if _, err := parseStatusList("500,abc"); err == nil {
+		t.Errorf("parseStatusList(%q) expected an error, got nil", "500,abc")
+	}
+	s, err := parseStatusList("503, 200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, []int{503, 200}) {
+		t.Errorf("parseStatusList incorrect, got: %v", s)
+	}
+}
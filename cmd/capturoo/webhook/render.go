@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/webhook/transform"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookRender returns an instance of the webhook render sub command.
+func NewCmdWebhookRender() *cobra.Command {
+	var eventType, templateFile string
+
+	cmd := &cobra.Command{
+		Use:   "render --template FILE [--event lead.created]",
+		Short: "Preview a webhook transform against a sample event",
+		Long: `Render a webhook transform template against a sample event and print
+the payload that would be delivered. Files ending .jq are jq expressions
+and any other file is a Go template. Both see the event as JSON, so the
+email of a lead is .data.data.email.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if templateFile == "" {
+				return errors.New("set the transform template using --template FILE")
+			}
+			if _, ok := http.DefaultEventCatalogue.Lookup(eventType); !ok {
+				return unknownEventError(http.DefaultEventCatalogue, eventType)
+			}
+			return nil
+		},
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// prevent root level PersistentPreRun
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			tr, err := readTransform(templateFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			events, err := sampleEvents("sample-account", &http.Webhook{}, eventType)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			t, err := transform.Parse(tr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			body, err := t.Render(events[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, body, "", "  "); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(buf.String())
+		},
+	}
+	cmd.Flags().StringVar(&eventType, "event", "lead.created", "event type of the sample event")
+	cmd.Flags().StringVar(&templateFile, "template", "", "transform template file")
+	return cmd
+}
+
+// readTransform reads and parses a transform template file.
+func readTransform(filename string) (*http.WebhookTransform, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tr := &http.WebhookTransform{
+		Language: transform.LanguageForFile(filename),
+		Source:   string(src),
+	}
+	if _, err := transform.Parse(tr); err != nil {
+		return nil, fmt.Errorf("failed to parse transform %s: %w", filename, err)
+	}
+	return tr, nil
+}
+
+// checkTransform renders a sample of each event the webhook subscribes to
+// so that template errors are reported before the webhook is saved.
+func checkTransform(tr *http.WebhookTransform, accountID string, events []string) error {
+	t, err := transform.Parse(tr)
+	if err != nil {
+		return err
+	}
+	samples, err := sampleEvents(accountID, &http.Webhook{Events: events}, "")
+	if err != nil {
+		return err
+	}
+	for _, ev := range samples {
+		if _, err := t.Render(ev); err != nil {
+			return fmt.Errorf("transform failed for a sample %s event: %w", ev.Type, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookSecret returns an instance of the webhook secret sub command.
+func NewCmdWebhookSecret() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manage webhook signing secrets",
+	}
+	cmd.AddCommand(NewCmdWebhookSecretShow())
+	cmd.AddCommand(NewCmdWebhookSecretRotate())
+	return cmd
+}
+
+// NewCmdWebhookSecretShow returns an instance of the webhook secret show sub command.
+func NewCmdWebhookSecretShow() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show WEBHOOK_CODE",
+		Short: "Show the signing secret of a webhook",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing WEBHOOK_CODE argument")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			webhook, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			secret, err := app.Client.GetWebhookSecret(ctx, webhook.WebhookID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to get webhook secret: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(secret.Secret)
+		},
+	}
+	return cmd
+}
+
+// NewCmdWebhookSecretRotate returns an instance of the webhook secret rotate sub command.
+func NewCmdWebhookSecretRotate() *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "rotate WEBHOOK_CODE [--yes]",
+		Short: "Replace the signing secret of a webhook",
+		Long: `Replace the signing secret of a webhook. Deliveries are signed with the new
+secret immediately, so update your consumer with the new secret.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing WEBHOOK_CODE argument")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			webhook, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if !yes {
+				fmt.Printf("Rotate the signing secret of webhook %s? Consumers using the old secret will reject deliveries. [y/N] ", webhook.Code)
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					fmt.Println("Cancelled.")
+					return
+				}
+			}
+			secret, err := app.Client.RotateWebhookSecret(ctx, webhook.WebhookID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to rotate webhook secret: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(secret.Secret)
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "rotate without asking for confirmation")
+	return cmd
+}
+
+// lookupWebhook returns the webhook with the given code.
+func lookupWebhook(ctx context.Context, a *app.Ctx, code string) (*http.Webhook, error) {
+	webhooks, err := a.Client.GetWebhooks(ctx, a.JWTData.CapAID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	for _, w := range webhooks {
+		if w.Code == code {
+			return w, nil
+		}
+	}
+	return nil, fmt.Errorf("webhook %q not found", code)
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"os"
+	"strings"
+	"time"
+
+	"capturoo-cli-tool-go/cmd/capturoo/app"
+	"capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/webhook/transform"
+	"capturoo-cli-tool-go/webhook/verify"
+
+	"github.com/spf13/cobra"
+)
+
+// maxTestBody is the number of bytes of the response body shown.
+const maxTestBody = 1024
+
+// NewCmdWebhookTest returns an instance of the webhook test sub command.
+func NewCmdWebhookTest() *cobra.Command {
+	var eventType string
+	var deliveryTimeout time.Duration
+	var insecure bool
+
+	cmd := &cobra.Command{
+		Use:   "test WEBHOOK_CODE [--event lead.created]",
+		Short: "Send a sample event to a webhook",
+		Long: `Send a signed sample event to the webhook URL directly from the CLI and
+report the response status, latency and body. Without --event a sample is
+sent for each event type the webhook subscribes to. Use --delivery-timeout
+to change how long to wait for the endpoint. Exits non-zero if any
+delivery fails or the endpoint does not respond with a 2xx status. The
+webhook transform, if it has one, is applied to each sample.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 {
+				return errors.New("missing WEBHOOK_CODE argument")
+			}
+			if _, ok := http.DefaultEventCatalogue.Lookup(eventType); eventType != "" && !ok {
+				return unknownEventError(http.DefaultEventCatalogue, eventType)
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			v := ctx.Value(app.ApplicationKey("appk"))
+			if v == nil {
+				fmt.Fprintf(os.Stderr, "failed to get application context")
+				os.Exit(1)
+			}
+			app := v.(*app.Ctx)
+
+			webhook, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			secret, err := app.Client.GetWebhookSecret(ctx, webhook.WebhookID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to get webhook secret: %v\n", err)
+				os.Exit(1)
+			}
+
+			events, err := sampleEvents(app.JWTData.CapAID, webhook, eventType)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
+			client := &nethttp.Client{Timeout: deliveryTimeout}
+			if insecure {
+				client.Transport = &nethttp.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+			}
+			var tr *transform.Transform
+			if webhook.Transform != nil {
+				if tr, err = transform.Parse(webhook.Transform); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to parse webhook transform: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			failed := false
+			for _, ev := range events {
+				var req *nethttp.Request
+				if tr != nil {
+					var body []byte
+					if body, err = tr.Render(ev); err != nil {
+						fmt.Printf("%s  transform FAILED: %v\n", ev.Type, err)
+						failed = true
+						continue
+					}
+					req, err = http.NewWebhookRequestBody(ctx, webhook.URL, ev, body)
+				} else {
+					req, err = http.NewWebhookRequest(ctx, webhook.URL, ev)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				if err := verify.SignRequest(req, secret.Secret); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+
+				start := time.Now()
+				res, err := client.Do(req)
+				latency := time.Since(start).Round(time.Millisecond)
+				if err != nil {
+					fmt.Printf("%s  POST %s  FAILED after %s: %v\n", ev.Type, webhook.URL, latency, err)
+					failed = true
+					continue
+				}
+				body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxTestBody+1))
+				res.Body.Close()
+
+				fmt.Printf("%s  POST %s  %s  %s\n", ev.Type, webhook.URL, res.Status, latency)
+				if len(body) > maxTestBody {
+					body = append(body[:maxTestBody], "..."...)
+				}
+				if len(body) > 0 {
+					fmt.Printf("  %s\n", strings.TrimSpace(string(body)))
+				}
+				if res.StatusCode < 200 || res.StatusCode >= 300 {
+					failed = true
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&eventType, "event", "", "event type to send e.g. lead.created")
+	cmd.Flags().DurationVar(&deliveryTimeout, "delivery-timeout", 10*time.Second, "time to wait for the webhook endpoint to respond")
+	cmd.Flags().BoolVar(&insecure, "insecure", false, "skip TLS certificate verification e.g. for webhook receive --tls-self-signed")
+	return cmd
+}
+
+// sampleEvents returns a sample event for eventType or, if it is empty,
+// for each event type the webhook subscribes to. Lead events use the
+// first bucket code the webhook is bound to.
+func sampleEvents(accountID string, webhook *http.Webhook, eventType string) ([]*http.WebhookEvent, error) {
+	bucketCodes := make(map[string]string)
+	var types []string
+	for _, e := range webhook.Events {
+		parts := strings.SplitN(e, ":", 2)
+		if _, ok := bucketCodes[parts[0]]; !ok {
+			types = append(types, parts[0])
+			bucketCodes[parts[0]] = ""
+		}
+		if len(parts) == 2 && bucketCodes[parts[0]] == "" {
+			bucketCodes[parts[0]] = strings.Split(parts[1], "|")[0]
+		}
+	}
+	if eventType != "" {
+		types = []string{eventType}
+	}
+
+	now := time.Now().UTC()
+	var events []*http.WebhookEvent
+	for _, typ := range types {
+		code := bucketCodes[typ]
+		if code == "" {
+			code = "sample-bucket"
+		}
+
+		var data interface{}
+		switch typ {
+		case "lead.created":
+			data = &http.Lead{
+				LeadID: "lead_sample",
+				System: http.System{
+					ClientVersion: "capturoo-cli",
+					Host:          "www.example.com",
+					Origin:        "https://www.example.com",
+					Referrer:      "https://www.example.com/signup",
+					UserAgent:     "Mozilla/5.0 (X11; Linux x86_64)",
+					RemoteAddr:    "203.0.113.10",
+					Created:       now,
+				},
+				Data: map[string]interface{}{
+					"firstName": "Jane",
+					"lastName":  "Doe",
+					"email":     "jane.doe@example.com",
+				},
+				Tracking: map[string]interface{}{
+					"utm_source":   "newsletter",
+					"utm_campaign": "sample",
+				},
+			}
+		case "bucket.created", "bucket.deleted":
+			data = &http.Bucket{
+				Object:     "bucket",
+				BucketID:   "bucket_sample",
+				AccountID:  accountID,
+				BucketCode: code,
+				BucketName: "Sample Bucket",
+				Created:    now,
+				Modified:   now,
+			}
+		default:
+			return nil, fmt.Errorf("no sample payload for event type %q", typ)
+		}
+
+		ev, err := http.NewWebhookEvent(typ, accountID, code, data)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
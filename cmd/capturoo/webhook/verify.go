@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"capturoo-cli-tool-go/webhook/verify"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCmdWebhookVerify returns an instance of the webhook verify sub command.
+func NewCmdWebhookVerify() *cobra.Command {
+	var secret, payload, signature string
+	var tolerance time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "verify --secret SECRET --payload FILE --signature HEADER",
+		Short: "Verify the signature of a webhook payload",
+		Long: `Verify that HEADER, the value of the Capturoo-Signature header of a
+delivery, is a valid signature of the raw request body in FILE. Use - to
+read the payload from stdin and --tolerance 0 to skip the timestamp check
+when verifying an old delivery.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if secret == "" {
+				return errors.New("set the signing secret using --secret")
+			}
+			if payload == "" {
+				return errors.New("set the payload file using --payload")
+			}
+			if signature == "" {
+				return errors.New("set the signature header value using --signature")
+			}
+			return nil
+		},
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// prevent root level PersistentPreRun
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var body []byte
+			var err error
+			if payload == "-" {
+				body, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				body, err = ioutil.ReadFile(payload)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read payload: %v\n", err)
+				os.Exit(1)
+			}
+
+			if err := verify.Verify(body, signature, secret, tolerance); err != nil {
+				fmt.Fprintf(os.Stderr, "Signature invalid: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("Signature valid.")
+		},
+	}
+	cmd.Flags().StringVar(&secret, "secret", "", "webhook signing secret")
+	cmd.Flags().StringVar(&payload, "payload", "", "file containing the raw request body or - for stdin")
+	cmd.Flags().StringVar(&signature, "signature", "", "value of the Capturoo-Signature header")
+	cmd.Flags().DurationVar(&tolerance, "tolerance", verify.DefaultTolerance, "maximum age of the signature")
+	return cmd
+}
@@ -15,12 +15,6 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var validEvents = []string{
-	"bucket.created",
-	"bucket.deleted",
-	"lead.created",
-}
-
 var codeRegexp = regexp.MustCompile(`^[a-z0-9-]{1,40}$`)
 
 type event struct {
@@ -43,17 +37,28 @@ func NewCmdWebhook() *cobra.Command {
 		Short:   "Manage webhooks",
 	}
 	cmd.AddCommand(NewCmdWebhookCreate())
+	cmd.AddCommand(NewCmdWebhookDeliveries())
+	cmd.AddCommand(NewCmdWebhookEvents())
+	cmd.AddCommand(NewCmdWebhookGet())
 	cmd.AddCommand(NewCmdWebhookList())
+	cmd.AddCommand(NewCmdWebhookListen())
+	cmd.AddCommand(NewCmdWebhookReceive())
+	cmd.AddCommand(NewCmdWebhookRender())
+	cmd.AddCommand(NewCmdWebhookReplay())
+	cmd.AddCommand(NewCmdWebhookSecret())
+	cmd.AddCommand(NewCmdWebhookTest())
 	cmd.AddCommand(NewCmdWebhookUpdate())
 	cmd.AddCommand(NewCmdWebhookDelete())
+	cmd.AddCommand(NewCmdWebhookVerify())
 	return cmd
 }
 
 // NewCmdWebhookCreate returns an instance of the webhook create sub command.
 func NewCmdWebhookCreate() *cobra.Command {
 	var ids, enabled bool
-	var events, url string
+	var events, url, transformFile, idempotencyKey string
 	var evtList []event
+	var tr *http.WebhookTransform
 
 	cmd := &cobra.Command{
 		Use:   "create WEBHOOK_CODE options",
@@ -84,6 +89,13 @@ func NewCmdWebhookCreate() *cobra.Command {
 			if !valid {
 				return errors.New("ENDPOINT must use an https secure url")
 			}
+
+			// transform (optional)
+			if transformFile != "" {
+				if tr, err = readTransform(transformFile); err != nil {
+					return err
+				}
+			}
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
@@ -95,15 +107,43 @@ func NewCmdWebhookCreate() *cobra.Command {
 			}
 			app := v.(*app.Ctx)
 
+			catalogue, _, err := loadEventCatalogue(ctx, app.Client)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if err := checkEvents(catalogue, evtList); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
 			code := args[0]
 			var evs []string
 			for _, v := range evtList {
 				evs = append(evs, v.String())
 			}
 
-			webhook, err := app.Client.CreateWebhook(ctx, app.JWTData.CapAID, code, url, evs, enabled)
+			if tr != nil {
+				if err := checkTransform(tr, app.JWTData.CapAID, evs); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			if idempotencyKey != "" {
+				ctx = http.WithIdempotencyKey(ctx, idempotencyKey)
+			}
+			webhook, err := app.Client.CreateWebhook(ctx, app.JWTData.CapAID, code, url, evs, enabled, tr)
+			if errors.Is(err, http.ErrIdempotencyKeyReused) {
+				fmt.Fprintf(os.Stderr, "Idempotency key %q was already used for a different request.\n", idempotencyKey)
+				os.Exit(1)
+			}
 			if errors.Is(err, http.ErrWebhookResourcesNotFound) {
-				fmt.Fprintf(os.Stderr, "Resources [%s] not found.\n", err)
+				fmt.Fprintf(os.Stderr, "%v\nUse capturoo bucket list to check the bucket codes.\n", err)
+				os.Exit(1)
+			}
+			if errors.Is(err, http.ErrWebhookUnknownEventTypes) {
+				fmt.Fprintf(os.Stderr, "Unknown event types. Use capturoo webhook events to list the event catalogue.\n")
 				os.Exit(1)
 			}
 			if errors.Is(err, http.ErrWebhookURLExists) {
@@ -115,13 +155,16 @@ func NewCmdWebhookCreate() *cobra.Command {
 				os.Exit(1)
 			}
 			if errors.Is(err, http.ErrBadRequest) {
-				fmt.Fprintf(os.Stderr, "Bad request: %v", err)
+				fmt.Fprintf(os.Stderr, "Bad request: %v\n", err)
 				os.Exit(1)
 			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "failed to create webhook: %v\n", err)
 				os.Exit(1)
 			}
+			if webhook.Replayed {
+				fmt.Fprintf(os.Stderr, "Webhook %s was already created by an earlier request with the same idempotency key.\n", webhook.Code)
+			}
 
 			if err := displayWebook(webhook, ids); err != nil {
 				fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -132,6 +175,8 @@ func NewCmdWebhookCreate() *cobra.Command {
 	cmd.Flags().BoolVarP(&ids, "id", "", false, "show internal ids in output (used for diagnostics)")
 	cmd.Flags().StringVarP(&events, "events", "e", "", "target events EVT1[:bucketCode1|bucketCodeN...],EVT2,...")
 	cmd.Flags().StringVarP(&url, "url", "u", "", "ENDPOINT secure url of the webhook handler")
+	cmd.Flags().StringVar(&transformFile, "transform", "", "template FILE to reshape the payload (.jq for jq, otherwise a Go template)")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "KEY making repeats of the command return the webhook it created (default generated)")
 	return cmd
 }
 
@@ -224,26 +269,44 @@ func NewCmdWebhookList() *cobra.Command {
 func NewCmdWebhookUpdate() *cobra.Command {
 	var ids bool
 	var enable, disable bool
-	var events, url string
-	var evtList *[]event
+	var events, addEvents, removeEvents, url, transformFile string
+	var removeTransform bool
+	var evtList, addList, removeList []event
+	var tr *http.WebhookTransform
 
 	cmd := &cobra.Command{
 		Use:   "update WEBHOOK_CODE",
 		Short: "Update webhook",
+		Long: `Update the URL, events or status of a webhook. --events replaces the
+event list. --add-events and --remove-events edit the existing list, so
+--add-events lead.created:winter binds lead.created to the winter bucket
+in addition to any buckets it is already bound to.`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			if len(args) < 1 {
 				return errors.New("missing WEBHOOK_CODE argument")
 			}
 
-			if events == "" && url == "" && !enable && !disable {
-				return errors.New("must set at least one of --events, --url or --enable or --disable flags")
+			if events == "" && addEvents == "" && removeEvents == "" && url == "" && transformFile == "" && !removeTransform && !enable && !disable {
+				return errors.New("must set at least one of --events, --add-events, --remove-events, --url, --transform, --remove-transform or --enable or --disable flags")
 			}
 
 			// events (optional)
+			if events != "" && (addEvents != "" || removeEvents != "") {
+				return errors.New("use either --events or --add-events and --remove-events but not both")
+			}
+			var err error
 			if events != "" {
-				var err error
-				*evtList, err = parseEventArgs(events)
-				if err != nil {
+				if evtList, err = parseEventArgs(events); err != nil {
+					return err
+				}
+			}
+			if addEvents != "" {
+				if addList, err = parseEventArgs(addEvents); err != nil {
+					return err
+				}
+			}
+			if removeEvents != "" {
+				if removeList, err = parseEventArgs(removeEvents); err != nil {
 					return err
 				}
 			}
@@ -264,6 +327,16 @@ func NewCmdWebhookUpdate() *cobra.Command {
 				return errors.New("Use either --enable or --disable but not both")
 			}
 
+			// transform (optional)
+			if transformFile != "" && removeTransform {
+				return errors.New("use either --transform or --remove-transform but not both")
+			}
+			if transformFile != "" {
+				if tr, err = readTransform(transformFile); err != nil {
+					return err
+				}
+			}
+
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
@@ -275,18 +348,63 @@ func NewCmdWebhookUpdate() *cobra.Command {
 			}
 			app := v.(*app.Ctx)
 
+			// ensure the webhook code exists for this user
+			current, err := lookupWebhook(ctx, app, args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+
 			// Set the update parameter set for those fields that need updating
 			var params http.UpdateParamSet
+			if addList != nil || removeList != nil {
+				var existing []event
+				if len(current.Events) > 0 {
+					existing, err = parseEventArgs(strings.Join(current.Events, ","))
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "failed to parse the existing webhook events: %v\n", err)
+						os.Exit(1)
+					}
+				}
+				evtList, err = editEvents(existing, addList, removeList)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+			}
 			if evtList != nil {
-				var events []string
-				for _, event := range *evtList {
-					events = append(events, event.name)
+				catalogue, _, err := loadEventCatalogue(ctx, app.Client)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				if err := checkEvents(catalogue, evtList); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				events := make([]string, 0, len(evtList))
+				for _, e := range evtList {
+					events = append(events, e.String())
 				}
 				params.Events = &events
 			}
 			if url != "" {
 				params.URL = &url
 			}
+			if tr != nil {
+				events := current.Events
+				if params.Events != nil {
+					events = *params.Events
+				}
+				if err := checkTransform(tr, app.JWTData.CapAID, events); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				params.Transform = tr
+			}
+			if removeTransform {
+				params.Transform = &http.WebhookTransform{}
+			}
 			if enable {
 				var en bool = true
 				params.Enabled = &en
@@ -296,23 +414,15 @@ func NewCmdWebhookUpdate() *cobra.Command {
 				params.Enabled = &en
 			}
 
-			// ensure the webhook code exists for this user
-			webhooks, err := app.Client.GetWebhooks(ctx, app.JWTData.CapAID)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "%v\n", err)
+			webhook, err := app.Client.UpdateWebhook(ctx, current.WebhookID, &params)
+			if errors.Is(err, http.ErrWebhookUnknownEventTypes) {
+				fmt.Fprintf(os.Stderr, "Unknown event types. Use capturoo webhook events to list the event catalogue.\n")
 				os.Exit(1)
 			}
-			whash := make(map[string]string, 0)
-			for _, w := range webhooks {
-				whash[w.Code] = w.WebhookID
-			}
-			code := args[0]
-			if _, ok := whash[code]; !ok {
-				fmt.Fprintf(os.Stderr, "Webhook %q not found.\n", code)
+			if errors.Is(err, http.ErrWebhookResourcesNotFound) {
+				fmt.Fprintf(os.Stderr, "%v\nUse capturoo bucket list to check the bucket codes.\n", err)
 				os.Exit(1)
 			}
-
-			webhook, err := app.Client.UpdateWebhook(ctx, whash[code], &params)
 			if errors.Is(err, http.ErrWebhookURLExists) {
 				fmt.Fprintf(os.Stderr, "Webhook URL %s already exists.\n", url)
 				os.Exit(1)
@@ -326,16 +436,17 @@ func NewCmdWebhookUpdate() *cobra.Command {
 				fmt.Fprintf(os.Stderr, "%v\n", err)
 				os.Exit(1)
 			}
-
-			fmt.Println(app)
-			fmt.Println("webhook update...")
 		},
 	}
 	cmd.Flags().BoolVarP(&ids, "id", "", false, "show internal ids in output (used for diagnostics)")
 	cmd.Flags().BoolVarP(&enable, "enable", "", false, "enable the webhook if already disabled")
 	cmd.Flags().BoolVarP(&disable, "disable", "", false, "disable the webhook if already enabled")
-	cmd.Flags().StringVarP(&events, "events", "e", "", "target events EVT1,EVT2,...")
+	cmd.Flags().StringVarP(&events, "events", "e", "", "replace the target events EVT1[:bucketCode1|bucketCodeN...],EVT2,...")
+	cmd.Flags().StringVarP(&addEvents, "add-events", "", "", "add target events or bucket codes EVT1[:bucketCode1|bucketCodeN...],EVT2,...")
+	cmd.Flags().StringVarP(&removeEvents, "remove-events", "", "", "remove target events or bucket codes EVT1[:bucketCode1|bucketCodeN...],EVT2,...")
 	cmd.Flags().StringVarP(&url, "url", "u", "", "ENDPOINT secure url of the webhook handler")
+	cmd.Flags().StringVar(&transformFile, "transform", "", "template FILE to reshape the payload (.jq for jq, otherwise a Go template)")
+	cmd.Flags().BoolVar(&removeTransform, "remove-transform", false, "deliver the event unchanged")
 	return cmd
 }
 
@@ -405,16 +516,20 @@ func displayWebook(webhook *http.Webhook, ids bool) error {
 	fmt.Fprintf(tw, format, "URL: ", webhook.URL)
 	fmt.Fprintf(tw, format, "Events: ", displayEvents(webhook.Events))
 	fmt.Fprintf(tw, format, "Enabled:", enabledDisabled(webhook.Enabled))
+	if webhook.Transform != nil {
+		fmt.Fprintf(tw, format, "Transform:", webhook.Transform.Language)
+	}
 	fmt.Fprintf(tw, format, "Created: ", webhook.Created)
 	fmt.Fprintf(tw, format, "Modified: ", webhook.Modified)
 	return tw.Flush()
 }
 
 func displayEvents(events []string) string {
+	quoted := make([]string, len(events))
 	for i, e := range events {
-		events[i] = fmt.Sprintf("'%s'", e)
+		quoted[i] = fmt.Sprintf("'%s'", e)
 	}
-	return "[" + strings.Join(events, ", ") + "]"
+	return "[" + strings.Join(quoted, ", ") + "]"
 }
 
 func enabledDisabled(t bool) string {
@@ -519,9 +634,6 @@ func parseEventArgs(s string) ([]event, error) {
 				resources: resources,
 			})
 		} else {
-			if v == "lead.created" {
-				return nil, fmt.Errorf("lead.created is a context driven event and must contain a resource name in the form of evt:resource")
-			}
 			ev := event{
 				name: v,
 			}
@@ -531,6 +643,70 @@ func parseEventArgs(s string) ([]event, error) {
 	return events, nil
 }
 
+// editEvents applies --add-events and --remove-events to the existing
+// events. Adding merges bucket codes into an existing event. Removing an
+// event without bucket codes removes it entirely, otherwise only the given
+// bucket codes are removed along with the event once none remain.
+func editEvents(existing, add, remove []event) ([]event, error) {
+	result := make([]event, 0, len(existing)+len(add))
+	for _, e := range existing {
+		result = append(result, event{name: e.name, resources: append([]string(nil), e.resources...)})
+	}
+	index := func(name string) int {
+		for i, e := range result {
+			if e.name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, a := range add {
+		i := index(a.name)
+		if i < 0 {
+			result = append(result, a)
+			continue
+		}
+		for _, r := range a.resources {
+			if !contains(result[i].resources, r) {
+				result[i].resources = append(result[i].resources, r)
+			}
+		}
+	}
+
+	for _, r := range remove {
+		i := index(r.name)
+		if i < 0 {
+			return nil, fmt.Errorf("webhook is not subscribed to event %q", r.name)
+		}
+		if len(r.resources) == 0 {
+			result = append(result[:i], result[i+1:]...)
+			continue
+		}
+		kept := make([]string, 0, len(result[i].resources))
+		for _, code := range result[i].resources {
+			if !contains(r.resources, code) {
+				kept = append(kept, code)
+			}
+		}
+		for _, code := range r.resources {
+			if !contains(result[i].resources, code) {
+				return nil, fmt.Errorf("event %q is not bound to bucket %q", r.name, code)
+			}
+		}
+		if len(kept) == 0 {
+			result = append(result[:i], result[i+1:]...)
+			continue
+		}
+		result[i].resources = kept
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("a webhook must subscribe to at least one event")
+	}
+	return result, nil
+}
+
 // func unknownEvents(events []string) []string {
 // 	var unknowns []string
 // 	for _, v := range events {
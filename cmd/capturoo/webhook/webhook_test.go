@@ -1,8 +1,16 @@
 package webhook
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+
+	"capturoo-cli-tool-go/http"
 )
 
 func TestDisplayEvents(t *testing.T) {
@@ -130,3 +138,189 @@ func TestContains(t *testing.T) {
 		t.Errorf("contains(%q) incorrect, got: %t, want: %t", fruits, result, false)
 	}
 }
+
+func TestSampleEvents(t *testing.T) {
+	webhook := &http.Webhook{
+		Events: []string{"bucket.created", "lead.created:summer|winter"},
+	}
+	events, err := sampleEvents("acc1", webhook, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ev := range events {
+		got = append(got, ev.Type+" "+ev.BucketCode)
+	}
+	want := []string{"bucket.created sample-bucket", "lead.created summer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sampleEvents incorrect, got: %v, want: %v", got, want)
+	}
+
+	// the sample lead uses the documented keys of the CRM export mappings
+	var lead http.Lead
+	if err := json.Unmarshal(events[1].Data, &lead); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range http.DefaultFieldMappings["hubspot-csv"][:3] {
+		if _, ok := lead.Data[m.Field]; !ok {
+			t.Errorf("sample lead has no %q key, got: %v", m.Field, lead.Data)
+		}
+	}
+
+	events, err = sampleEvents("acc1", webhook, "bucket.deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != "bucket.deleted" {
+		t.Errorf("sampleEvents with event type incorrect, got: %v", events)
+	}
+}
+
+func TestFailedDeliveries(t *testing.T) {
+	deliveries := []*http.Delivery{
+		{DeliveryID: "d4", EventID: "e1", StatusCode: 200},
+		{DeliveryID: "d3", EventID: "e2", StatusCode: 500},
+		{DeliveryID: "d2", EventID: "e1", StatusCode: 503},
+		{DeliveryID: "d1", EventID: "e3", Error: "connection refused"},
+	}
+	want := []string{"d3", "d1"}
+	if got := failedDeliveries(deliveries); !reflect.DeepEqual(got, want) {
+		t.Errorf("failedDeliveries incorrect, got: %v, want: %v", got, want)
+	}
+}
+
+func TestResolveEvents(t *testing.T) {
+	summer := &http.Bucket{BucketID: "b1", BucketCode: "summer", BucketName: "Summer"}
+	buckets := []*http.Bucket{summer, {BucketID: "b2", BucketCode: "winter"}}
+
+	got := resolveEvents([]string{"bucket.created", "lead.created:summer|autumn"}, buckets)
+	want := []resolvedEvent{
+		{name: "bucket.created"},
+		{name: "lead.created", resources: []resolvedResource{
+			{code: "summer", bucket: summer},
+			{code: "autumn"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveEvents incorrect, got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestCheckEvents(t *testing.T) {
+	tests := []struct {
+		events  string
+		wantErr string
+	}{
+		{"bucket.created,lead.created:summer", ""},
+		{"bucket.creatd", `unknown event type "bucket.creatd" (did you mean "bucket.created"?)`},
+		{"lead.created", "lead.created is a context driven event and must contain a resource name in the form of lead.created:bucket-code"},
+		{"bucket.deleted:summer", "bucket.deleted does not take bucket codes"},
+	}
+	for _, tc := range tests {
+		events, err := parseEventArgs(tc.events)
+		if err != nil {
+			t.Fatalf("parseEventArgs(%q) returned an error: %v", tc.events, err)
+		}
+		err = checkEvents(http.DefaultEventCatalogue, events)
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("checkEvents(%q) returned an error: %v", tc.events, err)
+		}
+		if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+			t.Errorf("checkEvents(%q) incorrect, got: %v, want: %s", tc.events, err, tc.wantErr)
+		}
+	}
+}
+
+func TestEditEvents(t *testing.T) {
+	existing, err := parseEventArgs("bucket.created,lead.created:summer|winter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		add, remove string
+		want        []string
+		wantErr     bool
+	}{
+		{add: "lead.created:autumn", want: []string{"bucket.created", "lead.created:summer|winter|autumn"}},
+		{add: "bucket.deleted,lead.created:summer", want: []string{"bucket.created", "lead.created:summer|winter", "bucket.deleted"}},
+		{remove: "lead.created:winter", want: []string{"bucket.created", "lead.created:summer"}},
+		{remove: "lead.created:summer|winter", want: []string{"bucket.created"}},
+		{remove: "bucket.created", want: []string{"lead.created:summer|winter"}},
+		{add: "lead.created:autumn", remove: "lead.created:summer", want: []string{"bucket.created", "lead.created:winter|autumn"}},
+		{remove: "bucket.deleted", wantErr: true},
+		{remove: "lead.created:spring", wantErr: true},
+		{remove: "bucket.created,lead.created", wantErr: true},
+	}
+	for _, tc := range tests {
+		var add, remove []event
+		if tc.add != "" {
+			if add, err = parseEventArgs(tc.add); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tc.remove != "" {
+			if remove, err = parseEventArgs(tc.remove); err != nil {
+				t.Fatal(err)
+			}
+		}
+		result, err := editEvents(existing, add, remove)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("editEvents(add=%q, remove=%q) expected an error", tc.add, tc.remove)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("editEvents(add=%q, remove=%q) returned an error: %v", tc.add, tc.remove, err)
+			continue
+		}
+		var got []string
+		for _, e := range result {
+			got = append(got, e.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("editEvents(add=%q, remove=%q) incorrect, got: %v, want: %v", tc.add, tc.remove, got, tc.want)
+		}
+	}
+	if existing[1].String() != "lead.created:summer|winter" {
+		t.Errorf("editEvents modified the existing events, got: %v", existing)
+	}
+}
+
+func TestLoadEventCatalogue(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantSource string
+		wantErr    bool
+	}{
+		{"api", 200, `{"object":"eventCatalogue","version":"2","events":[{"name":"bucket.created"}]}`, "api", false},
+		{"no route", 404, `404 page not found`, "built-in", false},
+		{"unauthorized", 401, `{"status":401,"code":"auth/unauthorized","message":"unauthorized"}`, "", true},
+		{"server error", 500, `{"status":500,"code":"internal","message":"internal error"}`, "", true},
+	}
+	for _, tc := range tests {
+		ts := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			if tc.status != 404 {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			w.WriteHeader(tc.status)
+			io.WriteString(w, tc.body)
+		}))
+		client := http.NewClient(ts.URL)
+		client.Retry = http.RetryPolicy{}
+		catalogue, source, err := loadEventCatalogue(context.Background(), client)
+		ts.Close()
+		if (err != nil) != tc.wantErr || source != tc.wantSource {
+			t.Errorf("%s: loadEventCatalogue incorrect, got: %q, %v, want: %q, error: %t", tc.name, source, err, tc.wantSource, tc.wantErr)
+		}
+		if tc.wantSource == "built-in" && catalogue != http.DefaultEventCatalogue {
+			t.Errorf("%s: expected the built-in catalogue", tc.name)
+		}
+		if tc.wantErr && errors.Is(err, http.ErrEventCatalogueUnsupported) {
+			t.Errorf("%s: error reported as unsupported: %v", tc.name, err)
+		}
+	}
+}
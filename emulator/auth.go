@@ -0,0 +1,223 @@
+package emulator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	capturoo "capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/internal"
+)
+
+const (
+	customTokenPrefix  = "emulator-custom-token:"
+	refreshTokenPrefix = "emulator-refresh-token:"
+)
+
+// claims are the Firebase ID token claims read by the CLI.
+type claims struct {
+	Name      string `json:"name,omitempty"`
+	CapAID    string `json:"cap_aid"`
+	CapRole   string `json:"cap_role"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email,omitempty"`
+	Audience  string `json:"aud"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+}
+
+// idToken returns an unsigned JWT for the account. The emulator does not
+// sign tokens as the CLI never verifies them.
+func (s *Server) idToken() string {
+	acc := s.st.Account
+	now := time.Now()
+	c := claims{
+		Name:      acc.DisplayName,
+		CapAID:    acc.AccountID,
+		CapRole:   acc.Role,
+		UserID:    acc.UID,
+		Email:     acc.Email,
+		Audience:  ProjectID,
+		ExpiresAt: now.Add(tokenLifetime).Unix(),
+		IssuedAt:  now.Unix(),
+		Issuer:    "https://securetoken.google.com/" + ProjectID,
+		Subject:   acc.UID,
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+// IDToken returns a valid ID token for the emulator account so that tests
+// can skip signing in.
+func (s *Server) IDToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idToken()
+}
+
+// authenticated reports whether the request carries a bearer token issued
+// by the emulator that has not expired.
+func (s *Server) authenticated(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	var c claims
+	if err := json.Unmarshal(b, &c); err != nil {
+		return false
+	}
+	return c.CapAID == s.st.Account.AccountID && c.ExpiresAt > time.Now().Unix()
+}
+
+func (s *Server) autoConf(w http.ResponseWriter, r *http.Request) {
+	var ac capturoo.AutoConf
+	ac.Object = "autoconf"
+	ac.Data.FirebaseConfig = &capturoo.FirebaseConfig{
+		APIKey:     APIKey,
+		AuthDomain: ProjectID + ".firebaseapp.com",
+		ProjectID:  ProjectID,
+	}
+	ac.Data.AuthEmulatorHost = r.Host
+	writeJSON(w, http.StatusOK, ac)
+}
+
+func (s *Server) signInWithDevKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DeveloperKey string `json:"developerKey"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	acc := s.st.Account
+	if req.DeveloperKey != acc.DeveloperKey {
+		writeError(w, http.StatusUnauthorized, internal.ErrCodeAuthenticationFailed, "developer key not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		CustomToken string            `json:"customToken"`
+		Account     *capturoo.Account `json:"account"`
+	}{
+		CustomToken: customTokenPrefix + acc.UID,
+		Account: &capturoo.Account{
+			Object:      "account",
+			AccountID:   acc.AccountID,
+			UID:         acc.UID,
+			Role:        acc.Role,
+			Email:       acc.Email,
+			DisplayName: acc.DisplayName,
+		},
+	})
+}
+
+// serveFirebase serves the subset of the Firebase Auth REST API used by
+// the fbauth package.
+func (s *Server) serveFirebase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		firebaseError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED")
+		return
+	}
+	if r.URL.Query().Get("key") != APIKey {
+		firebaseError(w, http.StatusBadRequest, "API_KEY_INVALID")
+		return
+	}
+	acc := s.st.Account
+
+	switch r.URL.Path {
+	case "/identitytoolkit.googleapis.com/v1/accounts:signInWithPassword":
+		var req struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			firebaseError(w, http.StatusBadRequest, "INVALID_JSON")
+			return
+		}
+		if req.Email != acc.Email {
+			firebaseError(w, http.StatusBadRequest, "EMAIL_NOT_FOUND")
+			return
+		}
+		if req.Password != acc.Password {
+			firebaseError(w, http.StatusBadRequest, "INVALID_PASSWORD")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":         "identitytoolkit#VerifyPasswordResponse",
+			"idToken":      s.idToken(),
+			"email":        acc.Email,
+			"refreshToken": refreshTokenPrefix + acc.UID,
+			"expiresIn":    fmt.Sprint(int(tokenLifetime.Seconds())),
+			"localId":      acc.UID,
+			"registered":   true,
+		})
+	case "/www.googleapis.com/identitytoolkit/v3/relyingparty/verifyCustomToken":
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			firebaseError(w, http.StatusBadRequest, "INVALID_JSON")
+			return
+		}
+		if req.Token != customTokenPrefix+acc.UID {
+			firebaseError(w, http.StatusBadRequest, "INVALID_CUSTOM_TOKEN")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"kind":         "identitytoolkit#VerifyCustomTokenResponse",
+			"idToken":      s.idToken(),
+			"refreshToken": refreshTokenPrefix + acc.UID,
+			"expiresIn":    fmt.Sprint(int(tokenLifetime.Seconds())),
+		})
+	case "/securetoken.googleapis.com/v1/token":
+		if err := r.ParseForm(); err != nil {
+			firebaseError(w, http.StatusBadRequest, "INVALID_REQUEST")
+			return
+		}
+		if r.PostForm.Get("grant_type") != "refresh_token" {
+			firebaseError(w, http.StatusBadRequest, "INVALID_GRANT_TYPE")
+			return
+		}
+		if r.PostForm.Get("refresh_token") != refreshTokenPrefix+acc.UID {
+			firebaseError(w, http.StatusBadRequest, "INVALID_REFRESH_TOKEN")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"expires_in":    fmt.Sprint(int(tokenLifetime.Seconds())),
+			"token_type":    "Bearer",
+			"refresh_token": refreshTokenPrefix + acc.UID,
+			"id_token":      s.idToken(),
+			"user_id":       acc.UID,
+			"project_id":    ProjectID,
+		})
+	default:
+		firebaseError(w, http.StatusNotFound, "NOT_FOUND")
+	}
+}
+
+// firebaseError writes an error in the format of the Firebase REST API.
+func firebaseError(w http.ResponseWriter, status int, message string) {
+	var res struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	res.Error.Code = status
+	res.Error.Message = message
+	writeJSON(w, status, res)
+}
@@ -0,0 +1,232 @@
+package emulator
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	capturoo "capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/internal"
+	"capturoo-cli-tool-go/webhook/transform"
+	"capturoo-cli-tool-go/webhook/verify"
+)
+
+// maxDeliveries is the number of delivery attempts kept per webhook.
+const maxDeliveries = 1000
+
+// deliveryClient posts events to webhook endpoints. Certificates are not
+// verified so that local receivers with self-signed certificates work.
+var deliveryClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// pendingDelivery is an event waiting to be delivered to a webhook once
+// the request that caused it has released the lock.
+type pendingDelivery struct {
+	webhookID string
+	url       string
+	secret    string
+	attempt   int
+	event     *capturoo.WebhookEvent
+	transform *capturoo.WebhookTransform
+}
+
+// emit queues the event for each enabled webhook subscribed to it.
+func (s *Server) emit(eventType, bucketCode string, data interface{}) {
+	var targets []*capturoo.Webhook
+	for _, wh := range s.st.Webhooks {
+		if wh.Enabled && subscribed(wh.Events, eventType, bucketCode) {
+			targets = append(targets, wh)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Code < targets[j].Code })
+
+	ev, err := capturoo.NewWebhookEvent(eventType, s.st.Account.AccountID, bucketCode, data)
+	if err != nil {
+		return
+	}
+	s.st.Events[ev.EventID] = ev
+	for _, wh := range targets {
+		s.pending = append(s.pending, s.newPendingDelivery(wh, ev, 1))
+	}
+}
+
+func (s *Server) newPendingDelivery(wh *capturoo.Webhook, ev *capturoo.WebhookEvent, attempt int) *pendingDelivery {
+	secret, ok := s.st.Secrets[wh.WebhookID]
+	if !ok {
+		secret = s.newWebhookSecret(wh.WebhookID)
+	}
+	return &pendingDelivery{
+		webhookID: wh.WebhookID,
+		url:       wh.URL,
+		secret:    secret.Secret,
+		attempt:   attempt,
+		event:     ev,
+		transform: wh.Transform,
+	}
+}
+
+// deliver posts the event to the webhook and records the attempt. It must
+// be called without holding the lock.
+func (s *Server) deliver(p *pendingDelivery) *capturoo.Delivery {
+	d := &capturoo.Delivery{
+		Object:     "delivery",
+		DeliveryID: "dlv_" + newID(20),
+		WebhookID:  p.webhookID,
+		EventID:    p.event.EventID,
+		EventType:  p.event.Type,
+		URL:        p.url,
+		Attempt:    p.attempt,
+		Created:    time.Now().UTC(),
+	}
+
+	start := time.Now()
+	req, err := newDeliveryRequest(p)
+	if err == nil {
+		err = verify.SignRequest(req, p.secret)
+	}
+	if err == nil {
+		var res *http.Response
+		res, err = deliveryClient.Do(req)
+		if err == nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			d.StatusCode = res.StatusCode
+		}
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	d.DurationMS = time.Since(start).Milliseconds()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.st.Webhooks[p.webhookID]; ok {
+		list := append([]*capturoo.Delivery{d}, s.st.Deliveries[p.webhookID]...)
+		if len(list) > maxDeliveries {
+			list = list[:maxDeliveries]
+		}
+		s.st.Deliveries[p.webhookID] = list
+		s.save()
+	}
+	return d
+}
+
+// newDeliveryRequest returns the request for the delivery applying the
+// webhook transform if it has one.
+func newDeliveryRequest(p *pendingDelivery) (*http.Request, error) {
+	if p.transform == nil {
+		return capturoo.NewWebhookRequest(context.Background(), p.url, p.event)
+	}
+	t, err := transform.Parse(p.transform)
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	body, err := t.Render(p.event)
+	if err != nil {
+		return nil, fmt.Errorf("transform: %w", err)
+	}
+	return capturoo.NewWebhookRequestBody(context.Background(), p.url, p.event, body)
+}
+
+func (s *Server) getWebhookDeliveries(w http.ResponseWriter, r *http.Request, webhookID string) {
+	if _, ok := s.st.Webhooks[webhookID]; !ok {
+		webhookNotFound(w, webhookID)
+		return
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, fmt.Sprintf("invalid since %q", v))
+			return
+		}
+	}
+	failed := r.URL.Query().Get("failed") == "true"
+
+	deliveries := make([]*capturoo.Delivery, 0)
+	for _, d := range s.st.Deliveries[webhookID] {
+		if failed && d.Succeeded() {
+			continue
+		}
+		if !since.IsZero() && d.Created.Before(since) {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Object string               `json:"object"`
+		Data   []*capturoo.Delivery `json:"data"`
+	}{"list", deliveries})
+}
+
+// replayWebhookDelivery redelivers the event of a delivery responding with
+// the new attempt once it has completed.
+func (s *Server) replayWebhookDelivery(w http.ResponseWriter, r *http.Request, webhookID, deliveryID string) {
+	s.mu.Lock()
+	wh, ok := s.st.Webhooks[webhookID]
+	if !ok {
+		s.mu.Unlock()
+		webhookNotFound(w, webhookID)
+		return
+	}
+	var prev *capturoo.Delivery
+	attempts := 0
+	for _, d := range s.st.Deliveries[webhookID] {
+		if d.DeliveryID == deliveryID {
+			prev = d
+		}
+	}
+	var ev *capturoo.WebhookEvent
+	if prev != nil {
+		ev = s.st.Events[prev.EventID]
+		for _, d := range s.st.Deliveries[webhookID] {
+			if d.EventID == prev.EventID && d.Attempt > attempts {
+				attempts = d.Attempt
+			}
+		}
+	}
+	if ev == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, internal.ErrCodeWebhookDeliveryNotFound,
+			fmt.Sprintf("delivery %q not found", deliveryID))
+		return
+	}
+	p := s.newPendingDelivery(wh, ev, attempts+1)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.deliver(p))
+}
+
+// subscribed reports whether the webhook events include the event type,
+// for lead events only when bound to the bucket code.
+func subscribed(events []string, eventType, bucketCode string) bool {
+	for _, e := range events {
+		parts := strings.SplitN(e, ":", 2)
+		if parts[0] != eventType {
+			continue
+		}
+		if len(parts) == 1 {
+			return true
+		}
+		for _, code := range strings.Split(parts[1], "|") {
+			if code == bucketCode {
+				return true
+			}
+		}
+	}
+	return false
+}
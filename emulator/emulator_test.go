@@ -0,0 +1,245 @@
+package emulator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"capturoo-cli-tool-go/fbauth"
+	capturoo "capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/webhook/verify"
+)
+
+// signIn signs in to the emulator with the developer key and returns a
+// client using the resulting ID token.
+func signIn(t *testing.T, srv *Server, endpoint string) *capturoo.Client {
+	t.Helper()
+	client := capturoo.NewClient(endpoint)
+	ac, err := client.AutoConf(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, account, err := client.SignInWithDevKey(context.Background(), srv.Account().DeveloperKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.AccountID != srv.Account().AccountID {
+		t.Errorf("account.AccountID incorrect, got: %q, want: %q", account.AccountID, srv.Account().AccountID)
+	}
+
+	auth := fbauth.NewRESTClient()
+	auth.UseEmulator(ac.Data.AuthEmulatorHost)
+	tart, err := auth.ExchangeCustomTokenForIDAndRefreshToken(context.Background(), ac.Data.FirebaseConfig.APIKey, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tart, err = auth.ExchangeRefreshTokenForIDToken(context.Background(), ac.Data.FirebaseConfig.APIKey, tart.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.JWT = tart.IDToken
+	return client
+}
+
+func TestEmulator(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "state.json")
+	srv, err := NewServer(Options{DataFile: dataFile, DeveloperKey: "dk_test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := signIn(t, srv, ts.URL)
+	accountID := srv.Account().AccountID
+
+	b, err := client.CreateBucket(ctx, accountID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateBucket(ctx, accountID, "summer", "Again"); !errors.Is(err, capturoo.ErrBucketCodeExists) {
+		t.Errorf("CreateBucket duplicate code error incorrect, got: %v, want: %v", err, capturoo.ErrBucketCodeExists)
+	}
+
+	kctx := capturoo.WithIdempotencyKey(ctx, "key-1")
+	first, err := client.CreateBucket(kctx, accountID, "autumn", "Autumn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := client.CreateBucket(kctx, accountID, "autumn", "Autumn")
+	if err != nil {
+		t.Fatalf("CreateBucket with a repeated idempotency key failed: %v", err)
+	}
+	if first.Replayed || !again.Replayed || again.BucketID != first.BucketID {
+		t.Errorf("CreateBucket replay incorrect, got: %s (replayed %t), want: %s (replayed true)", again.BucketID, again.Replayed, first.BucketID)
+	}
+	if _, err := client.CreateBucket(kctx, accountID, "winter", "Winter"); !errors.Is(err, capturoo.ErrIdempotencyKeyReused) {
+		t.Errorf("CreateBucket reused idempotency key error incorrect, got: %v, want: %v", err, capturoo.ErrIdempotencyKeyReused)
+	}
+
+	leads := []*capturoo.Lead{
+		{LeadID: "lead1", Data: map[string]interface{}{"email": "a@example.com"}},
+		{Data: map[string]interface{}{"email": "b@example.com"}},
+	}
+	n, err := client.ImportLeads(ctx, b.BucketID, leads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("ImportLeads imported incorrect, got: %d, want: %d", n, 2)
+	}
+
+	if _, err := client.CreateWebhook(ctx, accountID, "crm", "https://example.com/crm", []string{"lead.created:winter"}, true, nil); !errors.Is(err, capturoo.ErrWebhookResourcesNotFound) {
+		t.Errorf("CreateWebhook unknown bucket error incorrect, got: %v, want: %v", err, capturoo.ErrWebhookResourcesNotFound)
+	}
+	if _, err := client.CreateWebhook(ctx, accountID, "crm", "https://example.com/crm", []string{"bucket.creatd"}, true, nil); !errors.Is(err, capturoo.ErrWebhookUnknownEventTypes) {
+		t.Errorf("CreateWebhook unknown event type error incorrect, got: %v, want: %v", err, capturoo.ErrWebhookUnknownEventTypes)
+	}
+	catalogue, err := client.GetEventCatalogue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalogue.Version != capturoo.DefaultEventCatalogue.Version || len(catalogue.Events) != len(capturoo.DefaultEventCatalogue.Events) {
+		t.Errorf("GetEventCatalogue incorrect, got: %+v", catalogue)
+	}
+	wh, err := client.CreateWebhook(ctx, accountID, "crm", "https://example.com/crm", []string{"lead.created:summer"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.GetWebhookSecret(ctx, wh.WebhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := client.RotateWebhookSecret(ctx, wh.WebhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Secret == secret.Secret {
+		t.Errorf("RotateWebhookSecret returned the previous secret %q", secret.Secret)
+	}
+
+	// reload the state from file
+	srv, err = NewServer(Options{DataFile: dataFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts2 := httptest.NewServer(srv)
+	defer ts2.Close()
+	client = signIn(t, srv, ts2.URL)
+
+	var ids []string
+	err = client.ForEachLead(ctx, b.BucketID, func(l *capturoo.Lead) error {
+		ids = append(ids, l.LeadID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != "lead1" {
+		t.Errorf("ForEachLead lead IDs incorrect, got: %v", ids)
+	}
+	webhooks, err := client.GetWebhooks(ctx, accountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 1 || webhooks[0].Code != "crm" {
+		t.Errorf("GetWebhooks incorrect, got: %v", webhooks)
+	}
+}
+
+func TestEmulatorUnauthenticated(t *testing.T) {
+	srv, err := NewServer(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/buckets", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /buckets without a valid token status incorrect, got: %d, want: %d", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	client := capturoo.NewClient(ts.URL)
+	client.JWT = "not-a-token"
+	_, err = client.CreateBucket(context.Background(), "acc", "summer", "Summer")
+	if !errors.Is(err, capturoo.ErrAuthenticationFailed) {
+		t.Errorf("CreateBucket without a valid token error incorrect, got: %v, want: %v", err, capturoo.ErrAuthenticationFailed)
+	}
+	var apiErr *capturoo.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized || apiErr.RequestID == "" {
+		t.Errorf("CreateBucket without a valid token APIError incorrect, got: %#v", apiErr)
+	}
+}
+
+func TestEmulatorDeliveries(t *testing.T) {
+	srv, err := NewServer(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// the consumer is down for the first delivery
+	var calls int
+	consumer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get(verify.SignatureHeader) == "" {
+			t.Errorf("delivery missing %s header", verify.SignatureHeader)
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer consumer.Close()
+
+	ctx := context.Background()
+	client := capturoo.NewClient(ts.URL)
+	client.JWT = srv.IDToken()
+	accountID := srv.Account().AccountID
+
+	b, err := client.CreateBucket(ctx, accountID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wh, err := client.CreateWebhook(ctx, accountID, "crm", consumer.URL, []string{"lead.created:summer"}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*capturoo.Lead{{LeadID: "lead1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := client.GetWebhookDeliveries(ctx, wh.WebhookID, &capturoo.DeliveryListOptions{Failed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("GetWebhookDeliveries failed incorrect, got: %v", deliveries)
+	}
+
+	d, err := client.ReplayWebhookDelivery(ctx, wh.WebhookID, deliveries[0].DeliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Succeeded() || d.Attempt != 2 || d.EventID != deliveries[0].EventID {
+		t.Errorf("ReplayWebhookDelivery incorrect, got: %+v", d)
+	}
+	deliveries, err = client.GetWebhookDeliveries(ctx, wh.WebhookID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].DeliveryID != d.DeliveryID {
+		t.Errorf("GetWebhookDeliveries incorrect, got: %v", deliveries)
+	}
+}
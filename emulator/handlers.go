@@ -0,0 +1,450 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	capturoo "capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/internal"
+	"capturoo-cli-tool-go/webhook/transform"
+)
+
+func (s *Server) getBuckets(w http.ResponseWriter, r *http.Request) {
+	buckets := make([]*capturoo.Bucket, 0, len(s.st.Buckets))
+	for _, b := range s.st.Buckets {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].BucketCode < buckets[j].BucketCode
+	})
+	writeJSON(w, http.StatusOK, struct {
+		Object string             `json:"object"`
+		Data   []*capturoo.Bucket `json:"data"`
+	}{"list", buckets})
+}
+
+func (s *Server) createBucket(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AccountID  string `json:"accountId"`
+		BucketCode string `json:"bucketCode"`
+		BucketName string `json:"bucketName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	if req.BucketCode == "" {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, "bucketCode is required")
+		return
+	}
+	if s.bucketByCode(req.BucketCode) != nil {
+		writeError(w, http.StatusConflict, internal.ErrCodeBucketCodeExists,
+			fmt.Sprintf("bucket code %q already exists", req.BucketCode))
+		return
+	}
+
+	now := time.Now().UTC()
+	b := &capturoo.Bucket{
+		Object:       "bucket",
+		BucketID:     newID(20),
+		AccountID:    s.st.Account.AccountID,
+		BucketCode:   req.BucketCode,
+		BucketName:   req.BucketName,
+		PublicAPIKey: "pk_" + newID(32),
+		Created:      now,
+		Modified:     now,
+	}
+	s.st.Buckets[b.BucketID] = b
+	if !s.commit(w) {
+		return
+	}
+	s.emit("bucket.created", b.BucketCode, b)
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (s *Server) getBucket(w http.ResponseWriter, r *http.Request, bucketID string) {
+	b, ok := s.st.Buckets[bucketID]
+	if !ok {
+		bucketNotFound(w, bucketID)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) updateBucket(w http.ResponseWriter, r *http.Request, bucketID string) {
+	b, ok := s.st.Buckets[bucketID]
+	if !ok {
+		bucketNotFound(w, bucketID)
+		return
+	}
+	var req struct {
+		BucketName string `json:"bucketName"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	b.BucketName = req.BucketName
+	b.Modified = time.Now().UTC()
+	if !s.commit(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) deleteBucket(w http.ResponseWriter, r *http.Request, bucketID string) {
+	b, ok := s.st.Buckets[bucketID]
+	if !ok {
+		bucketNotFound(w, bucketID)
+		return
+	}
+	delete(s.st.Buckets, bucketID)
+	delete(s.st.Leads, bucketID)
+	if !s.commit(w) {
+		return
+	}
+	s.emit("bucket.deleted", b.BucketCode, b)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getLeads(w http.ResponseWriter, r *http.Request) {
+	bucketID := r.URL.Query().Get("bucketId")
+	if _, ok := s.st.Buckets[bucketID]; !ok {
+		bucketNotFound(w, bucketID)
+		return
+	}
+	leads := s.st.Leads[bucketID]
+	if v := r.URL.Query().Get("createdAfter"); v != "" {
+		after, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, "createdAfter must be an RFC 3339 time")
+			return
+		}
+		var created []*capturoo.Lead
+		for _, l := range leads {
+			if l.System.Created.After(after) {
+				created = append(created, l)
+			}
+		}
+		leads = created
+	}
+	if leads == nil {
+		leads = make([]*capturoo.Lead, 0)
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Object string           `json:"object"`
+		Data   []*capturoo.Lead `json:"data"`
+	}{"list", leads})
+}
+
+func (s *Server) importLeads(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BucketID string           `json:"bucketId"`
+		Leads    []*capturoo.Lead `json:"leads"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	b, ok := s.st.Buckets[req.BucketID]
+	if !ok {
+		bucketNotFound(w, req.BucketID)
+		return
+	}
+
+	// Lead IDs are preserved unless they are missing or already taken.
+	existing := make(map[string]bool)
+	for _, l := range s.st.Leads[req.BucketID] {
+		existing[l.LeadID] = true
+	}
+	now := time.Now().UTC()
+	for _, l := range req.Leads {
+		if l.LeadID == "" || existing[l.LeadID] {
+			l.LeadID = newID(20)
+		}
+		existing[l.LeadID] = true
+		if l.System.Created.IsZero() {
+			l.System.Created = now
+		}
+		s.st.Leads[req.BucketID] = append(s.st.Leads[req.BucketID], l)
+	}
+	if !s.commit(w) {
+		return
+	}
+	for _, l := range req.Leads {
+		s.emit("lead.created", b.BucketCode, l)
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Object   string `json:"object"`
+		Imported int    `json:"imported"`
+	}{"import", len(req.Leads)})
+}
+
+func (s *Server) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := make([]*capturoo.Webhook, 0, len(s.st.Webhooks))
+	for _, wh := range s.st.Webhooks {
+		webhooks = append(webhooks, wh)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].Code < webhooks[j].Code
+	})
+	writeJSON(w, http.StatusOK, struct {
+		Object string              `json:"object"`
+		Data   []*capturoo.Webhook `json:"data"`
+	}{"list", webhooks})
+}
+
+func (s *Server) getEventCatalogue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, capturoo.DefaultEventCatalogue)
+}
+
+func (s *Server) getWebhook(w http.ResponseWriter, r *http.Request, webhookID string) {
+	wh, ok := s.st.Webhooks[webhookID]
+	if !ok {
+		webhookNotFound(w, webhookID)
+		return
+	}
+	writeJSON(w, http.StatusOK, wh)
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AccountID   string   `json:"accountId"`
+		WebhookCode string   `json:"webhookCode"`
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+		Enabled     bool     `json:"enabled"`
+
+		Transform *capturoo.WebhookTransform `json:"transform"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	if req.WebhookCode == "" || req.URL == "" {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, "webhookCode and url are required")
+		return
+	}
+	for _, wh := range s.st.Webhooks {
+		if wh.Code == req.WebhookCode {
+			writeError(w, http.StatusConflict, internal.ErrCodeWebhookCodeExists,
+				fmt.Sprintf("webhook code %q already exists", req.WebhookCode))
+			return
+		}
+		if wh.URL == req.URL {
+			writeError(w, http.StatusConflict, internal.ErrCodeWebhookURLExists,
+				fmt.Sprintf("webhook url %q already exists", req.URL))
+			return
+		}
+	}
+	if !s.validateEvents(w, req.Events) {
+		return
+	}
+	if req.Transform != nil && !validateTransform(w, req.Transform) {
+		return
+	}
+
+	now := time.Now().UTC()
+	wh := &capturoo.Webhook{
+		Object:    "webhook",
+		WebhookID: newID(20),
+		Code:      req.WebhookCode,
+		Events:    req.Events,
+		URL:       req.URL,
+		Enabled:   req.Enabled,
+		Created:   now,
+		Modified:  now,
+		Transform: req.Transform,
+	}
+	s.st.Webhooks[wh.WebhookID] = wh
+	s.newWebhookSecret(wh.WebhookID)
+	if !s.commit(w) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, wh)
+}
+
+func (s *Server) updateWebhook(w http.ResponseWriter, r *http.Request, webhookID string) {
+	wh, ok := s.st.Webhooks[webhookID]
+	if !ok {
+		webhookNotFound(w, webhookID)
+		return
+	}
+	var req struct {
+		Events    []string                   `json:"events,omitempty"`
+		URL       string                     `json:"url,omitempty"`
+		Enabled   *bool                      `json:"enabled,omitempty"`
+		Transform *capturoo.WebhookTransform `json:"transform,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	if req.URL != "" && req.URL != wh.URL {
+		for _, other := range s.st.Webhooks {
+			if other.URL == req.URL {
+				writeError(w, http.StatusConflict, internal.ErrCodeWebhookURLExists,
+					fmt.Sprintf("webhook url %q already exists", req.URL))
+				return
+			}
+		}
+	}
+	if req.Events != nil && !s.validateEvents(w, req.Events) {
+		return
+	}
+	if req.Transform != nil && req.Transform.Source != "" && !validateTransform(w, req.Transform) {
+		return
+	}
+
+	if req.Events != nil {
+		wh.Events = req.Events
+	}
+	if req.URL != "" {
+		wh.URL = req.URL
+	}
+	if req.Enabled != nil {
+		wh.Enabled = *req.Enabled
+	}
+	if req.Transform != nil {
+		wh.Transform = req.Transform
+		if req.Transform.Source == "" {
+			wh.Transform = nil
+		}
+	}
+	wh.Modified = time.Now().UTC()
+	if !s.commit(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, wh)
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request, webhookID string) {
+	if _, ok := s.st.Webhooks[webhookID]; !ok {
+		webhookNotFound(w, webhookID)
+		return
+	}
+	delete(s.st.Webhooks, webhookID)
+	delete(s.st.Secrets, webhookID)
+	delete(s.st.Deliveries, webhookID)
+	if !s.commit(w) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getWebhookSecret(w http.ResponseWriter, r *http.Request, webhookID string) {
+	if _, ok := s.st.Webhooks[webhookID]; !ok {
+		webhookNotFound(w, webhookID)
+		return
+	}
+	secret, ok := s.st.Secrets[webhookID]
+	if !ok {
+		secret = s.newWebhookSecret(webhookID)
+		if !s.commit(w) {
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+func (s *Server) rotateWebhookSecret(w http.ResponseWriter, r *http.Request, webhookID string) {
+	if _, ok := s.st.Webhooks[webhookID]; !ok {
+		webhookNotFound(w, webhookID)
+		return
+	}
+	secret := s.newWebhookSecret(webhookID)
+	if !s.commit(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, secret)
+}
+
+func (s *Server) newWebhookSecret(webhookID string) *capturoo.WebhookSecret {
+	secret := &capturoo.WebhookSecret{
+		Object:    "webhook_secret",
+		WebhookID: webhookID,
+		Secret:    "whsec_" + newID(32),
+		Created:   time.Now().UTC(),
+	}
+	s.st.Secrets[webhookID] = secret
+	return secret
+}
+
+// validateTransform checks the transform parses. It writes the error
+// response and returns false if not.
+func validateTransform(w http.ResponseWriter, t *capturoo.WebhookTransform) bool {
+	if _, err := transform.Parse(t); err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, fmt.Sprintf("invalid transform: %v", err))
+		return false
+	}
+	return true
+}
+
+// validateEvents checks each event is a known type and that any bucket
+// codes in an event such as lead.created:summer|winter exist. It writes
+// the error response and returns false if not.
+func (s *Server) validateEvents(w http.ResponseWriter, events []string) bool {
+	if len(events) == 0 {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, "at least one event is required")
+		return false
+	}
+	var unknown, missing []string
+	for _, e := range events {
+		parts := strings.SplitN(e, ":", 2)
+		if _, ok := capturoo.DefaultEventCatalogue.Lookup(parts[0]); !ok {
+			unknown = append(unknown, parts[0])
+			continue
+		}
+		if len(parts) == 2 {
+			for _, code := range strings.Split(parts[1], "|") {
+				if s.bucketByCode(code) == nil {
+					missing = append(missing, code)
+				}
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeWebhookUnknownEventTypes,
+			fmt.Sprintf("unknown event types: %s", strings.Join(unknown, ", ")))
+		return false
+	}
+	if len(missing) > 0 {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeWebhookResourcesNotFound,
+			fmt.Sprintf("buckets not found: %s", strings.Join(missing, ", ")))
+		return false
+	}
+	return true
+}
+
+// commit saves the state, writing an error response and returning false if
+// it fails.
+func (s *Server) commit(w http.ResponseWriter) bool {
+	if err := s.save(); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal", err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) bucketByCode(code string) *capturoo.Bucket {
+	for _, b := range s.st.Buckets {
+		if b.BucketCode == code {
+			return b
+		}
+	}
+	return nil
+}
+
+func bucketNotFound(w http.ResponseWriter, bucketID string) {
+	writeError(w, http.StatusNotFound, internal.ErrCodeBucketNotFound,
+		fmt.Sprintf("bucket %q not found", bucketID))
+}
+
+func webhookNotFound(w http.ResponseWriter, webhookID string) {
+	writeError(w, http.StatusNotFound, internal.ErrCodeWebhookNotFound,
+		fmt.Sprintf("webhook %q not found", webhookID))
+}
@@ -0,0 +1,105 @@
+package emulator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	capturoo "capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/internal"
+)
+
+// idempotencyKeyLifetime is how long the response to a request with an
+// idempotency key is replayed.
+const idempotencyKeyLifetime = 24 * time.Hour
+
+// idempotentResponse is the stored response to a request with an
+// idempotency key.
+type idempotentResponse struct {
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	BodyHash string          `json:"bodyHash"`
+	Status   int             `json:"status"`
+	Body     json.RawMessage `json:"body"`
+	Created  time.Time       `json:"created"`
+}
+
+// idempotent serves a create request with h. A successful response to a
+// request with an Idempotency-Key header is stored and replayed for
+// repeats of the request with the same key, rather than creating the
+// resource again.
+func (s *Server) idempotent(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	key := r.Header.Get(capturoo.HeaderIdempotencyKey)
+	if key == "" {
+		h(w, r)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, internal.ErrCodeBadRequest, err.Error())
+		return
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	now := time.Now().UTC()
+	for k, ir := range s.st.Idempotent {
+		if now.Sub(ir.Created) > idempotencyKeyLifetime {
+			delete(s.st.Idempotent, k)
+		}
+	}
+	if ir, ok := s.st.Idempotent[key]; ok {
+		if ir.Method != r.Method || ir.Path != r.URL.Path || ir.BodyHash != hash {
+			writeError(w, http.StatusUnprocessableEntity, internal.ErrCodeIdempotencyKeyReused,
+				"idempotency key was used for a different request")
+			return
+		}
+		w.Header().Set(capturoo.HeaderIdempotentReplayed, "true")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(ir.Status)
+		w.Write(ir.Body)
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	rec := &recorder{header: w.Header(), status: http.StatusOK}
+	h(rec, r)
+	if rec.status >= 200 && rec.status < 300 {
+		s.st.Idempotent[key] = &idempotentResponse{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			BodyHash: hash,
+			Status:   rec.status,
+			Body:     rec.body.Bytes(),
+			Created:  now,
+		}
+		if !s.commit(w) {
+			return
+		}
+	}
+	w.WriteHeader(rec.status)
+	w.Write(rec.body.Bytes())
+}
+
+// recorder is an http.ResponseWriter buffering the response body.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
@@ -0,0 +1,330 @@
+// Package emulator implements an in-memory, optionally file-backed,
+// emulator of the Capturoo API and the Firebase Auth REST endpoints used
+// by the CLI so that it can run without network access.
+package emulator
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	capturoo "capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/internal"
+)
+
+const (
+	// APIKey is the Firebase API key returned by /autoconf.
+	APIKey = "emulator-api-key"
+
+	// ProjectID is the Firebase project ID of the emulator.
+	ProjectID = "capturoo-emulator"
+
+	tokenLifetime = time.Hour
+)
+
+// Options configures the emulator.
+type Options struct {
+	// DataFile persists the state to a JSON file after every change when
+	// set, loading it on start.
+	DataFile string
+
+	// DeveloperKey for signing in to the emulator account. One is
+	// generated when empty.
+	DeveloperKey string
+
+	// Email and Password for signing in with email and password.
+	Email    string
+	Password string
+}
+
+// Account is the single account served by the emulator.
+type Account struct {
+	AccountID    string `json:"accountId"`
+	UID          string `json:"uid"`
+	Role         string `json:"role"`
+	Email        string `json:"email"`
+	DisplayName  string `json:"displayName"`
+	DeveloperKey string `json:"developerKey"`
+	Password     string `json:"password"`
+}
+
+// state is everything the emulator stores.
+type state struct {
+	Account  *Account                           `json:"account"`
+	Buckets  map[string]*capturoo.Bucket        `json:"buckets"`
+	Leads    map[string][]*capturoo.Lead        `json:"leads"`
+	Webhooks map[string]*capturoo.Webhook       `json:"webhooks"`
+	Secrets  map[string]*capturoo.WebhookSecret `json:"secrets"`
+
+	// Events are the delivered events by ID and Deliveries the
+	// attempts by webhook ID, most recent first.
+	Events     map[string]*capturoo.WebhookEvent `json:"events"`
+	Deliveries map[string][]*capturoo.Delivery   `json:"deliveries"`
+
+	// Idempotent are the responses to requests with an idempotency key.
+	Idempotent map[string]*idempotentResponse `json:"idempotent"`
+}
+
+// Server is an http.Handler serving the emulated API.
+type Server struct {
+	mu       sync.Mutex
+	dataFile string
+	st       *state
+	pending  []*pendingDelivery
+}
+
+// NewServer returns a new emulator, loading state from opts.DataFile if
+// it exists.
+func NewServer(opts Options) (*Server, error) {
+	s := &Server{dataFile: opts.DataFile}
+	if opts.DataFile != "" {
+		b, err := ioutil.ReadFile(opts.DataFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			var st state
+			if err := json.Unmarshal(b, &st); err != nil {
+				return nil, fmt.Errorf("json decode %q: %w", opts.DataFile, err)
+			}
+			s.st = &st
+		}
+	}
+	if s.st == nil {
+		s.st = &state{
+			Account: &Account{
+				AccountID:   newID(20),
+				UID:         newID(28),
+				Role:        "admin",
+				Email:       "dev@localhost",
+				DisplayName: "Capturoo Developer",
+				Password:    "password",
+			},
+		}
+	}
+	if s.st.Buckets == nil {
+		s.st.Buckets = make(map[string]*capturoo.Bucket)
+	}
+	if s.st.Leads == nil {
+		s.st.Leads = make(map[string][]*capturoo.Lead)
+	}
+	if s.st.Webhooks == nil {
+		s.st.Webhooks = make(map[string]*capturoo.Webhook)
+	}
+	if s.st.Secrets == nil {
+		s.st.Secrets = make(map[string]*capturoo.WebhookSecret)
+	}
+	if s.st.Events == nil {
+		s.st.Events = make(map[string]*capturoo.WebhookEvent)
+	}
+	if s.st.Deliveries == nil {
+		s.st.Deliveries = make(map[string][]*capturoo.Delivery)
+	}
+	if s.st.Idempotent == nil {
+		s.st.Idempotent = make(map[string]*idempotentResponse)
+	}
+
+	acc := s.st.Account
+	if opts.DeveloperKey != "" {
+		acc.DeveloperKey = opts.DeveloperKey
+	}
+	if acc.DeveloperKey == "" {
+		acc.DeveloperKey = "dk_" + newID(32)
+	}
+	if opts.Email != "" {
+		acc.Email = opts.Email
+	}
+	if opts.Password != "" {
+		acc.Password = opts.Password
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Account returns the emulator account.
+func (s *Server) Account() Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.st.Account
+}
+
+// ServeHTTP routes requests to the emulated API. Webhook deliveries
+// caused by the request are made after it has been handled.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(capturoo.HeaderRequestID, "req_"+newID(16))
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 5 && parts[0] == "webhooks" && parts[2] == "deliveries" && parts[4] == "replay" && r.Method == http.MethodPost {
+		if !s.isAuthenticated(r) {
+			writeError(w, http.StatusUnauthorized, internal.ErrCodeAuthenticationFailed, "missing or invalid bearer token")
+			return
+		}
+		s.replayWebhookDelivery(w, r, parts[1], parts[3])
+		return
+	}
+
+	s.mu.Lock()
+	s.route(w, r, parts)
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for _, p := range pending {
+		s.deliver(p)
+	}
+}
+
+func (s *Server) isAuthenticated(r *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.authenticated(r)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, parts []string) {
+	// Firebase Auth REST endpoints are served using the emulator host
+	// convention of prefixing the path with the original host name.
+	if strings.HasPrefix(r.URL.Path, "/identitytoolkit.googleapis.com/") ||
+		strings.HasPrefix(r.URL.Path, "/www.googleapis.com/") ||
+		strings.HasPrefix(r.URL.Path, "/securetoken.googleapis.com/") {
+		s.serveFirebase(w, r)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/autoconf" && r.Method == http.MethodGet:
+		s.autoConf(w, r)
+		return
+	case r.URL.Path == "/signin-with-devkey" && r.Method == http.MethodPost:
+		s.signInWithDevKey(w, r)
+		return
+	}
+
+	if !s.authenticated(r) {
+		writeError(w, http.StatusUnauthorized, internal.ErrCodeAuthenticationFailed, "missing or invalid bearer token")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "buckets":
+		switch r.Method {
+		case http.MethodGet:
+			s.getBuckets(w, r)
+		case http.MethodPost:
+			s.idempotent(w, r, s.createBucket)
+		default:
+			methodNotAllowed(w)
+		}
+	case len(parts) == 2 && parts[0] == "buckets":
+		switch r.Method {
+		case http.MethodGet:
+			s.getBucket(w, r, parts[1])
+		case http.MethodPatch:
+			s.updateBucket(w, r, parts[1])
+		case http.MethodDelete:
+			s.deleteBucket(w, r, parts[1])
+		default:
+			methodNotAllowed(w)
+		}
+	case len(parts) == 1 && parts[0] == "leads" && r.Method == http.MethodGet:
+		s.getLeads(w, r)
+	case len(parts) == 2 && parts[0] == "leads" && parts[1] == "import" && r.Method == http.MethodPost:
+		s.importLeads(w, r)
+	case len(parts) == 1 && parts[0] == "webhooks":
+		switch r.Method {
+		case http.MethodGet:
+			s.getWebhooks(w, r)
+		case http.MethodPost:
+			s.idempotent(w, r, s.createWebhook)
+		default:
+			methodNotAllowed(w)
+		}
+	case len(parts) == 2 && parts[0] == "webhooks" && parts[1] == "events" && r.Method == http.MethodGet:
+		s.getEventCatalogue(w, r)
+	case len(parts) == 2 && parts[0] == "webhooks":
+		switch r.Method {
+		case http.MethodGet:
+			s.getWebhook(w, r, parts[1])
+		case http.MethodPatch:
+			s.updateWebhook(w, r, parts[1])
+		case http.MethodDelete:
+			s.deleteWebhook(w, r, parts[1])
+		default:
+			methodNotAllowed(w)
+		}
+	case len(parts) == 3 && parts[0] == "webhooks" && parts[2] == "secret" && r.Method == http.MethodGet:
+		s.getWebhookSecret(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "webhooks" && parts[2] == "secret" && parts[3] == "rotate" && r.Method == http.MethodPost:
+		s.rotateWebhookSecret(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "webhooks" && parts[2] == "deliveries" && r.Method == http.MethodGet:
+		s.getWebhookDeliveries(w, r, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, internal.ErrCodeBadRequest, fmt.Sprintf("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// save writes the state to the data file, if any, replacing it atomically.
+func (s *Server) save() error {
+	if s.dataFile == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.dataFile), ".capturoo-emulator-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.dataFile)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, internal.APIErrorResponse{
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		RequestID: w.Header().Get(capturoo.HeaderRequestID),
+	})
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, internal.ErrCodeBadRequest, "method not allowed")
+}
+
+const idChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// newID returns a random alphanumeric ID of length n similar to a
+// Firestore document ID.
+func newID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = idChars[int(b[i])%len(idChars)]
+	}
+	return string(b)
+}
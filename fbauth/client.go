@@ -2,11 +2,13 @@ package fbauth
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 )
@@ -17,7 +19,8 @@ var timeout = time.Duration(6 * time.Second)
 
 // Client HTTP client
 type RESTClient struct {
-	client *http.Client
+	client       *http.Client
+	emulatorHost string
 }
 
 // TokenAndRefreshToken contains a pair of JTW and refresh token for Firebase.
@@ -60,10 +63,40 @@ func NewRESTClient() *RESTClient {
 		Timeout:   timeout,
 	}
 	return &RESTClient{
-		client: client,
+		client:       client,
+		emulatorHost: os.Getenv("FIREBASE_AUTH_EMULATOR_HOST"),
 	}
 }
 
+// SetTimeout limits each request to d, or not at all if d is zero.
+func (c *RESTClient) SetTimeout(d time.Duration) {
+	c.client.Timeout = d
+}
+
+// UseEmulator routes requests to the auth emulator at host (host:port)
+// instead of the Google APIs.
+func (c *RESTClient) UseEmulator(host string) {
+	c.emulatorHost = host
+}
+
+// buildURL returns the URL for path on the Google API host, or on the
+// emulator with the host prefixed to the path if one is in use.
+func (c *RESTClient) buildURL(host, path string, v url.Values) string {
+	uri := url.URL{
+		Scheme:     "https",
+		Host:       host,
+		Path:       path,
+		ForceQuery: false,
+		RawQuery:   v.Encode(),
+	}
+	if c.emulatorHost != "" {
+		uri.Scheme = "http"
+		uri.Host = c.emulatorHost
+		uri.Path = "/" + host + "/" + path
+	}
+	return uri.String()
+}
+
 // https://identitytoolkit.googleapis.com/v1/accounts:signInWithPassword?key=[API_KEY]
 
 type SignInResponse struct {
@@ -100,17 +133,11 @@ type badRequestResponse struct {
 }
 
 // SignInWithEmailAndPassword calls the Firebase REST API to sign in using email and password.
-func (c *RESTClient) SignInWithEmailAndPassword(firebaseAPIKey, email, password string) (*SignInResponse, error) {
+func (c *RESTClient) SignInWithEmailAndPassword(ctx context.Context, firebaseAPIKey, email, password string) (*SignInResponse, error) {
 	// build the URL including Query params
 	v := url.Values{}
 	v.Set("key", firebaseAPIKey)
-	uri := url.URL{
-		Scheme:     "https",
-		Host:       "identitytoolkit.googleapis.com",
-		Path:       "v1/accounts:signInWithPassword",
-		ForceQuery: false,
-		RawQuery:   v.Encode(),
-	}
+	uri := c.buildURL("identitytoolkit.googleapis.com", "v1/accounts:signInWithPassword", v)
 
 	// build and excute the request
 	type payload struct {
@@ -135,13 +162,16 @@ func (c *RESTClient) SignInWithEmailAndPassword(firebaseAPIKey, email, password
 	if err != nil {
 		return nil, fmt.Errorf("json encode failed: %w", err)
 	}
-	req, err := http.NewRequest("POST", uri.String(), buf)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, buf)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
 	res, err := c.client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("creating new POST request: %w", err)
 	}
@@ -167,17 +197,11 @@ func (c *RESTClient) SignInWithEmailAndPassword(firebaseAPIKey, email, password
 }
 
 // ExchangeCustomTokenForIDAndRefreshToken calls the Firebase REST API to exchange a customer token for Firebase token and refresh token.
-func (c *RESTClient) ExchangeCustomTokenForIDAndRefreshToken(firebaseAPIKey, token string) (*TokenAndRefreshToken, error) {
+func (c *RESTClient) ExchangeCustomTokenForIDAndRefreshToken(ctx context.Context, firebaseAPIKey, token string) (*TokenAndRefreshToken, error) {
 	// build the URL including Query params
 	v := url.Values{}
 	v.Set("key", firebaseAPIKey)
-	uri := url.URL{
-		Scheme:     "https",
-		Host:       "www.googleapis.com",
-		Path:       "identitytoolkit/v3/relyingparty/verifyCustomToken",
-		ForceQuery: false,
-		RawQuery:   v.Encode(),
-	}
+	uri := c.buildURL("www.googleapis.com", "identitytoolkit/v3/relyingparty/verifyCustomToken", v)
 
 	// build and execute the request
 	reqBody := verifyCustomTokenRequest{
@@ -186,13 +210,16 @@ func (c *RESTClient) ExchangeCustomTokenForIDAndRefreshToken(firebaseAPIKey, tok
 	}
 	buf := new(bytes.Buffer)
 	json.NewEncoder(buf).Encode(reqBody)
-	req, err := http.NewRequest("POST", uri.String(), buf)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, buf)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
 	res, err := c.client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("creating new POST request: %w", err)
 	}
@@ -229,7 +256,7 @@ func (c *RESTClient) ExchangeCustomTokenForIDAndRefreshToken(firebaseAPIKey, tok
 // id_token	string	A Firebase Auth ID token.
 // user_id	string	The uid corresponding to the provided ID token.
 // project_id	string	Your Firebase project ID.
-func (c *RESTClient) ExchangeRefreshTokenForIDToken(firebaseAPIKey, refreshToken string) (*TokenAndRefreshToken, error) {
+func (c *RESTClient) ExchangeRefreshTokenForIDToken(ctx context.Context, firebaseAPIKey, refreshToken string) (*TokenAndRefreshToken, error) {
 	type exchangeRefreshTokenResponse struct {
 		ExpiresIn    string `json:"expires_in"`
 		TokenType    string `json:"token_type"`
@@ -241,13 +268,7 @@ func (c *RESTClient) ExchangeRefreshTokenForIDToken(firebaseAPIKey, refreshToken
 
 	v := url.Values{}
 	v.Set("key", firebaseAPIKey)
-	uri := url.URL{
-		Scheme:     "https",
-		Host:       "securetoken.googleapis.com",
-		Path:       "v1/token",
-		ForceQuery: false,
-		RawQuery:   v.Encode(),
-	}
+	uri := c.buildURL("securetoken.googleapis.com", "v1/token", v)
 	reqBody := exchangeRefreshTokenRequest{
 		GrantType:    "refresh_token",
 		RefreshToken: refreshToken,
@@ -255,13 +276,16 @@ func (c *RESTClient) ExchangeRefreshTokenForIDToken(firebaseAPIKey, refreshToken
 	payload := url.Values{}
 	payload.Set("grant_type", reqBody.GrantType)
 	payload.Set("refresh_token", reqBody.RefreshToken)
-	req, err := http.NewRequest("POST", uri.String(), strings.NewReader(payload.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, strings.NewReader(payload.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("create new request: %w", err)
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	res, err := c.client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("create new POST request failed: %w", err)
 	}
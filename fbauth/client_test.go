@@ -0,0 +1,49 @@
+package fbauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestsHonourContext(t *testing.T) {
+	stall := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(stall)
+
+	c := NewRESTClient()
+	c.SetTimeout(0)
+	c.UseEmulator(strings.TrimPrefix(ts.URL, "http://"))
+
+	calls := map[string]func(ctx context.Context) error{
+		"SignInWithEmailAndPassword": func(ctx context.Context) error {
+			_, err := c.SignInWithEmailAndPassword(ctx, "key", "jane@example.com", "secret")
+			return err
+		},
+		"ExchangeCustomTokenForIDAndRefreshToken": func(ctx context.Context) error {
+			_, err := c.ExchangeCustomTokenForIDAndRefreshToken(ctx, "key", "token")
+			return err
+		},
+		"ExchangeRefreshTokenForIDToken": func(ctx context.Context) error {
+			_, err := c.ExchangeRefreshTokenForIDToken(ctx, "key", "refresh")
+			return err
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := call(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s error incorrect, got: %v, want: %v", name, err, context.DeadlineExceeded)
+		}
+	}
+}
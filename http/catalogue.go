@@ -0,0 +1,125 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// EventType describes a webhook event type. Context driven events such as
+// lead.created must be bound to one or more bucket codes, for example
+// lead.created:bucket-a|bucket-b.
+type EventType struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	ContextDriven bool   `json:"contextDriven"`
+}
+
+// EventCatalogue is the versioned list of webhook event types.
+type EventCatalogue struct {
+	Object  string       `json:"object"`
+	Version string       `json:"version"`
+	Events  []*EventType `json:"events"`
+}
+
+// DefaultEventCatalogue is the catalogue built into the CLI. It is used
+// when the API catalogue cannot be fetched.
+var DefaultEventCatalogue = &EventCatalogue{
+	Object:  "event_catalogue",
+	Version: "2020-09-01",
+	Events: []*EventType{
+		{
+			Name:        "bucket.created",
+			Description: "A bucket was created",
+		},
+		{
+			Name:        "bucket.deleted",
+			Description: "A bucket was deleted",
+		},
+		{
+			Name:          "lead.created",
+			Description:   "A lead was captured in one of the given buckets",
+			ContextDriven: true,
+		},
+	},
+}
+
+// Lookup returns the event type with the given name.
+func (c *EventCatalogue) Lookup(name string) (*EventType, bool) {
+	for _, e := range c.Events {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of every event type in the catalogue.
+func (c *EventCatalogue) Names() []string {
+	names := make([]string, 0, len(c.Events))
+	for _, e := range c.Events {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// Suggest returns the event type name closest to the unknown name or the
+// empty string if none is close enough to be a likely typo.
+func (c *EventCatalogue) Suggest(name string) string {
+	best, bestDist := "", 3
+	for _, e := range c.Events {
+		if d := levenshtein(name, e.Name); d < bestDist {
+			best, bestDist = e.Name, d
+		}
+	}
+	return best
+}
+
+// ErrEventCatalogueUnsupported is returned by GetEventCatalogue when the
+// endpoint has no GET /webhooks/events route.
+var ErrEventCatalogueUnsupported = fmt.Errorf("the API does not serve the event catalogue (GET /webhooks/events)")
+
+// GetEventCatalogue returns the webhook event catalogue from the API. An
+// endpoint without it returns ErrEventCatalogueUnsupported.
+func (c *Client) GetEventCatalogue(ctx context.Context) (*EventCatalogue, error) {
+	uri := c.endpoint + "/webhooks/events"
+	var catalogue EventCatalogue
+	if err := c.do(ctx, http.MethodGet, uri, nil, &catalogue); err != nil {
+		if isMissingRoute(err) {
+			return nil, fmt.Errorf("%s: %w", c.endpoint, ErrEventCatalogueUnsupported)
+		}
+		return nil, err
+	}
+	return &catalogue, nil
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,37 @@
+package http
+
+import "testing"
+
+func TestEventCatalogueSuggest(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"bucket.creatd", "bucket.created"},
+		{"bucket.delete", "bucket.deleted"},
+		{"leads.created", "lead.created"},
+		{"account.updated", ""},
+	}
+	for _, tc := range tests {
+		if got := DefaultEventCatalogue.Suggest(tc.name); got != tc.want {
+			t.Errorf("Suggest(%q) incorrect, got: %q, want: %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"lead.created", "lead.created", 0},
+	}
+	for _, tc := range tests {
+		if got := levenshtein(tc.a, tc.b); got != tc.want {
+			t.Errorf("levenshtein(%q, %q) incorrect, got: %d, want: %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -1,9 +1,7 @@
 package http
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,19 +11,33 @@ import (
 	"strconv"
 	"time"
 
-	"capturoo-cli-tool-go/internal"
-
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v2"
 )
 
-var timeout = time.Duration(6 * time.Second)
+// DefaultTimeout is the default time limit of each API request.
+const DefaultTimeout = 6 * time.Second
 
 // Client HTTP client
 type Client struct {
 	endpoint string
 	client   *http.Client
 	JWT      string
+
+	// Timeout limits each request including reading the response. Lead
+	// listings are only limited until the response starts. Zero means no
+	// limit.
+	Timeout time.Duration
+
+	// Retry is the policy for retrying requests that fail with a
+	// transient error.
+	Retry RetryPolicy
+
+	// Limiter bounds the rate and concurrency of requests. A nil Limiter
+	// is unlimited.
+	Limiter *Limiter
+
+	// Trace logs and records requests for debugging, if set.
+	Trace *Tracer
 }
 
 // Account for capturoo.
@@ -53,6 +65,10 @@ type Bucket struct {
 	scheduledForDeletion bool
 	Created              time.Time `json:"created"`
 	Modified             time.Time `json:"modified"`
+
+	// Replayed is set by CreateBucket when the bucket was created by an
+	// earlier request with the same idempotency key.
+	Replayed bool `json:"-" yaml:"-"`
 }
 
 // Lead struct.
@@ -84,8 +100,32 @@ type Webhook struct {
 	Enabled   bool      `json:"enabled"`
 	Created   time.Time `json:"created"`
 	Modified  time.Time `json:"modified"`
+
+	// Transform is the optional template used to reshape the event
+	// before delivery.
+	Transform *WebhookTransform `json:"transform,omitempty"`
+
+	// Replayed is set by CreateWebhook when the webhook was created by an
+	// earlier request with the same idempotency key.
+	Replayed bool `json:"-" yaml:"-"`
 }
 
+// WebhookTransform is a template that renders the delivered payload from
+// the event, for example to match the JSON expected by a Slack incoming
+// webhook. Language is one of TransformTemplate or TransformJQ.
+type WebhookTransform struct {
+	Language string `json:"language"`
+	Source   string `json:"source"`
+}
+
+const (
+	// TransformTemplate is a Go text/template transform.
+	TransformTemplate = "go-template"
+
+	// TransformJQ is a jq expression transform.
+	TransformJQ = "jq"
+)
+
 // FirebaseConfig type
 type FirebaseConfig struct {
 	APIKey            string `json:"apiKey"`
@@ -102,24 +142,13 @@ type AutoConf struct {
 	Object string `json:"object"`
 	Data   struct {
 		FirebaseConfig *FirebaseConfig `json:"firebaseConfig"`
+
+		// AuthEmulatorHost is set by the API emulator to route the
+		// Firebase Auth calls to it.
+		AuthEmulatorHost string `json:"authEmulatorHost,omitempty"`
 	} `json:"data"`
 }
 
-// ErrBucketCodeExists occurs when attempting to create a new bucket that already exists.
-var ErrBucketCodeExists = errors.New("bucket/bucket-code-exists")
-
-// ErrWebhookURLExists error
-var ErrWebhookURLExists = errors.New("webhook/webhook-url-exists")
-
-// ErrWebhookCodeExists error
-var ErrWebhookCodeExists = errors.New("webhook/webhook-code-exists")
-
-// ErrWebhookResourcesNotFound error
-var ErrWebhookResourcesNotFound = errors.New("webhook/webhook-resources-not-found")
-
-// ErrBadRequest error
-var ErrBadRequest = errors.New("bad-request")
-
 // NewClient creates an HTTP client
 func NewClient(endpoint string) *Client {
 	tr := &http.Transport{
@@ -127,7 +156,6 @@ func NewClient(endpoint string) *Client {
 	}
 	client := &http.Client{
 		Transport: tr,
-		Timeout:   timeout,
 	}
 
 	_, err := url.Parse(endpoint)
@@ -139,82 +167,62 @@ func NewClient(endpoint string) *Client {
 	return &Client{
 		endpoint: endpoint,
 		client:   client,
+		Timeout:  DefaultTimeout,
+		Retry:    DefaultRetryPolicy,
+		Limiter:  &Limiter{},
 	}
 }
 
-func (c *Client) request(method, uri string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, uri, body)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.JWT)
-	if method == http.MethodPost {
-		req.Header.Set("Content-Type", "application/json")
-	}
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, errors.Wrapf(err, "do HTTP %s request", req.Method)
-	}
-	return res, nil
+// WithEndpoint returns a client for another endpoint sharing the
+// connections and settings of c but not its token.
+func (c *Client) WithEndpoint(endpoint string) *Client {
+	n := NewClient(endpoint)
+	n.client = c.client
+	n.Timeout = c.Timeout
+	n.Retry = c.Retry
+	if c.Limiter != nil {
+		n.Limiter = c.Limiter.clone()
+	}
+	n.Trace = c.Trace
+	return n
 }
 
 // SignInWithDevKey exchanges a developer key for a custom token.
 // https://www.googleapis.com/identitytoolkit/v3/relyingparty/verifyCustomToken?key=[API_KEY]
-func (c *Client) SignInWithDevKey(key string) (token string, account *Account, err error) {
-	uri := c.endpoint + "/signin-with-devkey"
+func (c *Client) SignInWithDevKey(ctx context.Context, key string) (token string, account *Account, err error) {
 	payload := struct {
 		DeveloperKey string `json:"developerKey"`
 	}{
 		DeveloperKey: key,
 	}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(payload)
-
-	req, err := http.NewRequest("POST", uri, buf)
+	req, err := c.newRequest(ctx, http.MethodPost, c.endpoint+"/signin-with-devkey", payload)
 	if err != nil {
-		return "", nil, errors.Wrap(err, "error creating new POST request")
-	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
-	res, err := c.client.Do(req)
-	if err != nil {
-		return "", nil, errors.Wrapf(err, "error executing HTTP POST to %s", uri)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return "", nil, errors.Wrapf(err, "statuc code %s", res.Status)
+		return "", nil, err
 	}
+	req.Header.Del("Authorization")
 
-	ct := struct {
+	var ct struct {
 		CustomToken string   `json:"customToken"`
 		Account     *Account `json:"account"`
-	}{}
-	err = json.NewDecoder(res.Body).Decode(&ct)
-	if err != nil {
-		return "", nil, errors.Wrap(err, "custom token json decode error")
+	}
+	if err := c.doRequest(req, &ct); err != nil {
+		return "", nil, err
 	}
 	return ct.CustomToken, ct.Account, nil
 }
 
 // AutoConf retrieves the firebase public config.
 func (c *Client) AutoConf(ctx context.Context) (*AutoConf, error) {
-	url := c.endpoint + "/autoconf"
-	res, err := c.request(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "request failed")
-	}
-	defer res.Body.Close()
-
 	var autoconf AutoConf
-	if err := json.NewDecoder(res.Body).Decode(&autoconf); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	if err := c.do(ctx, http.MethodGet, c.endpoint+"/autoconf", nil, &autoconf); err != nil {
+		return nil, err
 	}
 	return &autoconf, nil
 }
 
-// CreateBucket create a new bucket.
+// CreateBucket create a new bucket. The request carries an idempotency key,
+// see WithIdempotencyKey, so that it is safe to retry.
 func (c *Client) CreateBucket(ctx context.Context, accountID, bucketCode, bucketName string) (*Bucket, error) {
-	uri := c.endpoint + "/buckets"
 	payload := struct {
 		AccountID  string `json:"accountId"`
 		BucketCode string `json:"bucketCode"`
@@ -224,151 +232,105 @@ func (c *Client) CreateBucket(ctx context.Context, accountID, bucketCode, bucket
 		BucketCode: bucketCode,
 		BucketName: bucketName,
 	}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(payload)
-
-	res, err := c.request(http.MethodPost, uri, buf)
-	if err != nil {
-		return nil, errors.Wrap(err, "request failed")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return nil, errorResponse(res)
-	}
-
 	var bucket Bucket
-	if err := json.NewDecoder(res.Body).Decode(&bucket); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	replayed, err := c.create(ctx, c.endpoint+"/buckets", payload, &bucket)
+	if err != nil {
+		return nil, err
 	}
+	bucket.Replayed = replayed
 	return &bucket, nil
 }
 
 // GetBucket returns details of an individual bucket.
 func (c *Client) GetBucket(ctx context.Context, bucketID string) (*Bucket, error) {
-	url := fmt.Sprintf("%s/buckets/%s", c.endpoint, bucketID)
-	res, err := c.request(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "request failed")
-	}
-	defer res.Body.Close()
-
 	var bucket Bucket
-	if err := json.NewDecoder(res.Body).Decode(&bucket); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	if err := c.do(ctx, http.MethodGet, c.endpoint+"/buckets/"+bucketID, nil, &bucket); err != nil {
+		return nil, err
 	}
 	return &bucket, nil
 }
 
 // GetBuckets returns a list of buckets from the server.
 func (c *Client) GetBuckets(ctx context.Context, accountID string) ([]*Bucket, error) {
-	u, err := url.Parse(c.endpoint)
-	if err != nil {
-		return nil, errors.Wrap(err, "url parse")
-	}
-
-	// build the URL including query params
 	v := url.Values{}
 	v.Set("accountId", accountID)
-	uri := url.URL{
-		Scheme:     u.Scheme,
-		Host:       fmt.Sprintf("%s:%s", u.Hostname(), u.Port()),
-		Path:       "/buckets",
-		ForceQuery: false,
-		RawQuery:   v.Encode(),
-	}
-
-	res, err := c.request(http.MethodGet, uri.String(), nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "http get request failed")
-	}
-	defer res.Body.Close()
 
 	var container struct {
 		Object string    `json:"object"`
 		Data   []*Bucket `json:"data"`
 	}
-	if err := json.NewDecoder(res.Body).Decode(&container); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	if err := c.do(ctx, http.MethodGet, c.endpoint+"/buckets?"+v.Encode(), nil, &container); err != nil {
+		return nil, err
 	}
 	return container.Data, nil
 }
 
 // UpdateBucket updates the details of a bucket
 func (c *Client) UpdateBucket(ctx context.Context, bucketID, bucketName string) (*Bucket, error) {
-	url := fmt.Sprintf("%s/buckets/%s", c.endpoint, bucketID)
 	payload := struct {
 		BucketName string `json:"bucketName"`
 	}{
 		BucketName: bucketName,
 	}
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(payload)
-
-	res, err := c.request(http.MethodPatch, url, buf)
-	if err != nil {
-		return nil, errors.Wrap(err, "http patch request failed")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return nil, errorResponse(res)
-	}
-
 	var bucket Bucket
-	if err := json.NewDecoder(res.Body).Decode(&bucket); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	if err := c.do(ctx, http.MethodPatch, c.endpoint+"/buckets/"+bucketID, payload, &bucket); err != nil {
+		return nil, err
 	}
 	return &bucket, nil
 }
 
 // DeleteBucket deletes a bucket or schedules it for deletion.
 func (c *Client) DeleteBucket(ctx context.Context, bucketID string) error {
-	url := fmt.Sprintf("%s/buckets/%s", c.endpoint, bucketID)
-	res, err := c.request(http.MethodDelete, url, nil)
-	if err != nil {
-		return errors.Wrap(err, "request failed")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return errorResponse(res)
-	}
-	if res.StatusCode >= 200 && res.StatusCode < 300 {
-		return nil
+	return c.do(ctx, http.MethodDelete, c.endpoint+"/buckets/"+bucketID, nil, nil)
+}
 
-	}
-	return errors.Wrapf(err, "delete bucket returned unknown status code (%d)", res.StatusCode)
+// LeadListOptions filters the leads of ForEachLeadWithOptions.
+type LeadListOptions struct {
+	// CreatedAfter lists only the leads created after the time.
+	CreatedAfter time.Time
 }
 
-// WriteLeads retrieves the leads from the API and immediately writes them
-// to w.
-func (c *Client) WriteLeads(ctx context.Context, format string, w io.Writer, bucketID string) error {
-	u, err := url.Parse(c.endpoint)
-	if err != nil {
-		return nil
-	}
+// ForEachLead retrieves the leads of a bucket from the API calling fn
+// for each lead as it is decoded from the response stream.
+func (c *Client) ForEachLead(ctx context.Context, bucketID string, fn func(*Lead) error) error {
+	return c.ForEachLeadWithOptions(ctx, bucketID, nil, fn)
+}
 
-	// build the URL including Query params
+// ForEachLeadWithOptions is like ForEachLead for the leads matching opts.
+// The filter is sent to the API and also applied to the decoded leads, as
+// an API that does not support it returns every lead.
+func (c *Client) ForEachLeadWithOptions(ctx context.Context, bucketID string, opts *LeadListOptions, fn func(*Lead) error) error {
 	v := url.Values{}
 	v.Set("bucketId", bucketID)
-	uri := url.URL{
-		Scheme:     u.Scheme,
-		Host:       fmt.Sprintf("%s:%s", u.Hostname(), u.Port()),
-		Path:       "/leads",
-		ForceQuery: false,
-		RawQuery:   v.Encode(),
+	if opts != nil && !opts.CreatedAfter.IsZero() {
+		v.Set("createdAfter", opts.CreatedAfter.UTC().Format(time.RFC3339Nano))
+		after, next := opts.CreatedAfter, fn
+		fn = func(l *Lead) error {
+			if !l.System.Created.After(after) {
+				return nil
+			}
+			return next(l)
+		}
 	}
-
-	res, err := c.request(http.MethodGet, uri.String(), nil)
+	body, err := c.stream(ctx, http.MethodGet, c.endpoint+"/leads?"+v.Encode(), nil)
 	if err != nil {
-		return errors.Wrap(err, "request failed")
+		return err
 	}
-	defer res.Body.Close()
+	defer body.Close()
 
-	dec := json.NewDecoder(res.Body)
+	if err := decodeLeads(json.NewDecoder(body), fn); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// decodeLeads calls fn for each lead of a list response.
+func decodeLeads(dec *json.Decoder, fn func(*Lead) error) error {
 	// read "{"
-	_, err = dec.Token()
+	_, err := dec.Token()
 	if err != nil {
 		return err
 	}
@@ -397,51 +359,13 @@ func (c *Client) WriteLeads(ctx context.Context, format string, w io.Writer, buc
 		return err
 	}
 
-	var enc interface{}
-	if format == "json" {
-		enc = json.NewEncoder(w)
-	} else if format == "yaml" {
-		enc = yaml.NewEncoder(w)
-	} else if format == "csv" {
-		enc = csv.NewWriter(w)
-	} else {
-		return errors.Wrapf(err, "format not supported (format=%s)", format)
-	}
-
 	for dec.More() {
 		var lead Lead
 		if err := dec.Decode(&lead); err != nil {
 			return errors.Wrap(err, "json decode")
 		}
-
-		// encode the lead back to the write stream w.
-		if format == "json" {
-			if err := enc.(*json.Encoder).Encode(&lead); err != nil {
-				return err
-			}
-		} else if format == "yaml" {
-			if err := enc.(*yaml.Encoder).Encode(&lead); err != nil {
-				return err
-			}
-		} else if format == "csv" {
-			writer := enc.(*csv.Writer)
-			fields := make([]string, 0)
-			record, err := flattenLead(&lead, fields)
-			if err != nil {
-				return err
-			}
-			writer.Write(record)
-			if writer.Error() != nil {
-				return writer.Error()
-			}
-		}
-	}
-
-	if format == "csv" {
-		writer := enc.(*csv.Writer)
-		writer.Flush()
-		if writer.Error() != nil {
-			return writer.Error()
+		if err := fn(&lead); err != nil {
+			return err
 		}
 	}
 
@@ -460,94 +384,144 @@ func (c *Client) WriteLeads(ctx context.Context, format string, w io.Writer, buc
 	return nil
 }
 
+// WriteLeads retrieves the leads from the API and immediately writes them
+// to w.
+func (c *Client) WriteLeads(ctx context.Context, format string, w io.Writer, bucketID string) error {
+	enc, err := NewLeadEncoder(format, w)
+	if err != nil {
+		return err
+	}
+	return c.EncodeLeads(ctx, enc, bucketID)
+}
+
+// EncodeLeads retrieves the leads from the API passing each to enc,
+// closing enc once all the leads have been encoded.
+func (c *Client) EncodeLeads(ctx context.Context, enc LeadEncoder, bucketID string) error {
+	err := c.ForEachLead(ctx, bucketID, func(lead *Lead) error {
+		// encode the lead back to the write stream.
+		return enc.Encode(lead)
+	})
+	if err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ErrLeadImportUnsupported is returned by ImportLeads when the endpoint
+// has no POST /leads/import route.
+var ErrLeadImportUnsupported = fmt.Errorf("the API does not support lead import (POST /leads/import)")
+
+// ImportLeads imports a batch of leads into the bucket with the given ID,
+// returning the number of leads imported. The lead IDs and System metadata
+// are preserved where the API allows, otherwise the server assigns new values.
+//
+// POST /leads/import is not part of the public API of every deployment; it
+// is served by the emulator. An endpoint without it returns
+// ErrLeadImportUnsupported.
+func (c *Client) ImportLeads(ctx context.Context, bucketID string, leads []*Lead) (int, error) {
+	payload := struct {
+		BucketID string  `json:"bucketId"`
+		Leads    []*Lead `json:"leads"`
+	}{
+		BucketID: bucketID,
+		Leads:    leads,
+	}
+	var result struct {
+		Object   string `json:"object"`
+		Imported int    `json:"imported"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.endpoint+"/leads/import", payload, &result); err != nil {
+		if isMissingRoute(err) {
+			return 0, fmt.Errorf("%s: %w", c.endpoint, ErrLeadImportUnsupported)
+		}
+		return 0, err
+	}
+	return result.Imported, nil
+}
+
+// isMissingRoute reports whether err is the response to a request for a
+// route the endpoint does not serve, which unlike a missing resource has
+// no API error code.
+func isMissingRoute(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.Code == "" &&
+		(apiErr.Status == http.StatusNotFound || apiErr.Status == http.StatusMethodNotAllowed)
+}
+
 // CreateWebhook creates a new webhook for the given webhook code, url and event types.
+// The request carries an idempotency key, see WithIdempotencyKey.
 // equivilent to:
 // curl -v -d '{"accountId":"89233482", "webhookCode":"my-webby-web-hook", "url":"https://webhook-plugin-test.capturoo.com/", "events": ["lead.created"], "enabled": true}' -H 'Content-Type: application/json' -H "Authorization: Bearer $JWT"  http://localhost:8080/webhooks
-func (c *Client) CreateWebhook(ctx context.Context, accountID, code, url string, events []string, enabled bool) (*Webhook, error) {
+func (c *Client) CreateWebhook(ctx context.Context, accountID, code, url string, events []string, enabled bool, transform *WebhookTransform) (*Webhook, error) {
 	type requestBody struct {
-		AccountID   string   `json:"accountId"`
-		WebhookCode string   `json:"webhookCode"`
-		URL         string   `json:"url"`
-		Events      []string `json:"events"`
-		Enabled     bool     `json:"enabled"`
+		AccountID   string            `json:"accountId"`
+		WebhookCode string            `json:"webhookCode"`
+		URL         string            `json:"url"`
+		Events      []string          `json:"events"`
+		Enabled     bool              `json:"enabled"`
+		Transform   *WebhookTransform `json:"transform,omitempty"`
 	}
 
-	uri := c.endpoint + "/webhooks"
 	payload := &requestBody{
 		AccountID:   accountID,
 		WebhookCode: code,
 		URL:         url,
 		Events:      events,
 		Enabled:     enabled,
+		Transform:   transform,
 	}
-
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(payload)
-	res, err := c.request(http.MethodPost, uri, buf)
-	if err != nil {
-		return nil, errors.Wrap(err, "post request failed")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return nil, errorResponse(res)
-	}
-
 	var webhook Webhook
-	if err := json.NewDecoder(res.Body).Decode(&webhook); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	replayed, err := c.create(ctx, c.endpoint+"/webhooks", payload, &webhook)
+	if err != nil {
+		return nil, err
 	}
+	webhook.Replayed = replayed
 	return &webhook, nil
 }
 
 // GetWebhooks returns a list of Webhooks for a given account.
 func (c *Client) GetWebhooks(ctx context.Context, accountID string) ([]*Webhook, error) {
-	u, err := url.Parse(c.endpoint)
-	if err != nil {
-		return nil, nil
-	}
-
-	// build the URL including Query params
 	v := url.Values{}
 	v.Set("accountId", accountID)
-	uri := url.URL{
-		Scheme:     u.Scheme,
-		Host:       fmt.Sprintf("%s:%s", u.Hostname(), u.Port()),
-		Path:       "/webhooks",
-		ForceQuery: false,
-		RawQuery:   v.Encode(),
-	}
-
-	res, err := c.request(http.MethodGet, uri.String(), nil)
-	if err != nil {
-		return nil, errors.Wrap(err, "request failed: %w")
-	}
-	defer res.Body.Close()
 
 	var container struct {
 		Object string     `json:"object"`
 		Data   []*Webhook `json:"data"`
 	}
-	if err := json.NewDecoder(res.Body).Decode(&container); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	if err := c.do(ctx, http.MethodGet, c.endpoint+"/webhooks?"+v.Encode(), nil, &container); err != nil {
+		return nil, err
 	}
 	return container.Data, nil
 }
 
+// GetWebhook returns the webhook with the given ID.
+func (c *Client) GetWebhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, http.MethodGet, c.endpoint+"/webhooks/"+webhookID, nil, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
 // UpdateParamSet type
 type UpdateParamSet struct {
 	Events  *[]string `json:"events,omitempty"`
 	URL     *string   `json:"url,omitempty"`
 	Enabled *bool     `json:"enabled,omitempty"`
+
+	// Transform replaces the webhook transform. A transform with empty
+	// Source removes it.
+	Transform *WebhookTransform `json:"transform,omitempty"`
 }
 
 // UpdateWebhook does a partial update to the fields set in the UpdateParamSet. A field
 // with a nil pointer is disregarded.
 func (c *Client) UpdateWebhook(ctx context.Context, webhookID string, params *UpdateParamSet) (*Webhook, error) {
 	type requestBody struct {
-		Events  []string `json:"events,omitempty"`
-		URL     string   `json:"url,omitempty"`
-		Enabled *bool    `json:"enabled,omitempty"`
+		Events    []string          `json:"events,omitempty"`
+		URL       string            `json:"url,omitempty"`
+		Enabled   *bool             `json:"enabled,omitempty"`
+		Transform *WebhookTransform `json:"transform,omitempty"`
 	}
 
 	var payload requestBody
@@ -560,81 +534,112 @@ func (c *Client) UpdateWebhook(ctx context.Context, webhookID string, params *Up
 	if params.Enabled != nil {
 		payload.Enabled = params.Enabled
 	}
-
-	fmt.Printf("%#v\n", payload)
-	uri := c.endpoint + "/webhooks/" + webhookID
-	buf := new(bytes.Buffer)
-	json.NewEncoder(buf).Encode(payload)
-	res, err := c.request(http.MethodPatch, uri, buf)
-	if err != nil {
-		return nil, errors.Wrap(err, "post request failed")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode >= 400 {
-		return nil, errorResponse(res)
+	if params.Transform != nil {
+		payload.Transform = params.Transform
 	}
 
 	var webhook Webhook
-	if err := json.NewDecoder(res.Body).Decode(&webhook); err != nil {
-		return nil, errors.Wrap(err, "json decode")
+	if err := c.do(ctx, http.MethodPatch, c.endpoint+"/webhooks/"+webhookID, payload, &webhook); err != nil {
+		return nil, err
 	}
 	return &webhook, nil
 }
 
 // DeleteWebhook deletes the webhook with the given ID.
 func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
-	url := c.endpoint + "/webhooks/" + webhookID
-	res, err := c.request(http.MethodDelete, url, nil)
-	if err != nil {
-		return errors.Wrap(err, "delete request failed")
-	}
-	defer res.Body.Close()
+	return c.do(ctx, http.MethodDelete, c.endpoint+"/webhooks/"+webhookID, nil, nil)
+}
 
-	if res.StatusCode >= 400 {
-		return errorResponse(res)
-	}
-	if res.StatusCode >= 200 && res.StatusCode < 300 {
-		return nil
+// WebhookSecret is the signing secret used for webhook signatures.
+type WebhookSecret struct {
+	Object    string    `json:"object"`
+	WebhookID string    `json:"webhookId"`
+	Secret    string    `json:"secret"`
+	Created   time.Time `json:"created"`
+}
 
+// GetWebhookSecret returns the signing secret of the webhook.
+func (c *Client) GetWebhookSecret(ctx context.Context, webhookID string) (*WebhookSecret, error) {
+	var secret WebhookSecret
+	if err := c.do(ctx, http.MethodGet, c.endpoint+"/webhooks/"+webhookID+"/secret", nil, &secret); err != nil {
+		return nil, err
 	}
-	return errors.Wrapf(err, "delete webhook returned unknown status code (%d)", res.StatusCode)
+	return &secret, nil
 }
 
-func errorResponse(res *http.Response) error {
-	var badReqRes internal.APIErrorResponse
-	err := json.NewDecoder(res.Body).Decode(&badReqRes)
-	if badReqRes.Code == internal.ErrCodeBucketCodeExists {
-		return ErrBucketCodeExists
-	}
-	if badReqRes.Code == internal.ErrCodeWebhookURLExists {
-		return ErrWebhookURLExists
-	}
-	if badReqRes.Code == internal.ErrCodeBadRequest {
-		return ErrBadRequest
-	}
-	if badReqRes.Code == internal.ErrCodeWebhookResourcesNotFound {
-		return ErrWebhookResourcesNotFound
+// RotateWebhookSecret replaces the signing secret of the webhook with a
+// new one and returns it.
+func (c *Client) RotateWebhookSecret(ctx context.Context, webhookID string) (*WebhookSecret, error) {
+	var secret WebhookSecret
+	if err := c.do(ctx, http.MethodPost, c.endpoint+"/webhooks/"+webhookID+"/secret/rotate", nil, &secret); err != nil {
+		return nil, err
 	}
-	if badReqRes.Code == internal.ErrCodeBucketCodeExists {
-		return ErrBucketCodeExists
+	return &secret, nil
+}
+
+// Delivery is a single attempt to deliver an event to a webhook.
+// StatusCode is zero if no response was received, in which case Error
+// holds the reason.
+type Delivery struct {
+	Object     string    `json:"object"`
+	DeliveryID string    `json:"deliveryId"`
+	WebhookID  string    `json:"webhookId"`
+	EventID    string    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+	Created    time.Time `json:"created"`
+}
+
+// Succeeded reports whether the endpoint responded with a 2xx status.
+func (d *Delivery) Succeeded() bool {
+	return d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+// DeliveryListOptions filters the deliveries returned by
+// GetWebhookDeliveries. Zero values are ignored.
+type DeliveryListOptions struct {
+	Failed bool
+	Since  time.Time
+}
+
+// GetWebhookDeliveries returns the delivery attempts of the webhook, most
+// recent first.
+func (c *Client) GetWebhookDeliveries(ctx context.Context, webhookID string, opts *DeliveryListOptions) ([]*Delivery, error) {
+	v := url.Values{}
+	if opts != nil && opts.Failed {
+		v.Set("failed", "true")
 	}
-	if badReqRes.Code == internal.ErrCodeWebhookURLExists {
-		return ErrWebhookURLExists
+	if opts != nil && !opts.Since.IsZero() {
+		v.Set("since", opts.Since.UTC().Format(time.RFC3339))
 	}
-	if badReqRes.Code == internal.ErrCodeWebhookCodeExists {
-		return ErrWebhookCodeExists
+	uri := c.endpoint + "/webhooks/" + webhookID + "/deliveries"
+	if len(v) > 0 {
+		uri += "?" + v.Encode()
 	}
-	if badReqRes.Code == internal.ErrCodeWebhookResourcesNotFound {
-		return ErrWebhookResourcesNotFound
+
+	var container struct {
+		Object string      `json:"object"`
+		Data   []*Delivery `json:"data"`
 	}
-	if badReqRes.Code == internal.ErrCodeBadRequest {
-		return ErrBadRequest
+	if err := c.do(ctx, http.MethodGet, uri, nil, &container); err != nil {
+		return nil, err
 	}
-	if err != nil {
-		return errors.Wrap(err, "decode failed")
+	return container.Data, nil
+}
+
+// ReplayWebhookDelivery redelivers the event of a previous delivery to the
+// webhook and returns the new delivery attempt.
+func (c *Client) ReplayWebhookDelivery(ctx context.Context, webhookID, deliveryID string) (*Delivery, error) {
+	uri := c.endpoint + "/webhooks/" + webhookID + "/deliveries/" + deliveryID + "/replay"
+	var delivery Delivery
+	if err := c.do(ctx, http.MethodPost, uri, nil, &delivery); err != nil {
+		return nil, err
 	}
-	return errors.Wrapf(err, "status=%s", res.Status)
+	return &delivery, nil
 }
 
 func flattenLead(lead *Lead, fields []string) ([]string, error) {
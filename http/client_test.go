@@ -0,0 +1,274 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientMethods calls every Client method. noContent is set for the
+// methods that do not decode a response.
+var clientMethods = []struct {
+	name      string
+	method    string
+	path      string
+	noContent bool
+	call      func(ctx context.Context, c *Client) error
+}{
+	{"SignInWithDevKey", "POST", "/signin-with-devkey", false, func(ctx context.Context, c *Client) error {
+		_, _, err := c.SignInWithDevKey(ctx, "dk_test")
+		return err
+	}},
+	{"AutoConf", "GET", "/autoconf", false, func(ctx context.Context, c *Client) error {
+		_, err := c.AutoConf(ctx)
+		return err
+	}},
+	{"CreateBucket", "POST", "/buckets", false, func(ctx context.Context, c *Client) error {
+		_, err := c.CreateBucket(ctx, "acc", "summer", "Summer")
+		return err
+	}},
+	{"GetBucket", "GET", "/buckets/b1", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetBucket(ctx, "b1")
+		return err
+	}},
+	{"GetBuckets", "GET", "/buckets?accountId=acc", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetBuckets(ctx, "acc")
+		return err
+	}},
+	{"UpdateBucket", "PATCH", "/buckets/b1", false, func(ctx context.Context, c *Client) error {
+		_, err := c.UpdateBucket(ctx, "b1", "Winter")
+		return err
+	}},
+	{"DeleteBucket", "DELETE", "/buckets/b1", true, func(ctx context.Context, c *Client) error {
+		return c.DeleteBucket(ctx, "b1")
+	}},
+	{"ForEachLead", "GET", "/leads?bucketId=b1", false, func(ctx context.Context, c *Client) error {
+		return c.ForEachLead(ctx, "b1", func(*Lead) error { return nil })
+	}},
+	{"WriteLeads", "GET", "/leads?bucketId=b1", false, func(ctx context.Context, c *Client) error {
+		return c.WriteLeads(ctx, "json", ioutil.Discard, "b1")
+	}},
+	{"ImportLeads", "POST", "/leads/import", false, func(ctx context.Context, c *Client) error {
+		_, err := c.ImportLeads(ctx, "b1", nil)
+		return err
+	}},
+	{"CreateWebhook", "POST", "/webhooks", false, func(ctx context.Context, c *Client) error {
+		_, err := c.CreateWebhook(ctx, "acc", "hook", "https://example.com/", []string{"bucket.created"}, true, nil)
+		return err
+	}},
+	{"GetWebhooks", "GET", "/webhooks?accountId=acc", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetWebhooks(ctx, "acc")
+		return err
+	}},
+	{"GetWebhook", "GET", "/webhooks/w1", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetWebhook(ctx, "w1")
+		return err
+	}},
+	{"UpdateWebhook", "PATCH", "/webhooks/w1", false, func(ctx context.Context, c *Client) error {
+		enabled := true
+		_, err := c.UpdateWebhook(ctx, "w1", &UpdateParamSet{Enabled: &enabled})
+		return err
+	}},
+	{"DeleteWebhook", "DELETE", "/webhooks/w1", true, func(ctx context.Context, c *Client) error {
+		return c.DeleteWebhook(ctx, "w1")
+	}},
+	{"GetWebhookSecret", "GET", "/webhooks/w1/secret", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetWebhookSecret(ctx, "w1")
+		return err
+	}},
+	{"RotateWebhookSecret", "POST", "/webhooks/w1/secret/rotate", false, func(ctx context.Context, c *Client) error {
+		_, err := c.RotateWebhookSecret(ctx, "w1")
+		return err
+	}},
+	{"GetWebhookDeliveries", "GET", "/webhooks/w1/deliveries?failed=true", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetWebhookDeliveries(ctx, "w1", &DeliveryListOptions{Failed: true})
+		return err
+	}},
+	{"ReplayWebhookDelivery", "POST", "/webhooks/w1/deliveries/d1/replay", false, func(ctx context.Context, c *Client) error {
+		_, err := c.ReplayWebhookDelivery(ctx, "w1", "d1")
+		return err
+	}},
+	{"GetEventCatalogue", "GET", "/webhooks/events", false, func(ctx context.Context, c *Client) error {
+		_, err := c.GetEventCatalogue(ctx)
+		return err
+	}},
+}
+
+func TestClientResponses(t *testing.T) {
+	const listBody = `{"object":"list","data":[]}`
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		paths       map[string]string // response bodies by path
+		check       func(t *testing.T, method string, noContent bool, err error)
+	}{
+		{
+			name:        "success",
+			status:      200,
+			contentType: "application/json; charset=utf-8",
+			body:        listBody,
+			paths:       map[string]string{"/autoconf": `{"object":"autoconf","data":{}}`},
+			check: func(t *testing.T, method string, noContent bool, err error) {
+				if err != nil {
+					t.Errorf("%s returned error: %v", method, err)
+				}
+			},
+		},
+		{
+			name:   "no content",
+			status: 204,
+			check: func(t *testing.T, method string, noContent bool, err error) {
+				if noContent && err != nil {
+					t.Errorf("%s returned error: %v", method, err)
+				}
+				if !noContent && err == nil {
+					t.Errorf("%s accepted an empty response", method)
+				}
+			},
+		},
+		{
+			name:        "API error",
+			status:      404,
+			contentType: "application/json",
+			body:        `{"status":404,"code":"buckets/bucket-not-found","message":"bucket not found"}`,
+			check: func(t *testing.T, method string, noContent bool, err error) {
+				if !errors.Is(err, ErrBucketNotFound) {
+					t.Errorf("%s error incorrect, got: %v, want: %v", method, err, ErrBucketNotFound)
+				}
+			},
+		},
+		{
+			name:        "HTML error",
+			status:      502,
+			contentType: "text/html",
+			body:        "<html>Bad Gateway</html>",
+			check: func(t *testing.T, method string, noContent bool, err error) {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Status != 502 {
+					t.Errorf("%s error incorrect, got: %v, want status 502", method, err)
+				}
+			},
+		},
+		{
+			name:        "HTML success",
+			status:      200,
+			contentType: "text/html",
+			body:        "<html>" + listBody + "</html>",
+			check: func(t *testing.T, method string, noContent bool, err error) {
+				if noContent && err != nil {
+					t.Errorf("%s returned error: %v", method, err)
+				}
+				if !noContent && (err == nil || !strings.Contains(err.Error(), "content type")) {
+					t.Errorf("%s error incorrect, got: %v, want content type error", method, err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		var got string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Method + " " + r.URL.RequestURI()
+			if tc.contentType != "" {
+				w.Header().Set("Content-Type", tc.contentType)
+			}
+			w.WriteHeader(tc.status)
+			if body, ok := tc.paths[r.URL.Path]; ok {
+				io.WriteString(w, body)
+				return
+			}
+			io.WriteString(w, tc.body)
+		}))
+
+		c := NewClient(ts.URL)
+		c.JWT = "jwt"
+		c.Retry = RetryPolicy{}
+		for _, m := range clientMethods {
+			got = ""
+			err := m.call(context.Background(), c)
+			if want := m.method + " " + m.path; got != want {
+				t.Errorf("%s: %s sent %q, want: %q", tc.name, m.name, got, want)
+			}
+			t.Run(tc.name+"/"+m.name, func(t *testing.T) {
+				tc.check(t, m.name, m.noContent, err)
+			})
+		}
+		ts.Close()
+	}
+}
+
+func TestClientResponseTooLarge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"bucket","bucketName":"`)
+		io.WriteString(w, strings.Repeat("x", maxResponseBody))
+		io.WriteString(w, `"}`)
+	}))
+	defer ts.Close()
+
+	_, err := NewClient(ts.URL).GetBucket(context.Background(), "b1")
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("GetBucket error incorrect, got: %v, want response too large", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/leads" {
+			// the response starts at once but takes longer than the
+			// timeout to complete
+			io.WriteString(w, `{"object":"list","data":[`)
+			w.(http.Flusher).Flush()
+			time.Sleep(200 * time.Millisecond)
+			io.WriteString(w, `{"leadId":"l1"}]}`)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		io.WriteString(w, `{"object":"bucket"}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Timeout = 50 * time.Millisecond
+	c.Retry = RetryPolicy{}
+	_, err := c.GetBucket(context.Background(), "b1")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("GetBucket error incorrect, got: %v, want timed out", err)
+	}
+
+	var n int
+	err = c.ForEachLead(context.Background(), "b1", func(*Lead) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("ForEachLead incorrect, got: %d leads, error %v, want: 1 lead", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = c.ForEachLead(ctx, "b1", func(*Lead) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("ForEachLead after cancel error incorrect, got: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestImportLeadsUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	_, err := NewClient(ts.URL).ImportLeads(context.Background(), "b1", nil)
+	if !errors.Is(err, ErrLeadImportUnsupported) {
+		t.Errorf("ImportLeads error incorrect, got: %v, want: %v", err, ErrLeadImportUnsupported)
+	}
+}
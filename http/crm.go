@@ -0,0 +1,254 @@
+package http
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FieldMapping maps a lead field to a column header of a CRM import
+// format. Field is a Lead.Data key, or one of leadId, data.KEY,
+// tracking.KEY or system.NAME. Value sets a constant in place of a field.
+type FieldMapping struct {
+	Header string `yaml:"header"`
+	Field  string `yaml:"field,omitempty"`
+	Value  string `yaml:"value,omitempty"`
+}
+
+// DefaultFieldMappings are used for the CRM export formats when no
+// mapping file is given. The vcard format uses vCard property names as
+// headers with N.given and N.family making up the structured name.
+var DefaultFieldMappings = map[string][]FieldMapping{
+	"hubspot-csv": {
+		{Header: "Email", Field: "email"},
+		{Header: "First Name", Field: "firstName"},
+		{Header: "Last Name", Field: "lastName"},
+		{Header: "Phone Number", Field: "phone"},
+		{Header: "Company Name", Field: "company"},
+		{Header: "Job Title", Field: "jobTitle"},
+		{Header: "City", Field: "city"},
+		{Header: "Country/Region", Field: "country"},
+		{Header: "Create Date", Field: "system.created"},
+	},
+	"salesforce-csv": {
+		{Header: "First Name", Field: "firstName"},
+		{Header: "Last Name", Field: "lastName"},
+		{Header: "Email", Field: "email"},
+		{Header: "Phone", Field: "phone"},
+		{Header: "Company", Field: "company"},
+		{Header: "Title", Field: "jobTitle"},
+		{Header: "City", Field: "city"},
+		{Header: "Country", Field: "country"},
+		{Header: "Lead Source", Value: "Capturoo"},
+	},
+	"vcard": {
+		{Header: "N.given", Field: "firstName"},
+		{Header: "N.family", Field: "lastName"},
+		{Header: "EMAIL", Field: "email"},
+		{Header: "TEL", Field: "phone"},
+		{Header: "ORG", Field: "company"},
+		{Header: "TITLE", Field: "jobTitle"},
+	},
+}
+
+// ReadFieldMappings decodes a YAML mapping file keyed by export format.
+// Formats missing from the file use DefaultFieldMappings.
+//
+//	hubspot-csv:
+//	  - header: Email
+//	    field: email_address
+//	  - header: Lifecycle Stage
+//	    value: lead
+func ReadFieldMappings(r io.Reader) (map[string][]FieldMapping, error) {
+	mappings := make(map[string][]FieldMapping)
+	if err := yaml.NewDecoder(r).Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("yaml decode: %w", err)
+	}
+	for format, m := range mappings {
+		if _, ok := DefaultFieldMappings[format]; !ok {
+			return nil, fmt.Errorf("unknown export format %q in mapping file", format)
+		}
+		for _, f := range m {
+			if f.Header == "" {
+				return nil, fmt.Errorf("%s: mapping is missing a header", format)
+			}
+			if f.Field != "" && f.Value != "" {
+				return nil, fmt.Errorf("%s: mapping for %q sets both field and value", format, f.Header)
+			}
+		}
+	}
+	for format, m := range DefaultFieldMappings {
+		if _, ok := mappings[format]; !ok {
+			mappings[format] = m
+		}
+	}
+	return mappings, nil
+}
+
+// NewMappedLeadEncoder returns a LeadEncoder for one of the CRM export
+// formats hubspot-csv, salesforce-csv or vcard using the given mapping.
+func NewMappedLeadEncoder(format string, w io.Writer, mapping []FieldMapping) (LeadEncoder, error) {
+	switch format {
+	case "hubspot-csv", "salesforce-csv":
+		return &mappedCSVLeadEncoder{writer: csv.NewWriter(w), mapping: mapping}, nil
+	case "vcard":
+		return &vcardLeadEncoder{w: w, mapping: mapping}, nil
+	}
+	return nil, fmt.Errorf("format not supported (format=%s)", format)
+}
+
+type mappedCSVLeadEncoder struct {
+	writer        *csv.Writer
+	mapping       []FieldMapping
+	headerWritten bool
+}
+
+func (e *mappedCSVLeadEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	headers := make([]string, 0, len(e.mapping))
+	for _, m := range e.mapping {
+		headers = append(headers, m.Header)
+	}
+	return e.writer.Write(headers)
+}
+
+func (e *mappedCSVLeadEncoder) Encode(lead *Lead) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	record := make([]string, 0, len(e.mapping))
+	for _, m := range e.mapping {
+		record = append(record, csvCell(mappedValue(lead, m)))
+	}
+	return e.writer.Write(record)
+}
+
+// csvCell prefixes a value that a spreadsheet would evaluate as a formula
+// with a single quote. Lead data comes from public forms so a value such as
+// =HYPERLINK(...) must not run when the export is opened. Numbers and
+// phone numbers such as -12.5 or +44 7700 900123 are left alone as they
+// cannot call a function and the CRMs import the quote literally.
+func csvCell(v string) string {
+	if v == "" || !strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return v
+	}
+	if (v[0] == '+' || v[0] == '-') && numericRegexp.MatchString(v[1:]) {
+		return v
+	}
+	return "'" + v
+}
+
+// numericRegexp matches the digits of a number or phone number.
+var numericRegexp = regexp.MustCompile(`^[0-9][0-9 ().-]*$`)
+
+func (e *mappedCSVLeadEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// vcardLeadEncoder writes each lead as a vCard 3.0.
+type vcardLeadEncoder struct {
+	w       io.Writer
+	mapping []FieldMapping
+}
+
+func (e *vcardLeadEncoder) Encode(lead *Lead) error {
+	var given, family string
+	var props [][2]string
+	for _, m := range e.mapping {
+		v := mappedValue(lead, m)
+		switch m.Header {
+		case "N.given":
+			given = v
+		case "N.family":
+			family = v
+		default:
+			if v != "" {
+				props = append(props, [2]string{m.Header, v})
+			}
+		}
+	}
+
+	// FN is required so fall back to the first property value such as EMAIL.
+	fn := strings.TrimSpace(given + " " + family)
+	if fn == "" && len(props) > 0 {
+		fn = props[0][1]
+	}
+	if fn == "" {
+		fn = lead.LeadID
+	}
+
+	var b strings.Builder
+	b.WriteString("BEGIN:VCARD\r\n")
+	b.WriteString("VERSION:3.0\r\n")
+	fmt.Fprintf(&b, "N:%s;%s;;;\r\n", templateVCard(family), templateVCard(given))
+	fmt.Fprintf(&b, "FN:%s\r\n", templateVCard(fn))
+	for _, p := range props {
+		fmt.Fprintf(&b, "%s:%s\r\n", p[0], templateVCard(p[1]))
+	}
+	if lead.LeadID != "" {
+		fmt.Fprintf(&b, "UID:%s\r\n", templateVCard(lead.LeadID))
+	}
+	b.WriteString("END:VCARD\r\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *vcardLeadEncoder) Close() error {
+	return nil
+}
+
+func mappedValue(lead *Lead, m FieldMapping) string {
+	if m.Value != "" {
+		return m.Value
+	}
+	return leadField(lead, m.Field)
+}
+
+// leadField returns the string value of the named lead field.
+func leadField(lead *Lead, field string) string {
+	switch {
+	case field == "":
+		return ""
+	case field == "leadId":
+		return lead.LeadID
+	case strings.HasPrefix(field, "data."):
+		return toString(lead.Data[strings.TrimPrefix(field, "data.")])
+	case strings.HasPrefix(field, "tracking."):
+		return toString(lead.Tracking[strings.TrimPrefix(field, "tracking.")])
+	case strings.HasPrefix(field, "system."):
+		s := lead.System
+		switch strings.TrimPrefix(field, "system.") {
+		case "clientVersion":
+			return s.ClientVersion
+		case "host":
+			return s.Host
+		case "origin":
+			return s.Origin
+		case "referrer":
+			return s.Referrer
+		case "userAgent":
+			return s.UserAgent
+		case "remoteAddr":
+			return s.RemoteAddr
+		case "created":
+			if s.Created.IsZero() {
+				return ""
+			}
+			return s.Created.UTC().Format(time.RFC3339)
+		}
+		return ""
+	}
+	return toString(lead.Data[field])
+}
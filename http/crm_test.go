@@ -0,0 +1,125 @@
+package http
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+var crmLead = &Lead{
+	LeadID: "lead-1",
+	System: System{Created: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)},
+	Data: map[string]interface{}{
+		"email":     "jane@example.com",
+		"firstName": "Jane",
+		"lastName":  "Doe",
+		"company":   "Acme, Inc",
+	},
+}
+
+func TestHubSpotCSVLeadEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewLeadEncoder("hubspot-csv", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(crmLead); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Email,First Name,Last Name,Phone Number,Company Name,Job Title,City,Country/Region,Create Date\n" +
+		"jane@example.com,Jane,Doe,,\"Acme, Inc\",,,,2020-09-01T10:00:00Z\n"
+	if buf.String() != want {
+		t.Errorf("hubspot-csv output incorrect, got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestMappedCSVFormulaInjection(t *testing.T) {
+	lead := &Lead{
+		LeadID: "lead-1",
+		Data: map[string]interface{}{
+			"email":     "=HYPERLINK(\"http://evil.example\")",
+			"firstName": "+Jane",
+			"lastName":  "-Doe",
+			"company":   "@SUM(A1)",
+			"phone":     "+44 7700 900123",
+			"jobTitle":  "-1+2",
+			"city":      "-12.5",
+		},
+	}
+	for _, format := range []string{"hubspot-csv", "salesforce-csv"} {
+		var buf bytes.Buffer
+		enc, err := NewLeadEncoder(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(lead); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		for _, want := range []string{`"'=HYPERLINK(""http://evil.example"")"`, "'+Jane,", "'-Doe,", "'@SUM(A1),", "'-1+2,", "+44 7700 900123", "-12.5"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s output missing %s, got:\n%s", format, want, out)
+			}
+		}
+		for _, quoted := range []string{"'+44", "'-12.5"} {
+			if strings.Contains(out, quoted) {
+				t.Errorf("%s output escaped a number %s, got:\n%s", format, quoted, out)
+			}
+		}
+	}
+}
+
+func TestVCardLeadEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewLeadEncoder("vcard", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(crmLead); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "BEGIN:VCARD\r\n" +
+		"VERSION:3.0\r\n" +
+		"N:Doe;Jane;;;\r\n" +
+		"FN:Jane Doe\r\n" +
+		"EMAIL:jane@example.com\r\n" +
+		"ORG:Acme\\, Inc\r\n" +
+		"UID:lead-1\r\n" +
+		"END:VCARD\r\n"
+	if buf.String() != want {
+		t.Errorf("vcard output incorrect, got:\n%q\nwant:\n%q", buf.String(), want)
+	}
+}
+
+func TestReadFieldMappings(t *testing.T) {
+	src := `
+salesforce-csv:
+  - header: Email
+    field: email
+  - header: Lead Source
+    value: Web
+`
+	mappings, err := ReadFieldMappings(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ReadFieldMappings returned an error: %v", err)
+	}
+	if len(mappings["salesforce-csv"]) != 2 {
+		t.Errorf("len(mappings[salesforce-csv]) incorrect, got: %d, want: %d", len(mappings["salesforce-csv"]), 2)
+	}
+	if len(mappings["vcard"]) != len(DefaultFieldMappings["vcard"]) {
+		t.Errorf("mappings[vcard] should fall back to the default mapping")
+	}
+
+	if _, err := ReadFieldMappings(strings.NewReader("pipedrive-csv: []\n")); err == nil {
+		t.Errorf("ReadFieldMappings expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LeadEncoder writes leads to an output stream. Close must be called
+// after the last lead to flush any buffered output.
+type LeadEncoder interface {
+	Encode(lead *Lead) error
+	Close() error
+}
+
+// NewLeadEncoder returns a LeadEncoder for the given format writing to w.
+func NewLeadEncoder(format string, w io.Writer) (LeadEncoder, error) {
+	switch format {
+	case "json":
+		return &jsonLeadEncoder{enc: json.NewEncoder(w)}, nil
+	case "yaml":
+		return &yamlLeadEncoder{enc: yaml.NewEncoder(w)}, nil
+	case "csv":
+		return &csvLeadEncoder{writer: csv.NewWriter(w)}, nil
+	case "hubspot-csv", "salesforce-csv", "vcard":
+		return NewMappedLeadEncoder(format, w, DefaultFieldMappings[format])
+	}
+	return nil, fmt.Errorf("format not supported (format=%s)", format)
+}
+
+type jsonLeadEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonLeadEncoder) Encode(lead *Lead) error {
+	return e.enc.Encode(lead)
+}
+
+func (e *jsonLeadEncoder) Close() error {
+	return nil
+}
+
+type yamlLeadEncoder struct {
+	enc *yaml.Encoder
+}
+
+func (e *yamlLeadEncoder) Encode(lead *Lead) error {
+	return e.enc.Encode(lead)
+}
+
+func (e *yamlLeadEncoder) Close() error {
+	return e.enc.Close()
+}
+
+type csvLeadEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvLeadEncoder) Encode(lead *Lead) error {
+	fields := make([]string, 0)
+	record, err := flattenLead(lead, fields)
+	if err != nil {
+		return err
+	}
+	e.writer.Write(record)
+	return e.writer.Error()
+}
+
+func (e *csvLeadEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"capturoo-cli-tool-go/internal"
+)
+
+// HeaderRequestID is the response header holding the ID the API assigned
+// to the request.
+const HeaderRequestID = "X-Request-Id"
+
+// maxErrorBody is the number of bytes of a non JSON error response kept
+// as the message.
+const maxErrorBody = 512
+
+// APIError is an error response from the API. It matches the sentinel
+// errors below with errors.Is by Code, for example
+//
+//	if errors.Is(err, http.ErrBucketNotFound) {
+//		...
+//	}
+type APIError struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Code
+	}
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Status == 0 {
+		return msg
+	}
+
+	details := []string{fmt.Sprintf("status %d", e.Status)}
+	if e.Code != "" && e.Code != msg {
+		details = append([]string{e.Code}, details...)
+	}
+	if e.RequestID != "" {
+		details = append(details, "request "+e.RequestID)
+	}
+	return fmt.Sprintf("%s (%s)", msg, strings.Join(details, ", "))
+}
+
+// Is reports whether target is an APIError with the same Code.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code != "" && t.Code == e.Code
+}
+
+// Sentinel errors for each API error code. Compare with errors.Is.
+var (
+	ErrBadRequest               error = &APIError{Code: internal.ErrCodeBadRequest}
+	ErrAuthenticationFailed     error = &APIError{Code: internal.ErrCodeAuthenticationFailed}
+	ErrAccountSignUp            error = &APIError{Code: internal.ErrCodeAccountSignUp}
+	ErrAccountNotFound          error = &APIError{Code: internal.ErrCodeAccountNotFound}
+	ErrEmailAlreadyExists       error = &APIError{Code: internal.ErrCodeEmailAlreadyExists}
+	ErrBucketCodeExists         error = &APIError{Code: internal.ErrCodeBucketCodeExists}
+	ErrBucketNotFound           error = &APIError{Code: internal.ErrCodeBucketNotFound}
+	ErrLeadNotFound             error = &APIError{Code: internal.ErrCodeLeadNotFound}
+	ErrWebhookURLExists         error = &APIError{Code: internal.ErrCodeWebhookURLExists}
+	ErrWebhookCodeExists        error = &APIError{Code: internal.ErrCodeWebhookCodeExists}
+	ErrWebhookNotFound          error = &APIError{Code: internal.ErrCodeWebhookNotFound}
+	ErrWebhookUnknownEventTypes error = &APIError{Code: internal.ErrCodeWebhookUnknownEventTypes}
+	ErrWebhookResourcesNotFound error = &APIError{Code: internal.ErrCodeWebhookResourcesNotFound}
+	ErrWebhookDeliveryNotFound  error = &APIError{Code: internal.ErrCodeWebhookDeliveryNotFound}
+	ErrIdempotencyKeyReused     error = &APIError{Code: internal.ErrCodeIdempotencyKeyReused}
+)
+
+// errorResponse returns the APIError for a response with an error status.
+// Responses that are not in the standard error format keep the start of
+// the body as the message.
+func errorResponse(res *http.Response) error {
+	e := &APIError{
+		Status:    res.StatusCode,
+		RequestID: res.Header.Get(HeaderRequestID),
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		e.Message = fmt.Sprintf("%s: failed to read response: %v", res.Status, err)
+		return e
+	}
+
+	var r internal.APIErrorResponse
+	if json.Unmarshal(body, &r) == nil && (r.Code != "" || r.Message != "") {
+		e.Code = r.Code
+		e.Message = r.Message
+		if r.RequestID != "" {
+			e.RequestID = r.RequestID
+		}
+		return e
+	}
+
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > maxErrorBody {
+		msg = msg[:maxErrorBody] + "..."
+	}
+	e.Message = msg
+	return e
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorResponse(t *testing.T) {
+	sentinels := []error{
+		ErrBadRequest,
+		ErrAuthenticationFailed,
+		ErrAccountSignUp,
+		ErrAccountNotFound,
+		ErrEmailAlreadyExists,
+		ErrBucketCodeExists,
+		ErrBucketNotFound,
+		ErrLeadNotFound,
+		ErrWebhookURLExists,
+		ErrWebhookCodeExists,
+		ErrWebhookNotFound,
+		ErrWebhookUnknownEventTypes,
+		ErrWebhookResourcesNotFound,
+		ErrWebhookDeliveryNotFound,
+		ErrIdempotencyKeyReused,
+	}
+	for _, sentinel := range sentinels {
+		code := sentinel.(*APIError).Code
+		body := `{"status":400,"code":"` + code + `","message":"failed","requestId":"req_body"}`
+		err := errorResponse(response(400, body, ""))
+		if !errors.Is(err, sentinel) {
+			t.Errorf("errorResponse for code %q does not match its sentinel, got: %v", code, err)
+		}
+		for _, other := range sentinels {
+			if other != sentinel && errors.Is(err, other) {
+				t.Errorf("errorResponse for code %q matches %v", code, other)
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		requestID string
+		want      APIError
+	}{
+		{
+			name:      "header request ID",
+			status:    404,
+			body:      `{"status":404,"code":"buckets/bucket-not-found","message":"bucket not found"}`,
+			requestID: "req_header",
+			want:      APIError{Status: 404, Code: "buckets/bucket-not-found", Message: "bucket not found", RequestID: "req_header"},
+		},
+		{
+			name:      "body request ID",
+			status:    401,
+			body:      `{"status":401,"code":"auth/authentication-failed","message":"bad token","requestId":"req_body"}`,
+			requestID: "req_header",
+			want:      APIError{Status: 401, Code: "auth/authentication-failed", Message: "bad token", RequestID: "req_body"},
+		},
+		{
+			name:   "not JSON",
+			status: 502,
+			body:   "<html>Bad Gateway</html>\n",
+			want:   APIError{Status: 502, Message: "<html>Bad Gateway</html>"},
+		},
+		{
+			name:   "empty body",
+			status: 500,
+			want:   APIError{Status: 500},
+		},
+	}
+	for _, tc := range tests {
+		err := errorResponse(response(tc.status, tc.body, tc.requestID))
+		var got *APIError
+		if !errors.As(err, &got) {
+			t.Fatalf("%s: errorResponse returned %T, want *APIError", tc.name, err)
+		}
+		if *got != tc.want {
+			t.Errorf("%s: errorResponse incorrect, got: %#v, want: %#v", tc.name, *got, tc.want)
+		}
+		if got.Error() == "" {
+			t.Errorf("%s: Error() is empty", tc.name)
+		}
+	}
+}
+
+func TestErrorResponseTruncatesBody(t *testing.T) {
+	err := errorResponse(response(500, strings.Repeat("x", 2*maxErrorBody), ""))
+	if got := len(err.(*APIError).Message); got != maxErrorBody+3 {
+		t.Errorf("errorResponse message length incorrect, got: %d, want: %d", got, maxErrorBody+3)
+	}
+}
+
+func TestAPIErrorString(t *testing.T) {
+	tests := []struct {
+		err  *APIError
+		want string
+	}{
+		{&APIError{Status: 404, Code: "buckets/bucket-not-found", Message: "bucket not found", RequestID: "req_1"},
+			"bucket not found (buckets/bucket-not-found, status 404, request req_1)"},
+		{&APIError{Status: 500}, "Internal Server Error (status 500)"},
+		{&APIError{Code: "bad-request"}, "bad-request"},
+	}
+	for _, tc := range tests {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("Error() incorrect, got: %q, want: %q", got, tc.want)
+		}
+	}
+}
+
+func response(status int, body, requestID string) *http.Response {
+	res := &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+	if requestID != "" {
+		res.Header.Set(HeaderRequestID, requestID)
+	}
+	return res
+}
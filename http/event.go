@@ -0,0 +1,81 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// HeaderEvent is the request header holding the event type of a
+	// webhook delivery.
+	HeaderEvent = "Capturoo-Event"
+
+	// HeaderDelivery is the request header holding the unique ID of a
+	// webhook delivery.
+	HeaderDelivery = "Capturoo-Delivery"
+
+	webhookUserAgent = "Capturoo-Webhooks/1.0"
+)
+
+// WebhookEvent is the payload POSTed to a webhook endpoint. Data holds
+// the Lead for lead events and the Bucket for bucket events.
+type WebhookEvent struct {
+	Object     string          `json:"object"`
+	EventID    string          `json:"eventId"`
+	Type       string          `json:"type"`
+	AccountID  string          `json:"accountId"`
+	BucketCode string          `json:"bucketCode,omitempty"`
+	Created    time.Time       `json:"created"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewWebhookEvent returns an event of the given type with a new event ID
+// and data encoded as JSON.
+func NewWebhookEvent(eventType, accountID, bucketCode string, data interface{}) (*WebhookEvent, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &WebhookEvent{
+		Object:     "event",
+		EventID:    "evt_" + hex.EncodeToString(id),
+		Type:       eventType,
+		AccountID:  accountID,
+		BucketCode: bucketCode,
+		Created:    time.Now().UTC(),
+		Data:       b,
+	}, nil
+}
+
+// NewWebhookRequest returns a POST request delivering the event to url
+// with the headers set by the webhook service.
+func NewWebhookRequest(ctx context.Context, url string, ev *WebhookEvent) (*http.Request, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookRequestBody(ctx, url, ev, body)
+}
+
+// NewWebhookRequestBody is like NewWebhookRequest but delivers body, such
+// as the output of a webhook transform, in place of the event.
+func NewWebhookRequestBody(ctx context.Context, url string, ev *WebhookEvent, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set(HeaderEvent, ev.Type)
+	req.Header.Set(HeaderDelivery, ev.EventID)
+	return req, nil
+}
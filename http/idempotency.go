@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// HeaderIdempotencyKey is the request header that lets the API
+	// recognise a repeated request, making it safe to retry.
+	HeaderIdempotencyKey = "Idempotency-Key"
+
+	// HeaderIdempotentReplayed is set to true on a response the API
+	// replayed from an earlier request with the same idempotency key.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context that sends key as the idempotency
+// key of the create requests made with it, in place of a generated key.
+// Reusing a key for the same request returns the original result rather
+// than creating the resource again.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// NewIdempotencyKey returns a random version 4 UUID for use as an
+// idempotency key.
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// create sends a POST creating a resource with an idempotency key, so it
+// is retried safely, and decodes the resource into out. It reports
+// whether the API replayed the result of an earlier request with the
+// same key.
+func (c *Client) create(ctx context.Context, uri string, in, out interface{}) (replayed bool, err error) {
+	req, err := c.newRequest(ctx, http.MethodPost, uri, in)
+	if err != nil {
+		return false, err
+	}
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	if key == "" {
+		key = NewIdempotencyKey()
+	}
+	req.Header.Set(HeaderIdempotencyKey, key)
+
+	res, err := c.doResponse(req, out)
+	if err != nil {
+		return false, err
+	}
+	return res.Header.Get(HeaderIdempotentReplayed) == "true", nil
+}
@@ -0,0 +1,349 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSlowdown is the number of times the rate is halved after
+	// repeated 429 responses.
+	maxSlowdown = 5
+
+	// recoverAfter is the number of successful responses after which a
+	// halved rate is doubled again.
+	recoverAfter = 10
+
+	// maxPause is the longest a 429 response pauses all requests for.
+	maxPause = time.Minute
+)
+
+// Rate is a number of requests allowed per period. The zero Rate is
+// unlimited. Rate implements the pflag.Value interface.
+type Rate struct {
+	N   int
+	Per time.Duration
+}
+
+// ParseRate parses a rate such as 10/s, 600/m or 5/30s. An empty string
+// or 0 is unlimited.
+func ParseRate(s string) (Rate, error) {
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("invalid rate %q (use N/s, N/m, N/h or N/DURATION)", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("invalid rate %q: count must be a positive integer", s)
+	}
+
+	var per time.Duration
+	switch unit := strings.TrimSpace(parts[1]); unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		if per, err = time.ParseDuration(unit); err != nil || per <= 0 {
+			return Rate{}, fmt.Errorf("invalid rate %q: bad period %q", s, unit)
+		}
+	}
+	return Rate{N: n, Per: per}, nil
+}
+
+func (r Rate) String() string {
+	switch r.Per {
+	case 0:
+		return ""
+	case time.Second:
+		return fmt.Sprintf("%d/s", r.N)
+	case time.Minute:
+		return fmt.Sprintf("%d/m", r.N)
+	case time.Hour:
+		return fmt.Sprintf("%d/h", r.N)
+	}
+	return fmt.Sprintf("%d/%s", r.N, r.Per)
+}
+
+// Set parses s into r.
+func (r *Rate) Set(s string) error {
+	v, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = v
+	return nil
+}
+
+// Type returns the flag type name.
+func (r *Rate) Type() string {
+	return "rate"
+}
+
+// TokenBucket counts the events allowed by a Rate, starting full and
+// allowing bursts of up to Rate.N events. The rate is passed to each call
+// so that it can change over time. The zero TokenBucket is full.
+type TokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Fill adds the tokens accrued at rate r since the last fill and returns
+// the number available.
+func (b *TokenBucket) Fill(r Rate, now time.Time) float64 {
+	if b.last.IsZero() {
+		b.tokens = float64(r.N)
+		b.last = now
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(r.N) * float64(elapsed) / float64(r.Per)
+		b.last = now
+	}
+	if b.tokens > float64(r.N) {
+		b.tokens = float64(r.N)
+	}
+	return b.tokens
+}
+
+// Take uses up a token.
+func (b *TokenBucket) Take() {
+	b.tokens--
+}
+
+// Empty uses up every token.
+func (b *TokenBucket) Empty() {
+	b.tokens = 0
+}
+
+// Wait returns how long until a whole token is available at rate r.
+func (b *TokenBucket) Wait(r Rate) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(r.Per) / float64(r.N))
+}
+
+// Limiter bounds the rate and the number in flight of the requests of a
+// client. A 429 Too Many Requests response pauses every request for the
+// Retry-After time and halves the rate, which recovers as requests
+// succeed again. The zero Limiter is unlimited.
+type Limiter struct {
+	// Rate limits how often requests are sent, allowing bursts of up to
+	// Rate.N requests.
+	Rate Rate
+
+	// Concurrency is the maximum number of requests in flight. Zero is
+	// unlimited.
+	Concurrency int
+
+	mu       sync.Mutex
+	sem      chan struct{}
+	bucket   TokenBucket
+	paused   time.Time
+	slowdown int
+	ok       int
+	inFlight int
+	stats    LimiterStats
+	clones   []*Limiter
+}
+
+// LimiterStats counts the requests of a client.
+type LimiterStats struct {
+	// Requests is the number of requests sent including retries.
+	Requests int
+
+	// Throttled is the number of 429 responses.
+	Throttled int
+
+	// Waited is the total time requests waited for the limits.
+	Waited time.Duration
+
+	// MaxInFlight is the largest number of requests sent at once.
+	MaxInFlight int
+
+	// Rate is the current rate, less than the configured rate after 429
+	// responses.
+	Rate Rate
+}
+
+// clone returns a limiter with the same settings as l, but none of
+// its state. The stats of l include those of the clone.
+func (l *Limiter) clone() *Limiter {
+	n := &Limiter{Rate: l.Rate, Concurrency: l.Concurrency}
+	l.mu.Lock()
+	l.clones = append(l.clones, n)
+	l.mu.Unlock()
+	return n
+}
+
+// Stats returns the request counts so far of l and its clones, such as
+// the limiters of clients returned by Client.WithEndpoint. MaxInFlight
+// is the largest of any one limiter and Rate the slowest current rate.
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	s := l.stats
+	s.Rate = l.rate()
+	clones := l.clones
+	l.mu.Unlock()
+
+	for _, c := range clones {
+		cs := c.Stats()
+		s.Requests += cs.Requests
+		s.Throttled += cs.Throttled
+		s.Waited += cs.Waited
+		if cs.MaxInFlight > s.MaxInFlight {
+			s.MaxInFlight = cs.MaxInFlight
+		}
+		if cs.Rate.N > 0 && (s.Rate.N <= 0 || cs.Rate.slower(s.Rate)) {
+			s.Rate = cs.Rate
+		}
+	}
+	return s
+}
+
+// slower reports whether r allows fewer requests over time than o.
+func (r Rate) slower(o Rate) bool {
+	return float64(r.N)/float64(r.Per) < float64(o.N)/float64(o.Per)
+}
+
+// wait blocks until a request may be sent returning a func to call once
+// it has completed. A nil Limiter does not wait.
+func (l *Limiter) wait(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+
+	l.mu.Lock()
+	if l.sem == nil && l.Concurrency > 0 {
+		l.sem = make(chan struct{}, l.Concurrency)
+	}
+	sem := l.sem
+	l.mu.Unlock()
+
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	for {
+		d := l.reserve(time.Now())
+		if d <= 0 {
+			break
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			if sem != nil {
+				<-sem
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	l.mu.Lock()
+	l.stats.Requests++
+	l.stats.Waited += time.Since(start)
+	l.inFlight++
+	if l.inFlight > l.stats.MaxInFlight {
+		l.stats.MaxInFlight = l.inFlight
+	}
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			l.mu.Unlock()
+			if sem != nil {
+				<-sem
+			}
+		})
+	}, nil
+}
+
+// reserve takes a token and returns zero, or returns how long to wait
+// for one.
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+	r := l.rate()
+	if r.N <= 0 {
+		return 0
+	}
+	if l.bucket.Fill(r, now) >= 1 {
+		l.bucket.Take()
+		return 0
+	}
+	return l.bucket.Wait(r)
+}
+
+// rate returns the configured rate halved for each slowdown.
+func (l *Limiter) rate() Rate {
+	r := l.Rate
+	if r.N <= 0 {
+		return r
+	}
+	for i := 0; i < l.slowdown; i++ {
+		if r.N > 1 {
+			r.N /= 2
+		} else {
+			r.Per *= 2
+		}
+	}
+	return r
+}
+
+// observe adapts the limits to the response of a request.
+func (l *Limiter) observe(res *http.Response) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if res.StatusCode != http.StatusTooManyRequests {
+		if l.slowdown > 0 {
+			if l.ok++; l.ok >= recoverAfter {
+				l.slowdown--
+				l.ok = 0
+			}
+		}
+		return
+	}
+
+	now := time.Now()
+	l.stats.Throttled++
+	pause := time.Second
+	if d, ok := retryAfter(res.Header.Get("Retry-After"), now); ok {
+		pause = d
+	}
+	if pause > maxPause {
+		pause = maxPause
+	}
+	if until := now.Add(pause); until.After(l.paused) {
+		l.paused = until
+	}
+	if l.slowdown < maxSlowdown {
+		l.slowdown++
+	}
+	l.ok = 0
+	l.bucket.Empty()
+}
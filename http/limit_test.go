@@ -0,0 +1,228 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Rate
+		wantErr bool
+	}{
+		{"", Rate{}, false},
+		{"0", Rate{}, false},
+		{"10/s", Rate{10, time.Second}, false},
+		{"600/m", Rate{600, time.Minute}, false},
+		{"1000/h", Rate{1000, time.Hour}, false},
+		{"5/30s", Rate{5, 30 * time.Second}, false},
+		{"10", Rate{}, true},
+		{"0/s", Rate{}, true},
+		{"x/s", Rate{}, true},
+		{"10/fortnight", Rate{}, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseRate(tc.s)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseRate(%q) incorrect, got: %v, %v, want: %v, error: %t", tc.s, got, err, tc.want, tc.wantErr)
+		}
+		if err == nil && tc.s != "0" && got.String() != tc.s {
+			t.Errorf("Rate.String() incorrect, got: %q, want: %q", got.String(), tc.s)
+		}
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	ts := httptest.NewServer(&faultServer{})
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Limiter.Rate = Rate{N: 2, Per: 100 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := getBucket(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a burst of two then one every 50ms
+	if d := time.Since(start); d < 180*time.Millisecond {
+		t.Errorf("6 requests at 2 per 100ms took %s, want at least 200ms", d)
+	}
+	if s := c.Limiter.Stats(); s.Requests != 6 || s.Waited == 0 {
+		t.Errorf("Stats incorrect, got: %+v", s)
+	}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, max int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if inFlight++; inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"bucket"}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Limiter.Concurrency = 2
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := getBucket(c); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if max != 2 {
+		t.Errorf("requests in flight incorrect, got: %d, want: 2", max)
+	}
+	if s := c.Limiter.Stats(); s.Requests != 8 || s.MaxInFlight != 2 {
+		t.Errorf("Stats incorrect, got: %+v", s)
+	}
+}
+
+func TestLimiterThrottled(t *testing.T) {
+	srv := &faultServer{faults: []string{"429"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Retry = RetryPolicy{Retries: 1, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	c.Limiter.Rate = Rate{N: 80, Per: time.Second}
+	if err := getBucket(c); err != nil {
+		t.Fatal(err)
+	}
+	s := c.Limiter.Stats()
+	if s.Requests != 2 || s.Throttled != 1 || s.Rate != (Rate{40, time.Second}) {
+		t.Errorf("Stats after 429 incorrect, got: %+v", s)
+	}
+
+	// the rate recovers as requests succeed
+	for i := 0; i < recoverAfter; i++ {
+		if err := getBucket(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r := c.Limiter.Stats().Rate; r != c.Limiter.Rate {
+		t.Errorf("rate after recovery incorrect, got: %s, want: %s", r, c.Limiter.Rate)
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	ts := httptest.NewServer(&faultServer{})
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Limiter.Rate = Rate{N: 1, Per: time.Hour}
+	if err := getBucket(c); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetBucket(ctx, "b1"); err != context.DeadlineExceeded {
+		t.Errorf("GetBucket error incorrect, got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestLimiterStreamReleasesSlot(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/leads" {
+			io.WriteString(w, `{"object":"list","data":[{"leadId":"l1"},{"leadId":"l2"}]}`)
+			return
+		}
+		io.WriteString(w, `{"object":"bucket"}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Limiter.Concurrency = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// requests made while a lead listing is streamed must not wait for
+	// the listing's slot
+	var n int
+	err := c.ForEachLead(ctx, "b1", func(l *Lead) error {
+		n++
+		_, err := c.GetBucket(ctx, "b1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("leads incorrect, got: %d, want: 2", n)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	r := Rate{N: 2, Per: time.Minute}
+	now := time.Now()
+	var b TokenBucket
+	if n := b.Fill(r, now); n != 2 {
+		t.Fatalf("Fill of a new bucket incorrect, got: %v, want: 2", n)
+	}
+	b.Take()
+	b.Take()
+	if n := b.Fill(r, now); n != 0 {
+		t.Errorf("Fill after taking every token incorrect, got: %v, want: 0", n)
+	}
+	if d := b.Wait(r); d != 30*time.Second {
+		t.Errorf("Wait incorrect, got: %s, want: 30s", d)
+	}
+	if n := b.Fill(r, now.Add(45*time.Second)); n != 1.5 {
+		t.Errorf("Fill after 45s incorrect, got: %v, want: 1.5", n)
+	}
+	if n := b.Fill(r, now.Add(time.Hour)); n != 2 {
+		t.Errorf("Fill after an hour incorrect, got: %v, want: 2", n)
+	}
+	b.Empty()
+	if n := b.Fill(r, now.Add(time.Hour)); n != 0 {
+		t.Errorf("Fill after Empty incorrect, got: %v, want: 0", n)
+	}
+}
+
+func TestLimiterStatsClones(t *testing.T) {
+	ts := httptest.NewServer(&faultServer{faults: []string{"429"}})
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Retry = RetryPolicy{Retries: 1, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	c.Limiter.Rate = Rate{N: 80, Per: time.Second}
+	if err := getBucket(c); err != nil {
+		t.Fatal(err)
+	}
+	other := c.WithEndpoint(ts.URL)
+	if err := getBucket(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := getBucket(other); err != nil {
+		t.Fatal(err)
+	}
+
+	s := c.Limiter.Stats()
+	if s.Requests != 4 || s.Throttled != 1 || s.MaxInFlight != 1 || s.Rate != (Rate{40, time.Second}) {
+		t.Errorf("Stats incorrect, got: %+v", s)
+	}
+	if s := other.Limiter.Stats(); s.Requests != 2 || s.Throttled != 0 {
+		t.Errorf("Stats of clone incorrect, got: %+v", s)
+	}
+}
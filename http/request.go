@@ -0,0 +1,252 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxResponseBody is the largest response body decoded by do. Lead
+// listings are streamed by ForEachLead and are not limited.
+const maxResponseBody = 16 << 20
+
+// newRequest returns an API request with the JSON encoding of in as the
+// body. A nil in sends no body.
+func (c *Client) newRequest(ctx context.Context, method, uri string, in interface{}) (*http.Request, error) {
+	var body io.Reader
+	if in != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(in); err != nil {
+			return nil, errors.Wrap(err, "json encode")
+		}
+		body = buf
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "new HTTP %s request", method)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.JWT != "" {
+		req.Header.Set("Authorization", "Bearer "+c.JWT)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends an API request and decodes the JSON response into out. A nil
+// out discards the response body.
+func (c *Client) do(ctx context.Context, method, uri string, in, out interface{}) error {
+	req, err := c.newRequest(ctx, method, uri, in)
+	if err != nil {
+		return err
+	}
+	return c.doRequest(req, out)
+}
+
+// doRequest is like do for a request built by newRequest.
+func (c *Client) doRequest(req *http.Request, out interface{}) error {
+	_, err := c.doResponse(req, out)
+	return err
+}
+
+// doResponse is like doRequest but also returns the response, with its
+// body closed, for the headers.
+func (c *Client) doResponse(req *http.Request, out interface{}) (*http.Response, error) {
+	res, err := c.send(req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body := &limitedReader{r: res.Body, limit: maxResponseBody}
+	if out == nil {
+		_, err := io.Copy(ioutil.Discard, body)
+		return res, err
+	}
+	if err := checkContentType(res); err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		if err := c.contextError(req, res.Request); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "json decode")
+	}
+	return res, nil
+}
+
+// stream sends an API request returning the body of a JSON response for
+// the caller to decode and close.
+func (c *Client) stream(ctx context.Context, method, uri string, in interface{}) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, method, uri, in)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.send(req, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContentType(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// send sends the request, retrying transient failures as allowed by
+// c.Retry, and returns the response if it has a 2xx status. Any other
+// status is returned as an *APIError.
+func (c *Client) send(req *http.Request, stream bool) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := c.try(req, stream)
+		if err == nil && res.StatusCode >= 200 && res.StatusCode < 300 {
+			return res, nil
+		}
+
+		wait, ok := c.Retry.next(req, attempt, res, err)
+		if !ok {
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			return nil, errorResponse(res)
+		}
+		if res != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxErrorBody))
+			res.Body.Close()
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, req.Context().Err()
+		case <-t.C:
+		}
+	}
+}
+
+// try sends a single attempt of the request limited by c.Timeout, once
+// c.Limiter allows it. The time limit covers reading the response body
+// unless stream is set, so that long lead listings are not cut short.
+// A stream also gives up its c.Limiter concurrency slot once the response
+// headers arrive, as the caller may make further requests while reading
+// it.
+func (c *Client) try(req *http.Request, stream bool) (*http.Response, error) {
+	release, err := c.Limiter.wait(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancelCtx := context.WithCancel(req.Context())
+	cancel := func() {
+		cancelCtx()
+		release()
+	}
+	r := req.WithContext(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, errors.Wrap(err, "get request body")
+		}
+		r.Body = body
+	}
+
+	stop := cancel
+	if c.Timeout > 0 {
+		timer := time.AfterFunc(c.Timeout, cancel)
+		stop = func() {
+			timer.Stop()
+			cancel()
+		}
+		if stream {
+			defer timer.Stop()
+		}
+	}
+
+	trace := c.Trace.start(r)
+	res, err := c.client.Do(r)
+	if err != nil {
+		trace.failed(err)
+		defer stop()
+		if err := c.contextError(req, r); err != nil {
+			return nil, err
+		}
+		return nil, errors.Wrapf(err, "do HTTP %s request", req.Method)
+	}
+	c.Limiter.observe(res)
+	if stream {
+		release()
+	}
+	trace.response(res)
+	res.Body = &cancelBody{ReadCloser: res.Body, cancel: stop}
+	return res, nil
+}
+
+// cancelBody cancels the request context once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// contextError returns the reason an attempt of req was stopped, if it
+// was. A cancelled request returns the context error unwrapped so that
+// callers can tell an interrupt from a failure.
+func (c *Client) contextError(req, attempt *http.Request) error {
+	if err := req.Context().Err(); err != nil {
+		return err
+	}
+	if attempt.Context().Err() != nil {
+		return errors.Errorf("%s %s timed out after %s", req.Method, req.URL.Path, c.Timeout)
+	}
+	return nil
+}
+
+// checkContentType returns an error unless the response holds JSON.
+func checkContentType(res *http.Response) error {
+	ct := res.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json")) {
+		return nil
+	}
+	if ct == "" {
+		return errors.Errorf("%s %s returned %s without a JSON body", res.Request.Method, res.Request.URL.Path, res.Status)
+	}
+	return errors.Errorf("%s %s returned unexpected content type %q", res.Request.Method, res.Request.URL.Path, ct)
+}
+
+// limitedReader reads from r returning an error once more than limit
+// bytes have been read.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if max := l.limit - l.read + 1; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return 0, errors.Errorf("response body exceeds %d bytes", l.limit)
+	}
+	return n, err
+}
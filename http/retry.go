@@ -0,0 +1,98 @@
+package http
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls the retries of requests that fail with a transient
+// error: a network error, a timeout or a 429, 502, 503 or 504 status. Only
+// idempotent requests and requests with an Idempotency-Key are retried.
+type RetryPolicy struct {
+	// Retries is the number of times a failed request is retried.
+	Retries int
+
+	// Backoff is the wait before the first retry. It doubles for each
+	// further retry up to MaxBackoff, less a random jitter of up to half
+	// the wait. A Retry-After response header replaces the wait, but one
+	// longer than MaxBackoff is not retried.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the retry policy of a new client.
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:    2,
+	Backoff:    500 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+}
+
+// next returns the wait before retrying req after the attempt failed with
+// res or err, or false if it should not be retried.
+func (p RetryPolicy) next(req *http.Request, attempt int, res *http.Response, err error) (time.Duration, bool) {
+	if attempt > p.Retries || !retryable(req) || req.Context().Err() != nil {
+		return 0, false
+	}
+	wait := p.backoff(attempt)
+	if err != nil {
+		return wait, true
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return 0, false
+	}
+	if d, ok := retryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+		if d > p.MaxBackoff {
+			return 0, false
+		}
+		wait = d
+	}
+	return wait, true
+}
+
+// backoff returns the jittered wait before the given retry.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether the request may safely be sent more than once.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(HeaderIdempotencyKey) != ""
+}
+
+// retryAfter parses a Retry-After header value of either seconds or an
+// HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
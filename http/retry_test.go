@@ -0,0 +1,184 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// faultServer fails the first len(faults) requests it receives with the
+// given faults and then succeeds, recording the request bodies and
+// idempotency keys.
+type faultServer struct {
+	mu     sync.Mutex
+	faults []string
+	bodies []string
+	keys   []string
+	times  []time.Time
+}
+
+func (s *faultServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	n := len(s.bodies)
+	s.bodies = append(s.bodies, string(b))
+	s.keys = append(s.keys, r.Header.Get(HeaderIdempotencyKey))
+	s.times = append(s.times, time.Now())
+	s.mu.Unlock()
+
+	if n < len(s.faults) {
+		switch s.faults[n] {
+		case "reset":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case "429":
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "503":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "404":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"status":404,"code":"buckets/bucket-not-found","message":"bucket not found"}`)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"object":"bucket","bucketId":"b1"}`)
+}
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		faults   []string
+		call     func(c *Client) error
+		requests int
+		wantErr  bool
+	}{
+		{"GET recovers", []string{"503", "reset"}, getBucket, 3, false},
+		{"GET gives up", []string{"503", "503", "503"}, getBucket, 3, true},
+		{"GET client error", []string{"404"}, getBucket, 1, true},
+		{"DELETE recovers", []string{"reset"}, func(c *Client) error {
+			return c.DeleteBucket(context.Background(), "b1")
+		}, 2, false},
+		{"POST without key", []string{"503"}, func(c *Client) error {
+			_, err := c.ImportLeads(context.Background(), "b1", nil)
+			return err
+		}, 1, true},
+		{"POST with key", []string{"reset", "503"}, func(c *Client) error {
+			_, err := c.CreateBucket(context.Background(), "acc", "summer", "Summer")
+			return err
+		}, 3, false},
+		{"PATCH", []string{"503"}, func(c *Client) error {
+			_, err := c.UpdateBucket(context.Background(), "b1", "Winter")
+			return err
+		}, 1, true},
+	}
+	for _, tc := range tests {
+		srv := &faultServer{faults: tc.faults}
+		ts := httptest.NewServer(srv)
+		c := NewClient(ts.URL)
+		c.Retry = RetryPolicy{Retries: 2, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+
+		err := tc.call(c)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error incorrect, got: %v, want error: %t", tc.name, err, tc.wantErr)
+		}
+		if len(srv.bodies) != tc.requests {
+			t.Errorf("%s: requests incorrect, got: %d, want: %d", tc.name, len(srv.bodies), tc.requests)
+		}
+		for i, b := range srv.bodies {
+			if b != srv.bodies[0] {
+				t.Errorf("%s: request %d body incorrect, got: %q, want: %q", tc.name, i, b, srv.bodies[0])
+			}
+			if srv.keys[i] != srv.keys[0] {
+				t.Errorf("%s: request %d idempotency key incorrect, got: %q, want: %q", tc.name, i, srv.keys[i], srv.keys[0])
+			}
+		}
+		ts.Close()
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	srv := &faultServer{faults: []string{"429"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Retry = RetryPolicy{Retries: 1, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	if err := getBucket(c); err != nil {
+		t.Fatal(err)
+	}
+	if d := srv.times[1].Sub(srv.times[0]); d < 900*time.Millisecond {
+		t.Errorf("retry after 429 waited %s, want: 1s", d)
+	}
+
+	// a Retry-After longer than MaxBackoff is not waited for
+	srv = &faultServer{faults: []string{"429"}}
+	ts2 := httptest.NewServer(srv)
+	defer ts2.Close()
+	c = NewClient(ts2.URL)
+	c.Retry = RetryPolicy{Retries: 1, Backoff: time.Millisecond, MaxBackoff: 500 * time.Millisecond}
+	var apiErr *APIError
+	if err := getBucket(c); !errors.As(err, &apiErr) || apiErr.Status != http.StatusTooManyRequests {
+		t.Errorf("GetBucket error incorrect, got: %v, want status 429", err)
+	}
+}
+
+func TestClientRetryCancel(t *testing.T) {
+	srv := &faultServer{faults: []string{"503", "503"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	c.Retry = RetryPolicy{Retries: 2, Backoff: time.Minute, MaxBackoff: time.Minute}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := c.GetBucket(ctx, "b1"); err != context.Canceled {
+		t.Errorf("GetBucket error incorrect, got: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Tue, 01 Sep 2020 12:00:05 GMT", 5 * time.Second, true},
+		{"Tue, 01 Sep 2020 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, tc := range tests {
+		got, ok := retryAfter(tc.v, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) incorrect, got: %s, %t, want: %s, %t", tc.v, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{Retries: 10, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(attempt + 1); d < max/2 || d > max {
+				t.Errorf("backoff(%d) incorrect, got: %s, want between %s and %s", attempt+1, d, max/2, max)
+			}
+		}
+	}
+}
+
+func getBucket(c *Client) error {
+	_, err := c.GetBucket(context.Background(), "b1")
+	return err
+}
@@ -0,0 +1,205 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateFooter is the data passed to the footer template.
+type TemplateFooter struct {
+	Count int
+}
+
+type templateLeadEncoder struct {
+	w      io.Writer
+	row    *template.Template
+	header *template.Template
+	footer *template.Template
+	count  int
+}
+
+// NewTemplateLeadEncoder returns a LeadEncoder that executes the row
+// template for each lead. The optional header template is executed
+// before the first lead and the optional footer template after the last
+// lead with a TemplateFooter. Empty header or footer text is ignored.
+func NewTemplateLeadEncoder(w io.Writer, row, header, footer string) (LeadEncoder, error) {
+	e := &templateLeadEncoder{w: w}
+	var err error
+	if e.row, err = template.New("row").Funcs(TemplateFuncs).Parse(row); err != nil {
+		return nil, err
+	}
+	if header != "" {
+		if e.header, err = template.New("header").Funcs(TemplateFuncs).Parse(header); err != nil {
+			return nil, err
+		}
+	}
+	if footer != "" {
+		if e.footer, err = template.New("footer").Funcs(TemplateFuncs).Parse(footer); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *templateLeadEncoder) Encode(lead *Lead) error {
+	if e.count == 0 && e.header != nil {
+		if err := e.header.Execute(e.w, nil); err != nil {
+			return err
+		}
+	}
+	e.count++
+	return e.row.Execute(e.w, lead)
+}
+
+func (e *templateLeadEncoder) Close() error {
+	if e.count == 0 && e.header != nil {
+		if err := e.header.Execute(e.w, nil); err != nil {
+			return err
+		}
+	}
+	if e.footer != nil {
+		return e.footer.Execute(e.w, TemplateFooter{Count: e.count})
+	}
+	return nil
+}
+
+// TemplateFuncs are the helper functions available to lead templates.
+//
+//	date LAYOUT VALUE   formats a time.Time or RFC 3339 string
+//	default DEF VALUE   returns DEF if VALUE is empty
+//	json VALUE          encodes VALUE as JSON
+//	csv VALUE           quotes VALUE as a CSV field if required
+//	sql VALUE           quotes VALUE as a SQL string literal or NULL
+//	xml VALUE           escapes VALUE for XML text and attributes
+//	vcard VALUE         escapes VALUE for a vCard property value
+//	lower, upper, trim  string case and whitespace helpers
+//	now                 the current time
+var TemplateFuncs = template.FuncMap{
+	"date":    templateDate,
+	"default": templateDefault,
+	"json":    templateJSON,
+	"csv":     templateCSV,
+	"sql":     templateSQL,
+	"xml":     templateXML,
+	"vcard":   templateVCard,
+	"lower":   func(v interface{}) string { return strings.ToLower(toString(v)) },
+	"upper":   func(v interface{}) string { return strings.ToUpper(toString(v)) },
+	"trim":    func(v interface{}) string { return strings.TrimSpace(toString(v)) },
+	"now":     time.Now,
+}
+
+func templateDate(layout string, v interface{}) (string, error) {
+	switch t := v.(type) {
+	case time.Time:
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	case *time.Time:
+		if t == nil || t.IsZero() {
+			return "", nil
+		}
+		return t.Format(layout), nil
+	case string:
+		if t == "" {
+			return "", nil
+		}
+		p, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return "", fmt.Errorf("date: %w", err)
+		}
+		return p.Format(layout), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("date: unsupported type %T", v)
+}
+
+func templateDefault(def interface{}, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+func templateJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func templateCSV(v interface{}) string {
+	s := toString(v)
+	if strings.ContainsAny(s, "\",\r\n") || strings.HasPrefix(s, " ") {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	return s
+}
+
+func templateSQL(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	switch t := v.(type) {
+	case float64, int, bool:
+		return toString(t)
+	}
+	return "'" + strings.ReplaceAll(toString(v), "'", "''") + "'"
+}
+
+func templateXML(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := xml.EscapeText(&buf, []byte(toString(v))); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func templateVCard(v interface{}) string {
+	r := strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(toString(v))
+}
+
+// toString converts the scalar values found in Lead.Data to strings.
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		// JSON numbers decode as float64; avoid exponents for phone
+		// numbers and IDs such as 447700900123
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.IsZero()
+	}
+	return false
+}
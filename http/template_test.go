@@ -0,0 +1,76 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTemplateLeadEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	row := `INSERT INTO leads VALUES ({{sql .LeadID}}, {{sql .Data.name}}, {{sql .Data.phone}}, '{{date "2006-01-02" .System.Created}}');` + "\n"
+	header := "BEGIN;\n"
+	footer := "COMMIT; -- {{.Count}} leads\n"
+	enc, err := NewTemplateLeadEncoder(&buf, row, header, footer)
+	if err != nil {
+		t.Fatalf("NewTemplateLeadEncoder returned an error: %v", err)
+	}
+
+	leads := []*Lead{
+		{
+			LeadID: "lead-1",
+			System: System{Created: time.Date(2020, 9, 1, 10, 0, 0, 0, time.UTC)},
+			Data:   map[string]interface{}{"name": "O'Brien", "phone": "0123"},
+		},
+		{
+			LeadID: "lead-2",
+			System: System{Created: time.Date(2020, 9, 2, 10, 0, 0, 0, time.UTC)},
+			Data:   map[string]interface{}{"name": "Smith"},
+		},
+	}
+	for _, l := range leads {
+		if err := enc.Encode(l); err != nil {
+			t.Fatalf("Encode returned an error: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+
+	want := "BEGIN;\n" +
+		"INSERT INTO leads VALUES ('lead-1', 'O''Brien', '0123', '2020-09-01');\n" +
+		"INSERT INTO leads VALUES ('lead-2', 'Smith', NULL, '2020-09-02');\n" +
+		"COMMIT; -- 2 leads\n"
+	if buf.String() != want {
+		t.Errorf("template output incorrect, got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	if got := templateCSV(`say "hi", bye`); got != `"say ""hi"", bye"` {
+		t.Errorf("templateCSV incorrect, got: %s", got)
+	}
+	if got := templateDefault("n/a", ""); got != "n/a" {
+		t.Errorf("templateDefault incorrect, got: %v, want: %v", got, "n/a")
+	}
+	if got := templateDefault("n/a", "x"); got != "x" {
+		t.Errorf("templateDefault incorrect, got: %v, want: %v", got, "x")
+	}
+	if got := templateVCard("Acme, Inc; Ltd"); got != `Acme\, Inc\; Ltd` {
+		t.Errorf("templateVCard incorrect, got: %s", got)
+	}
+	if got := templateSQL(447700900123.0); got != "447700900123" {
+		t.Errorf("templateSQL of a large number incorrect, got: %s", got)
+	}
+	lead := &Lead{Data: map[string]interface{}{"phone": 447700900123.0, "score": -0.25}}
+	if got := leadField(lead, "phone"); got != "447700900123" {
+		t.Errorf("leadField of a large number incorrect, got: %s", got)
+	}
+	if got := leadField(lead, "data.score"); got != "-0.25" {
+		t.Errorf("leadField of a fraction incorrect, got: %s", got)
+	}
+	got, err := templateDate("02/01/2006", "2020-09-01T10:00:00Z")
+	if err != nil || got != "01/09/2020" {
+		t.Errorf("templateDate incorrect, got: %s, %v", got, err)
+	}
+}
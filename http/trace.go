@@ -0,0 +1,470 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxTraceBody is the most of each request and response body recorded
+// by a Tracer.
+const maxTraceBody = 1 << 20
+
+// redacted replaces credentials in traces.
+const redacted = "REDACTED"
+
+// redactedFields are the JSON fields holding credentials.
+var redactedFields = map[string]bool{
+	"developerKey": true,
+	"customToken":  true,
+	"secret":       true,
+}
+
+// Tracer logs API requests and responses for debugging and records them
+// in a HAR file. Credentials are redacted from both.
+type Tracer struct {
+	// Log receives each request and response, if set.
+	Log io.Writer
+
+	// Bodies adds the request and response bodies to the log.
+	Bodies bool
+
+	// HARFile is the name of a HAR file to record the requests in, if
+	// set. Each request is appended as it completes, leaving the file
+	// whole even if the command exits early. The file is only readable by
+	// its owner as it holds lead data.
+	HARFile string
+
+	// Version is the version of the CLI tool recorded in the HAR file.
+	Version string
+
+	mu     sync.Mutex
+	har    *os.File
+	end    int64
+	suffix []byte
+	n      int
+	failed bool
+}
+
+// traceEntry is a request being traced.
+type traceEntry struct {
+	t       *Tracer
+	req     *http.Request
+	reqBody []byte
+	res     *http.Response
+	body    bytes.Buffer
+	size    int64
+	err     error
+	start   time.Time
+	wait    time.Duration
+	receive time.Duration
+	once    sync.Once
+}
+
+// start traces the sending of req. A nil Tracer traces nothing.
+func (t *Tracer) start(req *http.Request) *traceEntry {
+	if t == nil {
+		return nil
+	}
+	e := &traceEntry{t: t, req: req, start: time.Now()}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			e.reqBody, _ = ioutil.ReadAll(io.LimitReader(body, maxTraceBody))
+			body.Close()
+		}
+	}
+	if t.Log != nil {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "> %s %s\n", req.Method, req.URL)
+		writeHeaders(&b, "> ", req.Header)
+		if t.Bodies {
+			writeBody(&b, "> ", e.reqBody)
+		}
+		t.log(b.Bytes())
+	}
+	return e
+}
+
+// response traces the response headers and replaces res.Body so that the
+// body is traced as it is read.
+func (e *traceEntry) response(res *http.Response) {
+	if e == nil {
+		return
+	}
+	e.res = res
+	e.wait = time.Since(e.start)
+	if e.t.Log != nil {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "< %s (%s)\n", res.Status, e.wait.Round(time.Millisecond))
+		writeHeaders(&b, "< ", res.Header)
+		e.t.log(b.Bytes())
+	}
+	res.Body = &traceBody{ReadCloser: res.Body, e: e}
+}
+
+// failed traces a request that got no response.
+func (e *traceEntry) failed(err error) {
+	if e == nil {
+		return
+	}
+	e.err = err
+	e.wait = time.Since(e.start)
+	if e.t.Log != nil {
+		e.t.log([]byte(fmt.Sprintf("< %s %s failed after %s: %v\n", e.req.Method, e.req.URL, e.wait.Round(time.Millisecond), err)))
+	}
+	e.t.record(e)
+}
+
+// traceBody records a response body as it is read, completing the trace
+// once it is closed.
+type traceBody struct {
+	io.ReadCloser
+	e *traceEntry
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.e.size += int64(n)
+	if room := maxTraceBody - b.e.body.Len(); room > 0 {
+		if room > n {
+			room = n
+		}
+		b.e.body.Write(p[:room])
+	}
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.e.once.Do(func() {
+		b.e.receive = time.Since(b.e.start) - b.e.wait
+		if b.e.t.Log != nil && b.e.t.Bodies {
+			var buf bytes.Buffer
+			writeBody(&buf, "< ", b.e.body.Bytes())
+			b.e.t.log(buf.Bytes())
+		}
+		b.e.t.record(b.e)
+	})
+	return err
+}
+
+// log writes a block of lines to the log at once so that the traces of
+// concurrent requests do not interleave.
+func (t *Tracer) log(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Log.Write(p)
+}
+
+// record appends a completed request to the HAR file.
+func (t *Tracer) record(e *traceEntry) {
+	if t.HARFile == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed {
+		return
+	}
+	err := t.appendHAR(e.har())
+	if err != nil {
+		// report the first failure only
+		t.failed = true
+		fmt.Fprintf(os.Stderr, "failed to write trace file %q: %v\n", t.HARFile, err)
+	}
+}
+
+// appendHAR writes the entry over the end of the entries array of the HAR
+// file, followed by the end of the file, creating the file first if need
+// be.
+func (t *Tracer) appendHAR(entry harEntry) error {
+	if t.har == nil {
+		f, err := os.OpenFile(t.HARFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		// an existing file keeps its mode when truncated
+		if err := f.Chmod(0600); err != nil {
+			f.Close()
+			return err
+		}
+		var doc har
+		doc.Log.Version = "1.2"
+		doc.Log.Creator = harCreator{Name: "capturoo", Version: t.Version}
+		doc.Log.Entries = []harEntry{}
+		b, err := json.MarshalIndent(&doc, "", "  ")
+		if err != nil {
+			f.Close()
+			return err
+		}
+		// split the document inside the empty entries array
+		i := bytes.LastIndex(b, []byte("[]")) + 1
+		if _, err := f.Write(b[:i]); err != nil {
+			f.Close()
+			return err
+		}
+		t.har = f
+		t.end = int64(i)
+		t.suffix = append([]byte("\n    "), append(b[i:], '\n')...)
+	}
+
+	b, err := json.MarshalIndent(&entry, "      ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := ",\n      "
+	if t.n == 0 {
+		sep = "\n      "
+	}
+	var buf bytes.Buffer
+	buf.WriteString(sep)
+	buf.Write(b)
+	n := buf.Len()
+	buf.Write(t.suffix)
+	if _, err := t.har.WriteAt(buf.Bytes(), t.end); err != nil {
+		return err
+	}
+	t.end += int64(n)
+	t.n++
+	return nil
+}
+
+// Close closes the HAR file, if any.
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.har == nil {
+		return nil
+	}
+	err := t.har.Close()
+	t.har = nil
+	t.failed = true
+	return err
+}
+
+// writeHeaders writes the headers sorted by name followed by a blank
+// line, each line starting with prefix.
+func writeHeaders(w io.Writer, prefix string, h http.Header) {
+	h = redactHeaders(h)
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, v)
+		}
+	}
+	fmt.Fprintf(w, "%s\n", prefix)
+}
+
+// writeBody writes a body, if any, each line starting with prefix.
+func writeBody(w io.Writer, prefix string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	truncated := len(body) >= maxTraceBody
+	for _, line := range bytes.Split(bytes.TrimRight(redactBody(body), "\n"), []byte("\n")) {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+	if truncated {
+		fmt.Fprintf(w, "%s(truncated at %d bytes)\n", prefix, maxTraceBody)
+	}
+}
+
+// redactHeaders returns a copy of h without the bearer token.
+func redactHeaders(h http.Header) http.Header {
+	if h.Get("Authorization") == "" {
+		return h
+	}
+	c := h.Clone()
+	c.Set("Authorization", "Bearer "+redacted)
+	return c
+}
+
+// redactBody returns a JSON body with the credential fields redacted.
+// Other bodies are returned unchanged.
+func redactBody(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil || !redact(v) {
+		return body
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return b
+}
+
+// redact replaces the credential fields of a decoded JSON value reporting
+// whether there were any.
+func redact(v interface{}) bool {
+	var found bool
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, f := range v {
+			if redactedFields[k] {
+				v[k] = redacted
+				found = true
+			} else if redact(f) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, f := range v {
+			if redact(f) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// har is an HTTP Archive, see http://www.softwareishard.com/blog/har-12-spec/
+type har struct {
+	Log struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// har returns the HAR entry of a completed request.
+func (e *traceEntry) har() harEntry {
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	h := harEntry{
+		StartedDateTime: e.start,
+		Time:            ms(e.wait + e.receive),
+		Request: harRequest{
+			Method:      e.req.Method,
+			URL:         e.req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(e.req.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(e.reqBody),
+		},
+		Response: harResponse{
+			Cookies: []harNameValue{},
+			Headers: []harNameValue{},
+		},
+		Timings: harTimings{Wait: ms(e.wait), Receive: ms(e.receive)},
+	}
+	for name, values := range e.req.URL.Query() {
+		for _, v := range values {
+			h.Request.QueryString = append(h.Request.QueryString, harNameValue{name, v})
+		}
+	}
+	if len(e.reqBody) > 0 {
+		h.Request.PostData = &harPostData{
+			MimeType: e.req.Header.Get("Content-Type"),
+			Text:     string(redactBody(e.reqBody)),
+		}
+	}
+	if e.err != nil {
+		h.Comment = e.err.Error()
+		return h
+	}
+	h.Response.Status = e.res.StatusCode
+	h.Response.StatusText = http.StatusText(e.res.StatusCode)
+	h.Response.HTTPVersion = e.res.Proto
+	h.Response.Headers = harHeaders(e.res.Header)
+	h.Response.HeadersSize = -1
+	h.Response.BodySize = e.size
+	h.Response.Content = harContent{
+		Size:     e.size,
+		MimeType: e.res.Header.Get("Content-Type"),
+		Text:     string(redactBody(e.body.Bytes())),
+	}
+	return h
+}
+
+// harHeaders returns the headers sorted by name without the bearer token.
+func harHeaders(h http.Header) []harNameValue {
+	h = redactHeaders(h)
+	nv := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			nv = append(nv, harNameValue{name, v})
+		}
+	}
+	sort.SliceStable(nv, func(i, j int) bool {
+		return nv[i].Name < nv[j].Name
+	})
+	return nv
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"webhookSecret","webhookId":"w1","secret":"whsec_abc"}`)
+	}))
+
+	var log bytes.Buffer
+	harFile := filepath.Join(t.TempDir(), "trace.har")
+	// a previous trace is replaced and made private
+	if err := ioutil.WriteFile(harFile, []byte("previous trace"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(ts.URL)
+	c.JWT = "jwt_secret"
+	c.Retry = RetryPolicy{}
+	c.Trace = &Tracer{Log: &log, Bodies: true, HARFile: harFile, Version: "v1"}
+	if _, err := c.GetWebhookSecret(context.Background(), "w1"); err != nil {
+		t.Fatal(err)
+	}
+	if doc := readHAR(t, harFile); len(doc.Log.Entries) != 1 {
+		t.Fatalf("HAR entries after the first request incorrect, got: %d, want: 1", len(doc.Log.Entries))
+	}
+	ts.Close()
+	if _, err := c.GetWebhook(context.Background(), "w1"); err == nil {
+		t.Fatal("GetWebhook of a closed server succeeded")
+	}
+	if err := c.Trace.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := log.String()
+	for _, want := range []string{
+		"> GET " + ts.URL + "/webhooks/w1/secret\n",
+		"> Authorization: Bearer REDACTED\n",
+		"< 200 OK (",
+		"< Content-Type: application/json\n",
+		`"secret":"REDACTED"`,
+		"< GET " + ts.URL + "/webhooks/w1 failed after",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log missing %q, got:\n%s", want, got)
+		}
+	}
+	for _, secret := range []string{"jwt_secret", "whsec_abc"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("log contains %q", secret)
+		}
+	}
+
+	fi, err := os.Stat(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("HAR file mode incorrect, got: %o, want: 600", mode)
+	}
+	b, err := ioutil.ReadFile(harFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := readHAR(t, harFile)
+	if doc.Log.Creator.Version != "v1" {
+		t.Errorf("HAR creator incorrect, got: %+v", doc.Log.Creator)
+	}
+	if n := len(doc.Log.Entries); n != 2 {
+		t.Fatalf("HAR entries incorrect, got: %d, want: 2", n)
+	}
+	e := doc.Log.Entries[0]
+	if e.Request.Method != "GET" || e.Response.Status != 200 || !strings.Contains(e.Response.Content.Text, `"webhookId":"w1"`) {
+		t.Errorf("HAR entry incorrect, got: %+v", e)
+	}
+	if e := doc.Log.Entries[1]; e.Response.Status != 0 || e.Comment == "" {
+		t.Errorf("HAR entry of failed request incorrect, got: %+v", e)
+	}
+	for _, secret := range []string{"jwt_secret", "whsec_abc"} {
+		if bytes.Contains(b, []byte(secret)) {
+			t.Errorf("HAR file contains %q", secret)
+		}
+	}
+}
+
+func readHAR(t *testing.T, filename string) *har {
+	t.Helper()
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc har
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("HAR file is not valid JSON: %v\n%s", err, b)
+	}
+	return &doc
+}
@@ -1,40 +1,5 @@
 package internal
 
-import "errors"
-
-// ErrAccountNotFound error
-var ErrAccountNotFound = errors.New("account/account-not-found")
-
-// ErrAccountEmailAlreadyExists occurs when attempting to signup with an email that is in use.
-var ErrAccountEmailAlreadyExists = errors.New("account/email-exists")
-
-// ErrBucketCodeExists occurs when attempting to create a new bucket that already exists.
-var ErrBucketCodeExists = errors.New("bucket/bucket-code-exists")
-
-// ErrBucketNotFound error
-var ErrBucketNotFound = errors.New("bucket/bucket-not-found")
-
-// ErrLeadNotFound error
-var ErrLeadNotFound = errors.New("lead/lead-not-found")
-
-// ErrDeveloperKeyNotFound error
-var ErrDeveloperKeyNotFound = errors.New("signin/developer-key-not-found")
-
-// ErrBucketScheduledForDeletion sentinel value to indicate future bucket deletion.
-var ErrBucketScheduledForDeletion = errors.New("bucket/bucket-scheduled-for-deletion")
-
-// ErrWebhookURLExists sentinel error
-var ErrWebhookURLExists = errors.New("webhook/webhook-url-exists")
-
-// ErrWebhookCodeExists error
-var ErrWebhookCodeExists = errors.New("webhook/webhook-code-exists")
-
-// ErrWebhookNotFound error
-var ErrWebhookNotFound = errors.New("webhook/webhook-not-found")
-
-// ErrWebhookPermissionDenied error
-var ErrWebhookPermissionDenied = errors.New("webhook/webhook-permission-denied")
-
 const (
 	// ErrCodeBadRequest is sent as the error code for 400 Bad Request.
 	ErrCodeBadRequest string = "bad-request"
@@ -48,6 +13,9 @@ type APIErrorResponse struct {
 	Status  int    `json:"status"`
 	Code    string `json:"code"`
 	Message string `json:"message"`
+
+	// RequestID identifies the request in the API logs.
+	RequestID string `json:"requestId,omitempty"`
 }
 
 const (
@@ -83,4 +51,10 @@ const (
 
 	// ErrCodeWebhookResourcesNotFound error code string.
 	ErrCodeWebhookResourcesNotFound string = "webhook/webhook-resources-not-found"
+
+	// ErrCodeWebhookDeliveryNotFound error code string.
+	ErrCodeWebhookDeliveryNotFound string = "webhook/webhook-delivery-not-found"
+
+	// ErrCodeIdempotencyKeyReused error code string.
+	ErrCodeIdempotencyKeyReused string = "idempotency/key-reused"
 )
@@ -0,0 +1,348 @@
+package query
+
+import (
+	"fmt"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == s
+}
+
+func (p *parser) isKeyword(s string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == s
+}
+
+func (p *parser) expect(s string) error {
+	t := p.next()
+	if t.kind != tokPunct || t.text != s {
+		return fmt.Errorf("expected %q but found %s at position %d", s, t, t.pos)
+	}
+	return nil
+}
+
+// parsePipe parses the lowest precedence expression pipe := comma ('|' comma)*
+func (p *parser) parsePipe() (node, error) {
+	l, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("|") {
+		p.next()
+		r, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		l = &pipeNode{l, r}
+	}
+	return l, nil
+}
+
+// parseComma parses comma := alt (',' alt)*
+func (p *parser) parseComma() (node, error) {
+	l, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct(",") {
+		p.next()
+		r, err := p.parseAlt()
+		if err != nil {
+			return nil, err
+		}
+		l = &commaNode{l, r}
+	}
+	return l, nil
+}
+
+// parseAlt parses alt := or ('//' or)*
+func (p *parser) parseAlt() (node, error) {
+	l, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("//") {
+		p.next()
+		r, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		l = &altNode{l, r}
+	}
+	return l, nil
+}
+
+// parseOr parses or := and ('or' and)*
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicNode{"or", l, r}
+	}
+	return l, nil
+}
+
+// parseAnd parses and := compare ('and' compare)*
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		r, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		l = &logicNode{"and", l, r}
+	}
+	return l, nil
+}
+
+// parseCompare parses compare := additive (('=='|'!='|'<'|'<='|'>'|'>=') additive)?
+func (p *parser) parseCompare() (node, error) {
+	l, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.isPunct(op) {
+			p.next()
+			r, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{op, l, r}, nil
+		}
+	}
+	return l, nil
+}
+
+// parseAdditive parses additive := postfix (('+'|'-') postfix)*
+func (p *parser) parseAdditive() (node, error) {
+	l, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("+") || p.isPunct("-") {
+		op := p.next().text
+		r, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op, l, r}
+	}
+	return l, nil
+}
+
+// parsePostfix parses postfix := primary ('.' ident | '.' string | '[' ']' | '[' pipe ']')*
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.isPunct(".") {
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent && t.kind != tokString {
+				return nil, fmt.Errorf("expected field name but found %s at position %d", t, t.pos)
+			}
+			n = &fieldNode{n, t.text}
+			continue
+		}
+		if p.isPunct("[") {
+			p.next()
+			if p.isPunct("]") {
+				p.next()
+				n = &iterateNode{n}
+				continue
+			}
+			idx, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &indexNode{n, idx}
+			continue
+		}
+		return n, nil
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literalNode{t.num}, nil
+	case tokString:
+		return &literalNode{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{true}, nil
+		case "false":
+			return &literalNode{false}, nil
+		case "null":
+			return &literalNode{nil}, nil
+		}
+		return p.parseCall(t)
+	case tokPunct:
+		switch t.text {
+		case ".":
+			// .field, ."field" or the identity .
+			nt := p.peek()
+			if nt.kind == tokIdent || nt.kind == tokString {
+				p.next()
+				return &fieldNode{identityNode{}, nt.text}, nil
+			}
+			return identityNode{}, nil
+		case "(":
+			n, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return n, nil
+		case "[":
+			if p.isPunct("]") {
+				p.next()
+				return &arrayNode{}, nil
+			}
+			n, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return &arrayNode{n}, nil
+		case "{":
+			return p.parseObject()
+		case "-":
+			n, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryNode{"-", &literalNode{float64(0)}, n}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+}
+
+// parseCall parses a builtin function call with optional ';' separated
+// arguments.
+func (p *parser) parseCall(name token) (node, error) {
+	var args []node
+	if p.isPunct("(") {
+		p.next()
+		for {
+			arg, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.isPunct(";") {
+				p.next()
+				continue
+			}
+			break
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	fn, ok := builtins[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.pos)
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("function %s expects %d argument(s) but was given %d", name.text, fn.arity, len(args))
+	}
+	return &callNode{name.text, fn, args}, nil
+}
+
+// parseObject parses object construction where each key is an identifier,
+// a string or a parenthesised expression. A key without a value is
+// shorthand for the field of the same name {email} -> {email: .email}.
+func (p *parser) parseObject() (node, error) {
+	obj := &objectNode{}
+	if p.isPunct("}") {
+		p.next()
+		return obj, nil
+	}
+	for {
+		var key node
+		var name string
+		t := p.next()
+		switch {
+		case t.kind == tokIdent || t.kind == tokString:
+			key = &literalNode{t.text}
+			name = t.text
+		case t.kind == tokPunct && t.text == "(":
+			k, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			key = k
+		default:
+			return nil, fmt.Errorf("expected object key but found %s at position %d", t, t.pos)
+		}
+
+		var value node
+		if p.isPunct(":") {
+			p.next()
+			v, err := p.parseAlt()
+			if err != nil {
+				return nil, err
+			}
+			value = v
+		} else if name != "" {
+			value = &fieldNode{identityNode{}, name}
+		} else {
+			return nil, fmt.Errorf("expected ':' after object key at position %d", p.peek().pos)
+		}
+		obj.fields = append(obj.fields, objectField{key, value})
+
+		if p.isPunct(",") {
+			p.next()
+			continue
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	}
+}
@@ -0,0 +1,712 @@
+// Package query implements a small subset of the jq language for filtering
+// and reshaping JSON values such as leads.
+//
+// Supported syntax:
+//
+//	.  .field  ."field"  .[n]  .["field"]  .[]
+//	f | g   f, g   f // g
+//	== != < <= > >=   and  or   + -
+//	"string"  123  true  false  null
+//	{key: f, "key": f, (f): g, key}  [f]
+//
+// and the builtin functions select(f), not, empty, length, keys, has(k),
+// contains(s), startswith(s), endswith(s), test(re), ascii_downcase,
+// ascii_upcase, tostring and tonumber.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Query is a parsed expression.
+type Query struct {
+	src  string
+	root node
+}
+
+// Parse parses the expression src.
+func Parse(src string) (*Query, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return &Query{src: src, root: root}, nil
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Run evaluates the query against v returning the stream of results.
+// The value v must be made up of the types produced by encoding/json
+// when decoding into an interface{}.
+func (q *Query) Run(v interface{}) ([]interface{}, error) {
+	return q.root.eval(v)
+}
+
+// RunValue converts v to its generic JSON representation before
+// evaluating the query so that field names match the json struct tags.
+func (q *Query) RunValue(v interface{}) ([]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal: %w", err)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, fmt.Errorf("json unmarshal: %w", err)
+	}
+	return q.Run(generic)
+}
+
+type node interface {
+	eval(in interface{}) ([]interface{}, error)
+}
+
+type identityNode struct{}
+
+func (identityNode) eval(in interface{}) ([]interface{}, error) {
+	return []interface{}{in}, nil
+}
+
+type literalNode struct {
+	v interface{}
+}
+
+func (n *literalNode) eval(in interface{}) ([]interface{}, error) {
+	return []interface{}{n.v}, nil
+}
+
+type fieldNode struct {
+	base node
+	name string
+}
+
+func (n *fieldNode) eval(in interface{}) ([]interface{}, error) {
+	bases, err := n.base.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, b := range bases {
+		v, err := index(b, n.name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+type indexNode struct {
+	base node
+	idx  node
+}
+
+func (n *indexNode) eval(in interface{}) ([]interface{}, error) {
+	bases, err := n.base.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	idxs, err := n.idx.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, b := range bases {
+		for _, i := range idxs {
+			v, err := index(b, i)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+type iterateNode struct {
+	base node
+}
+
+func (n *iterateNode) eval(in interface{}) ([]interface{}, error) {
+	bases, err := n.base.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, b := range bases {
+		switch t := b.(type) {
+		case []interface{}:
+			out = append(out, t...)
+		case map[string]interface{}:
+			for _, k := range sortedKeys(t) {
+				out = append(out, t[k])
+			}
+		default:
+			return nil, fmt.Errorf("cannot iterate over %s", typeName(b))
+		}
+	}
+	return out, nil
+}
+
+type pipeNode struct {
+	l, r node
+}
+
+func (n *pipeNode) eval(in interface{}) ([]interface{}, error) {
+	ls, err := n.l.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range ls {
+		rs, err := n.r.eval(l)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rs...)
+	}
+	return out, nil
+}
+
+type commaNode struct {
+	l, r node
+}
+
+func (n *commaNode) eval(in interface{}) ([]interface{}, error) {
+	ls, err := n.l.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := n.r.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	return append(ls, rs...), nil
+}
+
+// altNode returns the truthy results of l or, if there are none, the
+// results of r.
+type altNode struct {
+	l, r node
+}
+
+func (n *altNode) eval(in interface{}) ([]interface{}, error) {
+	ls, err := n.l.eval(in)
+	var out []interface{}
+	if err == nil {
+		for _, l := range ls {
+			if truthy(l) {
+				out = append(out, l)
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+	return n.r.eval(in)
+}
+
+type logicNode struct {
+	op   string
+	l, r node
+}
+
+func (n *logicNode) eval(in interface{}) ([]interface{}, error) {
+	ls, err := n.l.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, l := range ls {
+		if n.op == "and" && !truthy(l) {
+			out = append(out, false)
+			continue
+		}
+		if n.op == "or" && truthy(l) {
+			out = append(out, true)
+			continue
+		}
+		rs, err := n.r.eval(in)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rs {
+			out = append(out, truthy(r))
+		}
+	}
+	return out, nil
+}
+
+type binaryNode struct {
+	op   string
+	l, r node
+}
+
+func (n *binaryNode) eval(in interface{}) ([]interface{}, error) {
+	ls, err := n.l.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := n.r.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, r := range rs {
+		for _, l := range ls {
+			v, err := binary(n.op, l, r)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+type objectField struct {
+	key, value node
+}
+
+type objectNode struct {
+	fields []objectField
+}
+
+func (n *objectNode) eval(in interface{}) ([]interface{}, error) {
+	objs := []map[string]interface{}{{}}
+	for _, f := range n.fields {
+		keys, err := f.key.eval(in)
+		if err != nil {
+			return nil, err
+		}
+		values, err := f.value.eval(in)
+		if err != nil {
+			return nil, err
+		}
+
+		// each key and value produces a new object for every combination.
+		var next []map[string]interface{}
+		for _, obj := range objs {
+			for _, k := range keys {
+				ks, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("object keys must be strings, not %s", typeName(k))
+				}
+				for _, v := range values {
+					m := make(map[string]interface{}, len(obj)+1)
+					for ok, ov := range obj {
+						m[ok] = ov
+					}
+					m[ks] = v
+					next = append(next, m)
+				}
+			}
+		}
+		objs = next
+	}
+	out := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		out = append(out, obj)
+	}
+	return out, nil
+}
+
+type arrayNode struct {
+	body node
+}
+
+func (n *arrayNode) eval(in interface{}) ([]interface{}, error) {
+	if n.body == nil {
+		return []interface{}{[]interface{}{}}, nil
+	}
+	vs, err := n.body.eval(in)
+	if err != nil {
+		return nil, err
+	}
+	if vs == nil {
+		vs = []interface{}{}
+	}
+	return []interface{}{vs}, nil
+}
+
+type builtin struct {
+	arity int
+	fn    func(in interface{}, args []interface{}) ([]interface{}, error)
+}
+
+type callNode struct {
+	name string
+	fn   builtin
+	args []node
+}
+
+func (n *callNode) eval(in interface{}) ([]interface{}, error) {
+	// select evaluates its argument as a filter rather than a value.
+	if n.name == "select" {
+		conds, err := n.args[0].eval(in)
+		if err != nil {
+			return nil, err
+		}
+		var out []interface{}
+		for _, c := range conds {
+			if truthy(c) {
+				out = append(out, in)
+			}
+		}
+		return out, nil
+	}
+
+	if len(n.args) == 0 {
+		return n.fn.fn(in, nil)
+	}
+	argvs, err := n.args[0].eval(in)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, a := range argvs {
+		vs, err := n.fn.fn(in, []interface{}{a})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", n.name, err)
+		}
+		out = append(out, vs...)
+	}
+	return out, nil
+}
+
+var builtins map[string]builtin
+
+func init() {
+	one := func(f func(in interface{}) (interface{}, error)) builtin {
+		return builtin{0, func(in interface{}, args []interface{}) ([]interface{}, error) {
+			v, err := f(in)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{v}, nil
+		}}
+	}
+	stringArg := func(f func(s, arg string) interface{}) builtin {
+		return builtin{1, func(in interface{}, args []interface{}) ([]interface{}, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("input must be a string, not %s", typeName(in))
+			}
+			arg, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("argument must be a string, not %s", typeName(args[0]))
+			}
+			return []interface{}{f(s, arg)}, nil
+		}}
+	}
+
+	builtins = map[string]builtin{
+		"select": {arity: 1},
+		"empty": {0, func(in interface{}, args []interface{}) ([]interface{}, error) {
+			return nil, nil
+		}},
+		"not": one(func(in interface{}) (interface{}, error) {
+			return !truthy(in), nil
+		}),
+		"length": one(func(in interface{}) (interface{}, error) {
+			switch t := in.(type) {
+			case nil:
+				return float64(0), nil
+			case bool:
+				return nil, fmt.Errorf("boolean has no length")
+			case float64:
+				return math.Abs(t), nil
+			case string:
+				return float64(utf8.RuneCountInString(t)), nil
+			case []interface{}:
+				return float64(len(t)), nil
+			case map[string]interface{}:
+				return float64(len(t)), nil
+			}
+			return nil, fmt.Errorf("%s has no length", typeName(in))
+		}),
+		"keys": one(func(in interface{}) (interface{}, error) {
+			switch t := in.(type) {
+			case map[string]interface{}:
+				keys := make([]interface{}, 0, len(t))
+				for _, k := range sortedKeys(t) {
+					keys = append(keys, k)
+				}
+				return keys, nil
+			case []interface{}:
+				keys := make([]interface{}, 0, len(t))
+				for i := range t {
+					keys = append(keys, float64(i))
+				}
+				return keys, nil
+			}
+			return nil, fmt.Errorf("%s has no keys", typeName(in))
+		}),
+		"has": {1, func(in interface{}, args []interface{}) ([]interface{}, error) {
+			switch t := in.(type) {
+			case map[string]interface{}:
+				k, ok := args[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("cannot check whether object has a key of type %s", typeName(args[0]))
+				}
+				_, found := t[k]
+				return []interface{}{found}, nil
+			case []interface{}:
+				i, ok := args[0].(float64)
+				if !ok {
+					return nil, fmt.Errorf("cannot check whether array has a key of type %s", typeName(args[0]))
+				}
+				return []interface{}{i >= 0 && int(i) < len(t)}, nil
+			}
+			return nil, fmt.Errorf("cannot check whether %s has a key", typeName(in))
+		}},
+		"contains": {1, func(in interface{}, args []interface{}) ([]interface{}, error) {
+			switch t := in.(type) {
+			case string:
+				s, ok := args[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("string cannot contain %s", typeName(args[0]))
+				}
+				return []interface{}{strings.Contains(t, s)}, nil
+			case []interface{}:
+				for _, e := range t {
+					if reflect.DeepEqual(e, args[0]) {
+						return []interface{}{true}, nil
+					}
+				}
+				return []interface{}{false}, nil
+			}
+			return nil, fmt.Errorf("%s cannot contain values", typeName(in))
+		}},
+		"startswith": stringArg(func(s, arg string) interface{} {
+			return strings.HasPrefix(s, arg)
+		}),
+		"endswith": stringArg(func(s, arg string) interface{} {
+			return strings.HasSuffix(s, arg)
+		}),
+		"test": {1, func(in interface{}, args []interface{}) ([]interface{}, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("input must be a string, not %s", typeName(in))
+			}
+			pattern, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("pattern must be a string, not %s", typeName(args[0]))
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{re.MatchString(s)}, nil
+		}},
+		"ascii_downcase": one(func(in interface{}) (interface{}, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("input must be a string, not %s", typeName(in))
+			}
+			return strings.ToLower(s), nil
+		}),
+		"ascii_upcase": one(func(in interface{}) (interface{}, error) {
+			s, ok := in.(string)
+			if !ok {
+				return nil, fmt.Errorf("input must be a string, not %s", typeName(in))
+			}
+			return strings.ToUpper(s), nil
+		}),
+		"tostring": one(func(in interface{}) (interface{}, error) {
+			if s, ok := in.(string); ok {
+				return s, nil
+			}
+			b, err := json.Marshal(in)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		}),
+		"tonumber": one(func(in interface{}) (interface{}, error) {
+			switch t := in.(type) {
+			case float64:
+				return t, nil
+			case string:
+				n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot parse %q as a number", t)
+				}
+				return n, nil
+			}
+			return nil, fmt.Errorf("%s cannot be parsed as a number", typeName(in))
+		}),
+	}
+}
+
+// index returns the value of v at key k where k is either a field name
+// or an array index. Indexing null always yields null.
+func index(v interface{}, k interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot index object with %s", typeName(k))
+		}
+		return t[ks], nil
+	case []interface{}:
+		f, ok := k.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot index array with %s", typeName(k))
+		}
+		i := int(f)
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return nil, nil
+		}
+		return t[i], nil
+	}
+	return nil, fmt.Errorf("cannot index %s with %v", typeName(v), k)
+}
+
+func binary(op string, l, r interface{}) (interface{}, error) {
+	switch op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "+":
+		if l == nil {
+			return r, nil
+		}
+		if r == nil {
+			return l, nil
+		}
+		switch lt := l.(type) {
+		case float64:
+			if rt, ok := r.(float64); ok {
+				return lt + rt, nil
+			}
+		case string:
+			if rt, ok := r.(string); ok {
+				return lt + rt, nil
+			}
+		case []interface{}:
+			if rt, ok := r.([]interface{}); ok {
+				return append(append([]interface{}{}, lt...), rt...), nil
+			}
+		case map[string]interface{}:
+			if rt, ok := r.(map[string]interface{}); ok {
+				m := make(map[string]interface{}, len(lt)+len(rt))
+				for k, v := range lt {
+					m[k] = v
+				}
+				for k, v := range rt {
+					m[k] = v
+				}
+				return m, nil
+			}
+		}
+	case "-":
+		lt, lok := l.(float64)
+		rt, rok := r.(float64)
+		if lok && rok {
+			return lt - rt, nil
+		}
+	}
+	return nil, fmt.Errorf("%s and %s cannot be used with %s", typeName(l), typeName(r), op)
+}
+
+func equal(l, r interface{}) bool {
+	return reflect.DeepEqual(l, r)
+}
+
+// compare orders numbers and strings returning -1, 0 or 1.
+func compare(l, r interface{}) (int, error) {
+	switch lt := l.(type) {
+	case float64:
+		if rt, ok := r.(float64); ok {
+			switch {
+			case lt < rt:
+				return -1, nil
+			case lt > rt:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if rt, ok := r.(string); ok {
+			return strings.Compare(lt, rt), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", typeName(l), typeName(r))
+}
+
+// truthy reports whether v is neither false nor null.
+func truthy(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	return true
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testLead = `{
+	"leadId": "abc123",
+	"system": {"host": "example.com", "created": "2020-09-01T10:00:00Z"},
+	"data": {"email": "jane@example.com", "country": "UK", "age": 42, "tags": ["a", "b"]},
+	"tracking": null
+}`
+
+func TestRun(t *testing.T) {
+	var lead interface{}
+	if err := json.Unmarshal([]byte(testLead), &lead); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`.leadId`, `["abc123"]`},
+		{`.data.email`, `["jane@example.com"]`},
+		{`.data["country"]`, `["UK"]`},
+		{`.data.missing`, `[null]`},
+		{`.tracking.utm`, `[null]`},
+		{`.data.tags[]`, `["a","b"]`},
+		{`.data.tags[-1]`, `["b"]`},
+		{`select(.data.country=="UK") | {email: .data.email}`, `[{"email":"jane@example.com"}]`},
+		{`select(.data.country=="FR") | {email: .data.email}`, `null`},
+		{`select(.data.age > 40 and .data.country != "FR") | .leadId`, `["abc123"]`},
+		{`select(.data.age < 40 or (.data.email | endswith("@example.com"))) | .leadId`, `["abc123"]`},
+		{`.data | {email, country}`, `[{"country":"UK","email":"jane@example.com"}]`},
+		{`{(.leadId): .data.age}`, `[{"abc123":42}]`},
+		{`.data.name // "unknown"`, `["unknown"]`},
+		{`.data.email, .data.country`, `["jane@example.com","UK"]`},
+		{`[.data.tags[] | ascii_upcase]`, `[["A","B"]]`},
+		{`.data | keys`, `[["age","country","email","tags"]]`},
+		{`.data | has("email")`, `[true]`},
+		{`.data.tags | length`, `[2]`},
+		{`.data.email | test("^jane@")`, `[true]`},
+		{`.data.age + 1`, `[43]`},
+		{`.leadId + "-" + .data.country`, `["abc123-UK"]`},
+		{`.data.age | tostring`, `["42"]`},
+		{`"7" | tonumber`, `[7]`},
+		{`.data.country | not`, `[false]`},
+		{`empty`, `null`},
+	}
+	for _, tc := range tests {
+		q, err := Parse(tc.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) returned an error: %v", tc.expr, err)
+			continue
+		}
+		result, err := q.Run(lead)
+		if err != nil {
+			t.Errorf("Run(%q) returned an error: %v", tc.expr, err)
+			continue
+		}
+		var want []interface{}
+		if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result, want) {
+			got, _ := json.Marshal(result)
+			t.Errorf("Run(%q) incorrect, got: %s, want: %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	exprs := []string{
+		`.data.`,
+		`select(.a`,
+		`{email .data.email}`,
+		`unknownfn`,
+		`select(.a; .b)`,
+		`"unterminated`,
+		`.a ==`,
+		`.a )`,
+	}
+	for _, expr := range exprs {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) expected an error, got nil", expr)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	exprs := []string{
+		`.leadId.x`,
+		`.data.tags | keys | .[0] < "x"`,
+		`.data.email - 1`,
+		`.data.age[]`,
+	}
+	var lead interface{}
+	if err := json.Unmarshal([]byte(testLead), &lead); err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range exprs {
+		q, err := Parse(expr)
+		if err != nil {
+			t.Errorf("Parse(%q) returned an error: %v", expr, err)
+			continue
+		}
+		if _, err := q.Run(lead); err == nil {
+			t.Errorf("Run(%q) expected an error, got nil", expr)
+		}
+	}
+}
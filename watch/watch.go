@@ -0,0 +1,187 @@
+// Package watch polls an account for new buckets and leads and turns the
+// differences into webhook events.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"capturoo-cli-tool-go/http"
+)
+
+// DefaultInterval is the polling interval used when none is set.
+const DefaultInterval = 5 * time.Second
+
+// leadOverlap is how far before the newest lead seen each poll lists
+// leads from, to catch leads whose creation time is earlier than that of a
+// lead already seen.
+const leadOverlap = time.Minute
+
+// Watcher polls the account for the subscribed events. Events use the
+// webhook syntax, e.g. bucket.created or lead.created:summer|winter.
+type Watcher struct {
+	Client    *http.Client
+	AccountID string
+	Events    []string
+	Interval  time.Duration
+
+	buckets map[string]*http.Bucket         // by bucket ID
+	leads   map[string]map[string]time.Time // lead creation times by ID by bucket code
+	cursors map[string]time.Time            // newest lead creation time by bucket code
+}
+
+// Run polls until ctx is done calling fn for each event in the order
+// detected. The first poll records the existing buckets and leads
+// without emitting events. Run returns the first error from a poll or fn.
+func (w *Watcher) Run(ctx context.Context, fn func(*http.WebhookEvent) error) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if err := w.Poll(ctx, nil); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.Poll(ctx, fn); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Poll fetches the current state once and calls fn for each change since
+// the previous poll. A nil fn records the state without emitting events.
+func (w *Watcher) Poll(ctx context.Context, fn func(*http.WebhookEvent) error) error {
+	buckets, err := w.Client.GetBuckets(ctx, w.AccountID)
+	if err != nil {
+		return fmt.Errorf("get buckets: %w", err)
+	}
+	current := make(map[string]*http.Bucket)
+	byCode := make(map[string]*http.Bucket)
+	for _, b := range buckets {
+		current[b.BucketID] = b
+		byCode[b.BucketCode] = b
+	}
+
+	var events []*http.WebhookEvent
+	emit := func(typ, bucketCode string, data interface{}) error {
+		ev, err := http.NewWebhookEvent(typ, w.AccountID, bucketCode, data)
+		if err != nil {
+			return err
+		}
+		events = append(events, ev)
+		return nil
+	}
+
+	if w.buckets != nil {
+		if w.subscribed("bucket.created") {
+			for _, b := range buckets {
+				if _, ok := w.buckets[b.BucketID]; !ok {
+					if err := emit("bucket.created", b.BucketCode, b); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if w.subscribed("bucket.deleted") {
+			for id, b := range w.buckets {
+				if _, ok := current[id]; !ok {
+					if err := emit("bucket.deleted", b.BucketCode, b); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	first := w.leads == nil
+	if first {
+		w.leads = make(map[string]map[string]time.Time)
+		w.cursors = make(map[string]time.Time)
+	}
+	for _, code := range w.leadBuckets() {
+		b, ok := byCode[code]
+		if !ok {
+			continue
+		}
+		seen, ok := w.leads[code]
+		if !ok {
+			seen = make(map[string]time.Time)
+			w.leads[code] = seen
+		}
+
+		// only list the leads since the newest seen, less the overlap
+		var opts *http.LeadListOptions
+		cursor := w.cursors[code]
+		if !cursor.IsZero() {
+			opts = &http.LeadListOptions{CreatedAfter: cursor.Add(-leadOverlap)}
+		}
+		err := w.Client.ForEachLeadWithOptions(ctx, b.BucketID, opts, func(l *http.Lead) error {
+			if _, ok := seen[l.LeadID]; ok {
+				return nil
+			}
+			seen[l.LeadID] = l.System.Created
+			if l.System.Created.After(cursor) {
+				cursor = l.System.Created
+			}
+			if first || fn == nil {
+				return nil
+			}
+			return emit("lead.created", code, l)
+		})
+		if err != nil {
+			return fmt.Errorf("get leads for bucket %q: %w", code, err)
+		}
+		w.cursors[code] = cursor
+
+		// leads before the overlap are not listed again
+		for id, created := range seen {
+			if created.Before(cursor.Add(-leadOverlap)) {
+				delete(seen, id)
+			}
+		}
+	}
+	w.buckets = current
+
+	if fn == nil {
+		return nil
+	}
+	for _, ev := range events {
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribed reports whether the plain event type is subscribed to.
+func (w *Watcher) subscribed(typ string) bool {
+	for _, e := range w.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// leadBuckets returns the bucket codes of the lead.created subscriptions.
+func (w *Watcher) leadBuckets() []string {
+	var codes []string
+	for _, e := range w.Events {
+		parts := strings.SplitN(e, ":", 2)
+		if parts[0] != "lead.created" || len(parts) != 2 {
+			continue
+		}
+		codes = append(codes, strings.Split(parts[1], "|")...)
+	}
+	return codes
+}
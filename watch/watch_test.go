@@ -0,0 +1,136 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"capturoo-cli-tool-go/emulator"
+	"capturoo-cli-tool-go/http"
+)
+
+func TestPoll(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := http.NewClient(ts.URL)
+	client.JWT = srv.IDToken()
+	accountID := srv.Account().AccountID
+
+	b, err := client.CreateBucket(ctx, accountID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*http.Lead{{LeadID: "old"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Watcher{
+		Client:    client,
+		AccountID: accountID,
+		Events:    []string{"bucket.created", "lead.created:summer"},
+	}
+	if err := w.Poll(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*http.Lead{{LeadID: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateBucket(ctx, accountID, "winter", "Winter"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*http.WebhookEvent
+	err = w.Poll(ctx, func(ev *http.WebhookEvent) error {
+		got = append(got, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Poll events incorrect, got: %d events, want: %d", len(got), 2)
+	}
+	if got[0].Type != "bucket.created" || got[0].BucketCode != "winter" {
+		t.Errorf("first event incorrect, got: %s %s, want: bucket.created winter", got[0].Type, got[0].BucketCode)
+	}
+	if got[1].Type != "lead.created" || got[1].BucketCode != "summer" {
+		t.Errorf("second event incorrect, got: %s %s, want: lead.created summer", got[1].Type, got[1].BucketCode)
+	}
+}
+
+func TestPollCursor(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var createdAfter []string
+	ts := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.URL.Path == "/leads" {
+			createdAfter = append(createdAfter, r.URL.Query().Get("createdAfter"))
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := http.NewClient(ts.URL)
+	client.JWT = srv.IDToken()
+	accountID := srv.Account().AccountID
+	b, err := client.CreateBucket(ctx, accountID, "summer", "Summer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := client.ImportLeads(ctx, b.BucketID, []*http.Lead{{LeadID: "old", System: http.System{Created: created}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Watcher{Client: client, AccountID: accountID, Events: []string{"lead.created:summer"}}
+	if err := w.Poll(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lead created just before the newest seen is still caught, one
+	// created before the overlap is not listed
+	leads := []*http.Lead{
+		{LeadID: "late", System: http.System{Created: created.Add(-time.Second)}},
+		{LeadID: "ancient", System: http.System{Created: created.Add(-time.Hour)}},
+		{LeadID: "new", System: http.System{Created: created.Add(time.Second)}},
+	}
+	if _, err := client.ImportLeads(ctx, b.BucketID, leads); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 2; i++ {
+		err := w.Poll(ctx, func(ev *http.WebhookEvent) error {
+			var l http.Lead
+			if err := json.Unmarshal(ev.Data, &l); err != nil {
+				return err
+			}
+			got = append(got, l.LeadID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(got, ",") != "late,new" {
+		t.Errorf("Poll lead events incorrect, got: %v, want: [late new]", got)
+	}
+
+	want := []string{"", created.Add(-leadOverlap).Format(time.RFC3339Nano), created.Add(time.Second - leadOverlap).Format(time.RFC3339Nano)}
+	if strings.Join(createdAfter, ",") != strings.Join(want, ",") {
+		t.Errorf("createdAfter incorrect, got: %q, want: %q", createdAfter, want)
+	}
+}
@@ -0,0 +1,100 @@
+// Package transform renders webhook events into the payload expected by
+// the target, such as a Slack, Microsoft Teams or Google Chat incoming
+// webhook, so that no glue service is needed in between.
+//
+// Transforms see the event as decoded JSON, so the same field names work
+// in both languages, for example
+//
+//	go-template  {"text": {{json (printf "New lead %s" .data.data.email)}}}
+//	jq           {text: ("New lead " + .data.data.email)}
+//
+// Go templates have the lead template functions such as json, default and
+// date. The output must be a single JSON value.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"capturoo-cli-tool-go/http"
+	"capturoo-cli-tool-go/query"
+)
+
+// Transform is a parsed webhook transform.
+type Transform struct {
+	tmpl  *template.Template
+	query *query.Query
+}
+
+// Parse parses the transform source in the given language.
+func Parse(t *http.WebhookTransform) (*Transform, error) {
+	switch t.Language {
+	case http.TransformTemplate:
+		tmpl, err := template.New("transform").Funcs(http.TemplateFuncs).Parse(t.Source)
+		if err != nil {
+			return nil, err
+		}
+		return &Transform{tmpl: tmpl}, nil
+	case http.TransformJQ:
+		q, err := query.Parse(t.Source)
+		if err != nil {
+			return nil, err
+		}
+		return &Transform{query: q}, nil
+	}
+	return nil, fmt.Errorf("unknown transform language %q (use %s or %s)", t.Language, http.TransformTemplate, http.TransformJQ)
+}
+
+// LanguageForFile returns the transform language for a template file based
+// on its extension. Files ending .jq are jq expressions and any other file
+// is a Go template.
+func LanguageForFile(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".jq") {
+		return http.TransformJQ
+	}
+	return http.TransformTemplate
+}
+
+// Render returns the payload for the event.
+func (t *Transform) Render(ev *http.WebhookEvent) ([]byte, error) {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	if t.query != nil {
+		results, err := t.query.Run(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) != 1 {
+			return nil, fmt.Errorf("jq transform must produce a single value but produced %d", len(results))
+		}
+		return json.Marshal(results[0])
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, v); err != nil {
+		return nil, err
+	}
+	out := bytes.TrimSpace(buf.Bytes())
+	if !json.Valid(out) {
+		return nil, fmt.Errorf("template output is not valid JSON: %s", truncate(out, 200))
+	}
+	return out, nil
+}
+
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		return string(b[:n]) + "..."
+	}
+	return string(b)
+}
@@ -0,0 +1,71 @@
+package transform
+
+import (
+	"testing"
+
+	"capturoo-cli-tool-go/http"
+)
+
+func TestRender(t *testing.T) {
+	ev, err := http.NewWebhookEvent("lead.created", "acc_1", "summer", &http.Lead{
+		LeadID: "lead_1",
+		Data:   map[string]interface{}{"email": "jane@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		language string
+		source   string
+		want     string
+		wantErr  bool
+	}{
+		{"template", http.TransformTemplate, `{"text": {{json (printf "New lead %s in %s" .data.data.email .bucketCode)}}}`, `{"text": "New lead jane@example.com in summer"}`, false},
+		{"jq", http.TransformJQ, `{text: ("New lead " + .data.data.email), lead: .data.leadId}`, `{"lead":"lead_1","text":"New lead jane@example.com"}`, false},
+		{"template invalid json", http.TransformTemplate, `text {{.type}}`, "", true},
+		{"jq multiple values", http.TransformJQ, `.type, .bucketCode`, "", true},
+	}
+	for _, tc := range tests {
+		tr, err := Parse(&http.WebhookTransform{Language: tc.language, Source: tc.source})
+		if err != nil {
+			t.Fatalf("%s: Parse returned an error: %v", tc.name, err)
+		}
+		got, err := tr.Render(ev)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: Render expected an error, got: %s", tc.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Render returned an error: %v", tc.name, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: Render incorrect, got: %s, want: %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tr := range []*http.WebhookTransform{
+		{Language: http.TransformTemplate, Source: `{{.type`},
+		{Language: http.TransformJQ, Source: `{text: `},
+		{Language: "jsonata", Source: `$.type`},
+	} {
+		if _, err := Parse(tr); err == nil {
+			t.Errorf("Parse(%+v) expected an error", tr)
+		}
+	}
+}
+
+func TestLanguageForFile(t *testing.T) {
+	if got := LanguageForFile("slack.jq"); got != http.TransformJQ {
+		t.Errorf("LanguageForFile(slack.jq) incorrect, got: %s", got)
+	}
+	if got := LanguageForFile("slack.tmpl"); got != http.TransformTemplate {
+		t.Errorf("LanguageForFile(slack.tmpl) incorrect, got: %s", got)
+	}
+}
@@ -0,0 +1,152 @@
+// Package verify validates the signature of webhook deliveries sent by
+// Capturoo.
+//
+// Each delivery carries a Capturoo-Signature header of the form
+//
+//	t=1598918400,v1=5257a869e7ecebeda32affa62cdca3fa51cad7e77a0e56ff536d0ce8e108d8bd
+//
+// where t is the Unix time the delivery was signed and v1 is the hex
+// encoded HMAC-SHA256 of the timestamp, a full stop and the raw request
+// body keyed with the webhook signing secret. A header may hold more than
+// one v1 signature while a secret is being rotated.
+package verify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader is the request header holding the signature.
+const SignatureHeader = "Capturoo-Signature"
+
+// DefaultTolerance is the maximum age of a signature accepted by
+// VerifyRequest.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrNoSignature occurs when the signature header is missing.
+	ErrNoSignature = errors.New("verify: no signature header")
+
+	// ErrInvalidHeader occurs when the signature header is malformed.
+	ErrInvalidHeader = errors.New("verify: invalid signature header")
+
+	// ErrTimestampTolerance occurs when the signature timestamp is
+	// outside the tolerance.
+	ErrTimestampTolerance = errors.New("verify: timestamp outside the tolerance")
+
+	// ErrSignatureMismatch occurs when no signature matches the payload.
+	ErrSignatureMismatch = errors.New("verify: signature mismatch")
+)
+
+// Sign returns the signature header value for the payload signed with
+// secret at time t.
+func Sign(payload []byte, secret string, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(computeMAC(ts, payload, secret))
+}
+
+// SignRequest signs the body of r with secret, setting the signature
+// header. It is used by tools that deliver webhooks.
+func SignRequest(r *http.Request, secret string) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("verify: read body: %w", err)
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	r.Header.Set(SignatureHeader, Sign(body, secret, time.Now()))
+	return nil
+}
+
+// Verify checks that header holds a signature of payload made with secret
+// no more than tolerance ago. A zero tolerance skips the timestamp check.
+func Verify(payload []byte, header, secret string, tolerance time.Duration) error {
+	return verifyAt(payload, header, secret, tolerance, time.Now())
+}
+
+// VerifyRequest reads the body of r and verifies it against the signature
+// header using DefaultTolerance. The body is returned and r.Body is reset
+// so that it can be read again.
+func VerifyRequest(r *http.Request, secret string) ([]byte, error) {
+	header := r.Header.Get(SignatureHeader)
+	if header == "" {
+		return nil, ErrNoSignature
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("verify: read body: %w", err)
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := Verify(body, header, secret, DefaultTolerance); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func verifyAt(payload []byte, header, secret string, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrNoSignature
+	}
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return ErrInvalidHeader
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sig, err := hex.DecodeString(kv[1])
+			if err != nil {
+				return ErrInvalidHeader
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return ErrInvalidHeader
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidHeader
+	}
+
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return fmt.Errorf("%w (signed %s ago)", ErrTimestampTolerance, age.Round(time.Second))
+		}
+	}
+
+	expected := computeMAC(ts, payload, secret)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+func computeMAC(ts string, payload []byte, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
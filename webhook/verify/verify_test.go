@@ -0,0 +1,54 @@
+package verify
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"type":"lead.created"}`)
+	now := time.Unix(1598918400, 0)
+	header := Sign(payload, "whsec_test", now)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		secret  string
+		now     time.Time
+		want    error
+	}{
+		{"valid", payload, header, "whsec_test", now, nil},
+		{"within tolerance", payload, header, "whsec_test", now.Add(4 * time.Minute), nil},
+		{"expired", payload, header, "whsec_test", now.Add(10 * time.Minute), ErrTimestampTolerance},
+		{"wrong secret", payload, header, "whsec_other", now, ErrSignatureMismatch},
+		{"tampered payload", []byte(`{"type":"bucket.deleted"}`), header, "whsec_test", now, ErrSignatureMismatch},
+		{"rotated secret", payload, header + ",v1=" + strings.Repeat("00", 32), "whsec_test", now, nil},
+		{"missing header", payload, "", "whsec_test", now, ErrNoSignature},
+		{"malformed header", payload, "v1", "whsec_test", now, ErrInvalidHeader},
+		{"no timestamp", payload, "v1=abcd", "whsec_test", now, ErrInvalidHeader},
+	}
+	for _, tc := range tests {
+		err := verifyAt(tc.payload, tc.header, tc.secret, DefaultTolerance, tc.now)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("verify %s incorrect, got: %v, want: %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	payload := `{"type":"lead.created"}`
+	r := httptest.NewRequest("POST", "/hook", strings.NewReader(payload))
+	r.Header.Set(SignatureHeader, Sign([]byte(payload), "whsec_test", time.Now()))
+
+	body, err := VerifyRequest(r, "whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != payload {
+		t.Errorf("VerifyRequest body incorrect, got: %s, want: %s", body, payload)
+	}
+}